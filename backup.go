@@ -0,0 +1,395 @@
+package caskdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	manifestFileExtension = "manifest"
+	// backupCopyBufferSize is the size of each read when the datafile is copied
+	backupCopyBufferSize = 1024 * 1024
+)
+
+var (
+	// ErrBackupCorrupted is returned by Restore when the backups doesn't match their manifest
+	ErrBackupCorrupted = errors.New("backup is corrupted")
+	errBackupExists    = errors.New("backup already exists in the directory")
+	errDatabaseExists  = errors.New("database already exists")
+)
+
+// Linker is implemented by FileSystem that supports hard links,
+// Backup links the immutable datafiles instead of copying them
+type Linker interface {
+	// Link will create newName as a hard link to oldName
+	Link(oldName, newName string) error
+}
+
+// BackupManifest describe the datafiles of a backup, it is written
+// to the directory after the datafiles and hint files
+type BackupManifest struct {
+	// Timestamp is when the backup is taken
+	Timestamp time.Time
+	// Head is the position after the last entry in the backup
+	Head  Position
+	Files []BackupFile
+}
+
+// BackupFile is a datafile of the database when the backup is taken, only
+// the part from Offset to Size is written to the backup, the part before
+// Offset is in the previous backups
+type BackupFile struct {
+	FileID   int
+	Size     int64
+	Offset   int64
+	Checksum uint32 // CRC-32C of the datafile up to Size
+}
+
+func (m *BackupManifest) file(fileID int) (BackupFile, bool) {
+	for _, f := range m.Files {
+		if f.FileID == fileID {
+			return f, true
+		}
+	}
+
+	return BackupFile{}, false
+}
+
+// Backup will write a consistent copy of the database at the time Backup
+// is called to the directory, with the same file name as the database, so
+// it can be opened using NewDiskStorage(path.Join(dir, name)). Writes continue
+// during the backup, while merge waits until it is finished. Immutable datafiles
+// are hard linked if the FileSystem implements Linker, and only the part of the
+// active file that is written before the backup is copied.
+// The directory must exist and must not contain other backup of the database
+func (s *DiskStorage) Backup(dir string) (*BackupManifest, error) {
+	return s.BackupContext(context.Background(), dir)
+}
+
+// BackupContext is Backup that is aborted with the context error once the
+// context is done, the files written to the directory are removed
+func (s *DiskStorage) BackupContext(ctx context.Context, dir string) (*BackupManifest, error) {
+	return s.backup(ctx, dir, nil)
+}
+
+// BackupIncremental is like Backup, but only the datafiles created or extended
+// since the previous backup are written, and only the extended part of them.
+// The incremental backup can't be opened by itself, use Restore to reassemble
+// the database from the full backup and every incremental backup after it
+func (s *DiskStorage) BackupIncremental(dir string, previous *BackupManifest) (*BackupManifest, error) {
+	return s.BackupIncrementalContext(context.Background(), dir, previous)
+}
+
+// BackupIncrementalContext is BackupIncremental that is aborted like BackupContext
+func (s *DiskStorage) BackupIncrementalContext(ctx context.Context, dir string, previous *BackupManifest) (*BackupManifest, error) {
+	return s.backup(ctx, dir, previous)
+}
+
+func (s *DiskStorage) backup(ctx context.Context, dir string, previous *BackupManifest) (_ *BackupManifest, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	// the datafiles must not be removed until they are copied
+	s.fileRemoval.RLock()
+	defer s.fileRemoval.RUnlock()
+
+	name := path.Base(s.dbFileFullPath)
+	names, err := s.fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range names {
+		if strings.HasPrefix(existing, name+"_") || strings.HasPrefix(existing, name+".") {
+			return nil, fmt.Errorf("%w: %s", errBackupExists, path.Join(dir, existing))
+		}
+	}
+
+	// keyDir entries are never modified, so only the map is copied
+	s.RLock()
+	manifest := &BackupManifest{Timestamp: time.Now()}
+	hint := hintFiles{
+		KeyDir:    make(map[string]*keyDirEntry, len(s.keyDir)),
+		FileSizes: make(map[int]int64, len(s.files)),
+	}
+	for key, keyData := range s.keyDir {
+		hint.KeyDir[key] = keyData
+	}
+	files := make(map[int]*datafile, len(s.files))
+	for _, fileID := range s.sortedFileIDs() {
+		file := s.files[fileID]
+		files[fileID] = file
+		hint.FileSizes[fileID] = file.Size()
+		manifest.Files = append(manifest.Files, BackupFile{FileID: fileID, Size: file.Size()})
+	}
+	activeFileID := s.activeFileID
+	manifest.Head = Position{FileID: activeFileID, Offset: hint.FileSizes[activeFileID]}
+	s.RUnlock()
+
+	// the backup without the manifest is not valid, and it prevents the next
+	// backup to the same directory, so the written files are removed on error
+	target := path.Join(dir, name)
+	var written []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, fileName := range written {
+			if removeErr := s.fs.Remove(fileName); removeErr != nil && !os.IsNotExist(removeErr) {
+				s.logger.Error("failed to remove the aborted backup", "file", fileName, "error", removeErr)
+			}
+		}
+	}()
+
+	linker, canLink := s.fs.(Linker)
+	for i := range manifest.Files {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		f := &manifest.Files[i]
+		file := files[f.FileID]
+		targetName := fmt.Sprintf("%s_%d", target, f.FileID)
+
+		// datafiles are append only, so only the part after the previous backup is written
+		var crc uint32
+		if previous != nil {
+			if prev, found := previous.file(f.FileID); found && prev.Size <= f.Size {
+				f.Offset, crc = prev.Size, prev.Checksum
+			}
+		}
+		if f.Offset == f.Size {
+			f.Checksum = crc
+			continue
+		}
+
+		if canLink && f.Offset == 0 && f.FileID != activeFileID {
+			if err = linker.Link(file.fileID, targetName); err != nil {
+				return nil, err
+			}
+			written = append(written, targetName)
+			f.Checksum, err = copyDataFile(ctx, file, nil, 0, f.Size, 0)
+		} else {
+			var w File
+			if w, err = s.fs.OpenFile(targetName); err != nil {
+				return nil, err
+			}
+			written = append(written, targetName)
+			f.Checksum, err = copyDataFile(ctx, file, w, f.Offset, f.Size, crc)
+			if err == nil {
+				err = w.Sync()
+			}
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hintName := fmt.Sprintf("%s.%s", target, hintFilesExtension)
+	written = append(written, hintName)
+	if err = s.writeHintFiles(hintName, hint); err != nil {
+		return nil, err
+	}
+
+	// the manifest is written last, so the backup is only valid once it exists
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFile(s.fs, fmt.Sprintf("%s.%s", target, manifestFileExtension), b); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// copyDataFile will copy the datafile from the offset up to size to w, and return
+// the checksum of the copied data continued from crc. Nothing is written if w is nil.
+// The context is checked before every chunk
+func copyDataFile(ctx context.Context, r io.ReaderAt, w io.Writer, offset, size int64, crc uint32) (uint32, error) {
+	buf := make([]byte, backupCopyBufferSize)
+	for offset < size {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		n := size - offset
+		if n > int64(len(buf)) {
+			n = int64(len(buf))
+		}
+		if read, err := r.ReadAt(buf[:n], offset); err != nil && !(err == io.EOF && int64(read) == n) {
+			return 0, err
+		}
+		crc = crc32.Update(crc, castagnoli, buf[:n])
+		if w != nil {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return 0, err
+			}
+		}
+		offset += n
+	}
+
+	return crc, nil
+}
+
+// ReadBackupManifest will read the manifest of the backup, backup is the path
+// of the database in the backup directory, i.e. path.Join(dir, name)
+func ReadBackupManifest(backup string, options ...*Options) (*BackupManifest, error) {
+	fs := optionsFileSystem(options)
+	b, err := readFile(fs, fmt.Sprintf("%s.%s", backup, manifestFileExtension))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{}
+	if err = json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupted, err)
+	}
+
+	return manifest, nil
+}
+
+// Restore will reassemble the database at dbPath from the full backup followed by
+// every incremental backup after it in order, each backup is the path of the
+// database in the backup directory. Every datafile is verified using the checksum
+// in the manifest. dbPath must not contain any database, the restored files are
+// removed if the restore is failed
+func Restore(dbPath string, backups []string, options ...*Options) (err error) {
+	if len(backups) == 0 {
+		return errors.New("at least one backup is required")
+	}
+	fs := optionsFileSystem(options)
+
+	dir, name := path.Split(dbPath)
+	if dir == "" {
+		dir = "."
+	}
+	names, err := fs.List(dir)
+	if err != nil {
+		return err
+	}
+	for _, existing := range names {
+		if strings.HasPrefix(existing, name+"_") || strings.HasPrefix(existing, name+".") {
+			return fmt.Errorf("%w: %s", errDatabaseExists, path.Join(dir, existing))
+		}
+	}
+
+	manifests := make([]*BackupManifest, len(backups))
+	for i, backup := range backups {
+		if manifests[i], err = ReadBackupManifest(backup, options...); err != nil {
+			return err
+		}
+	}
+
+	restored := make([]string, 0)
+	defer func() {
+		if err != nil {
+			for _, name := range restored {
+				fs.Remove(name)
+			}
+		}
+	}()
+
+	last := manifests[len(manifests)-1]
+	for _, f := range last.Files {
+		targetName := fmt.Sprintf("%s_%d", dbPath, f.FileID)
+		restored = append(restored, targetName)
+		if err = restoreDataFile(fs, targetName, f.FileID, backups, manifests); err != nil {
+			return err
+		}
+	}
+
+	// the hint files match the datafiles of the last backup
+	hint, err := readFile(fs, fmt.Sprintf("%s.%s", backups[len(backups)-1], hintFilesExtension))
+	if err != nil {
+		return err
+	}
+	hintName := fmt.Sprintf("%s.%s", dbPath, hintFilesExtension)
+	restored = append(restored, hintName)
+
+	return writeFile(fs, hintName, hint)
+}
+
+// restoreDataFile will write the datafile from the last backup that has the
+// whole file, followed by the extended part in every backup after it
+func restoreDataFile(fs FileSystem, name string, fileID int, backups []string, manifests []*BackupManifest) error {
+	first := -1
+	for i := len(manifests) - 1; i >= 0; i-- {
+		f, found := manifests[i].file(fileID)
+		if !found {
+			break
+		}
+		if f.Offset == 0 {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		return fmt.Errorf("%w: datafile %d is not found in the full backup", ErrBackupCorrupted, fileID)
+	}
+
+	w, err := fs.OpenFile(name)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var size int64
+	var crc uint32
+	for i := first; i < len(manifests); i++ {
+		f, _ := manifests[i].file(fileID)
+		if f.Offset != size {
+			return fmt.Errorf("%w: datafile %d in %s starts at %d, expected %d", ErrBackupCorrupted, fileID, backups[i], f.Offset, size)
+		}
+		if f.Offset < f.Size {
+			r, err := fs.Open(fmt.Sprintf("%s_%d", backups[i], fileID))
+			if err != nil {
+				return err
+			}
+			// the data in the backup file starts at the offset
+			crc, err = copyDataFile(context.Background(), offsetReader{r, f.Offset}, w, f.Offset, f.Size, crc)
+			r.Close()
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: datafile %d in %s is truncated", ErrBackupCorrupted, fileID, backups[i])
+			} else if err != nil {
+				return err
+			}
+		}
+		if crc != f.Checksum {
+			return fmt.Errorf("%w: datafile %d in %s checksum mismatch", ErrBackupCorrupted, fileID, backups[i])
+		}
+		size = f.Size
+	}
+
+	return w.Sync()
+}
+
+// offsetReader read the file as if it starts at the offset
+type offsetReader struct {
+	File
+	offset int64
+}
+
+func (r offsetReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.File.ReadAt(p, off-r.offset)
+}
+
+// optionsFileSystem will return the FileSystem of the options, the OS filesystem by default
+func optionsFileSystem(options []*Options) FileSystem {
+	var fs FileSystem = OSFileSystem{}
+	for _, o := range options {
+		if o.fs != nil {
+			fs = o.fs
+		}
+	}
+
+	return fs
+}
@@ -0,0 +1,294 @@
+package caskdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage_Backup(t *testing.T) {
+	t.Parallel()
+
+	osDir := path.Join("testdata", t.Name()+"_"+uuid.NewString())
+	assert.Nil(t, os.MkdirAll(path.Join(osDir, "backup"), 0777))
+	defer os.RemoveAll(osDir)
+
+	fileSystems := map[string]struct {
+		fs  FileSystem
+		dir string
+	}{
+		"os":     {fs: OSFileSystem{}, dir: osDir},
+		"memory": {fs: NewMemFileSystem(), dir: "db"},
+	}
+	for name, tt := range fileSystems {
+		fs, dir := tt.fs, tt.dir
+		t.Run(name, func(t *testing.T) {
+			options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+			store := NewDiskStorage(path.Join(dir, "test"), options)
+			defer store.Close()
+
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+			}
+			assert.Nil(t, store.Delete([]byte("0")))
+
+			// writes continue during the backup, but they are not in the backup
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("after")))
+				}
+			}()
+			backupDir := path.Join(dir, "backup")
+			manifest, err := store.Backup(backupDir)
+			require.Nil(t, err)
+			wg.Wait()
+
+			_, err = store.Backup(backupDir)
+			assert.ErrorIs(t, err, errBackupExists)
+
+			b, err := readFile(fs, path.Join(backupDir, "test.manifest"))
+			require.Nil(t, err)
+			var written BackupManifest
+			assert.Nil(t, json.Unmarshal(b, &written))
+			assert.Equal(t, manifest.Head, written.Head)
+			assert.Equal(t, manifest.Files, written.Files)
+			last := manifest.Files[len(manifest.Files)-1]
+			assert.Equal(t, Position{FileID: last.FileID, Offset: last.Size}, manifest.Head)
+
+			backup := NewDiskStorage(path.Join(backupDir, "test"), options)
+			defer backup.Close()
+			// the backup has the matching hint files, so it isn't loaded from the datafiles
+			assert.True(t, backup.loadHintFiles())
+
+			// the backup is a point in time, so it only has the first part of the concurrent writes
+			before := false
+			for i := 0; i < 100; i++ {
+				res, err := backup.Get([]byte(strconv.Itoa(i)))
+				if string(res) == "after" {
+					assert.False(t, before, "key %d is written after the backup", i)
+					continue
+				}
+				before = true
+				if i == 0 {
+					assert.ErrorIs(t, err, ErrRecordNotFound)
+				} else {
+					assert.Equal(t, "value", string(res))
+				}
+			}
+		})
+	}
+}
+
+func TestDiskStorage_Backup_hardLink(t *testing.T) {
+	t.Parallel()
+
+	dir := path.Join("testdata", t.Name()+"_"+uuid.NewString())
+	assert.Nil(t, os.MkdirAll(path.Join(dir, "backup"), 0777))
+	defer os.RemoveAll(dir)
+
+	store := NewDiskStorage(path.Join(dir, "test"), NewOptions().SetMaxFileSize("1KB"))
+	defer store.Close()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	manifest, err := store.Backup(path.Join(dir, "backup"))
+	require.Nil(t, err)
+	require.Greater(t, len(manifest.Files), 1)
+
+	// immutable datafiles are linked, while the active file is copied
+	for _, f := range manifest.Files {
+		original, err := os.Stat(fmt.Sprintf("%s/test_%d", dir, f.FileID))
+		require.Nil(t, err)
+		backup, err := os.Stat(fmt.Sprintf("%s/backup/test_%d", dir, f.FileID))
+		require.Nil(t, err)
+		assert.Equal(t, f.FileID != manifest.Head.FileID, os.SameFile(original, backup))
+		assert.Equal(t, f.Size, backup.Size())
+	}
+
+	// merge doesn't affect the backup
+	assert.Nil(t, store.Merge())
+	backup := NewDiskStorage(path.Join(dir, "backup", "test"))
+	defer backup.Close()
+	for i := 0; i < 100; i++ {
+		res, err := backup.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "value", string(res))
+	}
+}
+
+// assertRestored will assert the restored database has the same keys as expected
+func assertRestored(t *testing.T, fs FileSystem, dbPath string, expected map[string]string) {
+	store := NewDiskStorage(dbPath, NewOptions().SetFileSystem(fs))
+	defer store.Close()
+
+	actual := make(map[string]string)
+	assert.Nil(t, store.Iterate(func(key, value []byte) error {
+		actual[string(key)] = string(value)
+		return nil
+	}))
+	assert.Equal(t, expected, actual)
+}
+
+func TestDiskStorage_BackupIncremental(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB"))
+	defer store.Close()
+
+	expected := make(map[string]string)
+	write := func(round int) {
+		for i := 0; i < 30; i++ {
+			key, value := strconv.Itoa(round*10+i), "round"+strconv.Itoa(round)
+			assert.Nil(t, store.Set([]byte(key), []byte(value)))
+			expected[key] = value
+		}
+	}
+	snapshot := func() map[string]string {
+		copied := make(map[string]string, len(expected))
+		for k, v := range expected {
+			copied[k] = v
+		}
+		return copied
+	}
+
+	write(0)
+	full, err := store.Backup("backup/full")
+	require.Nil(t, err)
+	atFull := snapshot()
+
+	write(1)
+	inc1, err := store.BackupIncremental("backup/inc1", full)
+	require.Nil(t, err)
+	atInc1 := snapshot()
+	// unchanged datafiles are not written, the extended one only has the new part
+	for _, f := range inc1.Files {
+		prev, found := full.file(f.FileID)
+		switch {
+		case !found:
+			assert.Equal(t, int64(0), f.Offset)
+		case prev.Size == f.Size:
+			assert.Equal(t, f.Size, f.Offset)
+			assert.Equal(t, prev.Checksum, f.Checksum)
+			_, err = fs.Open(fmt.Sprintf("backup/inc1/test_%d", f.FileID))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		default:
+			assert.Equal(t, prev.Size, f.Offset)
+		}
+	}
+
+	// merge removes and creates datafiles between the backups
+	assert.Nil(t, store.Delete([]byte("0")))
+	delete(expected, "0")
+	assert.Nil(t, store.Merge())
+	write(2)
+	inc2, err := store.BackupIncremental("backup/inc2", inc1)
+	require.Nil(t, err)
+
+	written, err := ReadBackupManifest("backup/inc2/test", NewOptions().SetFileSystem(fs))
+	require.Nil(t, err)
+	assert.Equal(t, inc2.Files, written.Files)
+
+	options := NewOptions().SetFileSystem(fs)
+	assert.Nil(t, Restore("restored/full/test", []string{"backup/full/test"}, options))
+	assertRestored(t, fs, "restored/full/test", atFull)
+	assert.Nil(t, Restore("restored/inc1/test", []string{"backup/full/test", "backup/inc1/test"}, options))
+	assertRestored(t, fs, "restored/inc1/test", atInc1)
+	backups := []string{"backup/full/test", "backup/inc1/test", "backup/inc2/test"}
+	assert.Nil(t, Restore("restored/inc2/test", backups, options))
+	assertRestored(t, fs, "restored/inc2/test", expected)
+
+	assert.ErrorIs(t, Restore("restored/inc2/test", backups, options), errDatabaseExists)
+	// the full backup is required for the datafiles that are extended
+	assert.ErrorIs(t, Restore("restored/missing/test", backups[1:2], options), ErrBackupCorrupted)
+}
+
+func TestRestore_corrupted(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB"))
+	defer store.Close()
+	for i := 0; i < 30; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	full, err := store.Backup("backup/full")
+	require.Nil(t, err)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	inc, err := store.BackupIncremental("backup/inc", full)
+	require.Nil(t, err)
+
+	// the extended part of the active file is corrupted
+	fs.files[fmt.Sprintf("backup/inc/test_%d", inc.Head.FileID)].data[0] ^= 0xff
+
+	options := NewOptions().SetFileSystem(fs)
+	err = Restore("restored/test", []string{"backup/full/test", "backup/inc/test"}, options)
+	assert.ErrorIs(t, err, ErrBackupCorrupted)
+
+	// the restored files are removed
+	names, err := fs.List("restored")
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+}
+
+// cancelFileSystem cancel the context when the file with the prefix is opened,
+// it doesn't implement Linker, so every datafile is copied
+type cancelFileSystem struct {
+	FileSystem
+	prefix string
+	cancel context.CancelFunc
+}
+
+func (fs cancelFileSystem) OpenFile(name string) (File, error) {
+	if strings.HasPrefix(name, fs.prefix) {
+		fs.cancel()
+	}
+	return fs.FileSystem.OpenFile(name)
+}
+
+func TestDiskStorage_BackupContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := cancelFileSystem{FileSystem: NewMemFileSystem(), prefix: "backup/", cancel: cancel}
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB"))
+	defer store.Close()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	// the first datafile is written before the cancellation is noticed, then it is removed
+	_, err := store.BackupContext(ctx, "backup")
+	assert.ErrorIs(t, err, context.Canceled)
+	names, err := fs.List("backup")
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+
+	_, err = store.BackupIncrementalContext(ctx, "backup", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the directory can be used again
+	manifest, err := store.BackupContext(context.Background(), "backup")
+	require.Nil(t, err)
+	assert.Equal(t, store.Stats().FileCount, len(manifest.Files))
+	backup := NewDiskStorage("backup/test", NewOptions().SetFileSystem(fs))
+	defer backup.Close()
+	res, err := backup.Get([]byte("99"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
@@ -0,0 +1,304 @@
+package caskdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const consumersFileExtension = "consumers"
+
+var (
+	ErrConsumerNotFound = errors.New("consumer not found")
+	// ErrInvalidPosition is returned when the change log position
+	// is past the end of its datafile, e.g. the replica is reset
+	ErrInvalidPosition = errors.New("position is past the end of the datafile")
+)
+
+// Change is a mutation read from the change log
+type Change struct {
+	Event
+	// Position is where the change is written
+	Position Position
+	// Next is the position after the change, it is committed once the change is processed
+	Next Position
+}
+
+// ChangeLog read every mutation from the datafiles in the write order, starting
+// from the committed position of the consumer. Unlike Watcher, the changes are
+// read from the datafiles, so the consumer can resume after restart. Entries
+// rewritten by merge are not mutations, so they are skipped
+type ChangeLog struct {
+	store *DiskStorage
+	name  string
+	// position is where the next change is read from, it is not persisted until committed
+	position Position
+}
+
+// Head will return the position after the last written entry,
+// register the consumer from Head to read only the new changes
+func (s *DiskStorage) Head() Position {
+	s.RLock()
+	defer s.RUnlock()
+
+	fileID, file := s.currentFiles()
+	if file == nil {
+		return Position{FileID: fileID}
+	}
+
+	return Position{FileID: fileID, Offset: file.Size()}
+}
+
+// RegisterConsumer will register the consumer that reads the change log from the
+// position, use Position{} to read from the oldest datafile. Merge keeps the datafiles
+// from the committed position of every consumer until the consumer is removed, except
+// on a follower where the datafiles are removed following the primary. Registering
+// existing consumer will move its committed position
+func (s *DiskStorage) RegisterConsumer(name string, from Position) error {
+	s.Lock()
+	defer s.Unlock()
+
+	consumers := s.copyConsumers()
+	consumers[name] = from
+	if err := s.writeConsumers(consumers); err != nil {
+		return err
+	}
+	s.consumers = consumers
+
+	return nil
+}
+
+// RemoveConsumer will unregister the consumer, so its datafiles can be merged
+func (s *DiskStorage) RemoveConsumer(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, found := s.consumers[name]; !found {
+		return ErrConsumerNotFound
+	}
+	consumers := s.copyConsumers()
+	delete(consumers, name)
+	if err := s.writeConsumers(consumers); err != nil {
+		return err
+	}
+	s.consumers = consumers
+
+	return nil
+}
+
+// Consumers will return the committed position of every registered consumer
+func (s *DiskStorage) Consumers() map[string]Position {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.copyConsumers()
+}
+
+// ChangeLog will return the change log of the registered consumer, starting from its committed position
+func (s *DiskStorage) ChangeLog(name string) (*ChangeLog, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	position, found := s.consumers[name]
+	if !found {
+		return nil, ErrConsumerNotFound
+	}
+
+	return &ChangeLog{store: s, name: name, position: position}, nil
+}
+
+// Position will return where the next change is read from
+func (c *ChangeLog) Position() Position {
+	return c.position
+}
+
+// Next will return the changes after the position, waiting until there is any
+// or the context is done. The position is advanced, but it is not committed
+func (c *ChangeLog) Next(ctx context.Context) ([]Change, error) {
+	for {
+		changes, position, changed, err := c.store.readChanges(c.position)
+		if err != nil {
+			return nil, err
+		}
+		c.position = position
+		if len(changes) > 0 {
+			return changes, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Commit will persist the position of the consumer, usually Next of the last
+// processed change. The datafiles before the position can be removed by merge
+func (c *ChangeLog) Commit(p Position) error {
+	s := c.store
+	s.Lock()
+	defer s.Unlock()
+
+	if _, found := s.consumers[c.name]; !found {
+		return ErrConsumerNotFound
+	}
+	consumers := s.copyConsumers()
+	consumers[c.name] = p
+	if err := s.writeConsumers(consumers); err != nil {
+		return err
+	}
+	s.consumers = consumers
+
+	return nil
+}
+
+// readChanges will read the changes after the position, along with the position
+// of the next read. The returned channel is closed on the next change
+func (s *DiskStorage) readChanges(p Position) ([]Change, Position, <-chan struct{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	fileIDs := s.sortedFileIDs()
+	changes := make([]Change, 0)
+	for {
+		p = p.skipHeader()
+		file, found := s.files[p.FileID]
+		if !found {
+			// the file is removed by merge or it is not created yet
+			next, found := nextFileID(fileIDs, p.FileID)
+			if !found {
+				return changes, p, s.changed, nil
+			}
+			p = Position{FileID: next}
+			continue
+		}
+
+		size := file.Size()
+		if p.Offset > size {
+			return nil, p, nil, fmt.Errorf("%w: %s", ErrInvalidPosition, p)
+		}
+		if p.Offset < size {
+			data, err := readEntries(file, p.Offset, size)
+			if err != nil {
+				return nil, p, nil, err
+			}
+			// empty data means the rest of the file is partially written entry
+			partial := len(data) == 0
+			for len(data) > 0 {
+				h := decodeHeader(data)
+				entrySize := int64(defaultHeaderLength + h.keySize + h.valueSize)
+				next := Position{FileID: p.FileID, Offset: p.Offset + entrySize}
+				if !validChecksum(data[:entrySize]) {
+					return nil, p, nil, fmt.Errorf("%w: checksum mismatch at %s", ErrCorrupted, p)
+				}
+				if h.flags&flagMerged == 0 {
+					dataEntry := decodeEntry(data[:entrySize])
+					event, err := s.entryEvent(&dataEntry)
+					if err != nil {
+						return nil, p, nil, err
+					}
+					changes = append(changes, Change{Event: event, Position: p, Next: next})
+				}
+				p = next
+				data = data[entrySize:]
+			}
+			if len(changes) > 0 {
+				return changes, p, s.changed, nil
+			}
+			// every entry read is rewritten by merge, continue after them
+			if !partial {
+				continue
+			}
+		}
+
+		next, found := nextFileID(fileIDs, p.FileID)
+		if !found {
+			return changes, p, s.changed, nil
+		}
+		p = Position{FileID: next}
+	}
+}
+
+// entryEvent will decrypt and decompress the entry into the event
+func (s *DiskStorage) entryEvent(e *entry) (Event, error) {
+	if err := s.openEntry(e); errors.Is(err, errDecryption) {
+		return Event{}, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	} else if err != nil {
+		return Event{}, err
+	}
+
+	if e.header.flags&flagTombstone != 0 {
+		return Event{Type: EventDelete, Key: e.key, Timestamp: e.header.timestamp}, nil
+	}
+	value, err := s.decompress(e.header.codec, e.value)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Type:      EventPut,
+		Key:       e.key,
+		Value:     value,
+		Timestamp: e.header.timestamp,
+		Expiry:    e.header.expiry,
+	}, nil
+}
+
+// consumersPin will return the smallest file id that is needed by the consumers,
+// caller must hold the lock. It returns false if there is no consumer
+func (s *DiskStorage) consumersPin() (int, bool) {
+	pin, found := 0, false
+	for _, position := range s.consumers {
+		if !found || position.FileID < pin {
+			pin, found = position.FileID, true
+		}
+	}
+
+	return pin, found
+}
+
+// copyConsumers caller must hold the lock
+func (s *DiskStorage) copyConsumers() map[string]Position {
+	consumers := make(map[string]Position, len(s.consumers))
+	for name, position := range s.consumers {
+		consumers[name] = position
+	}
+
+	return consumers
+}
+
+// loadConsumers will read the registered consumers, no consumer
+// is registered if the consumers file doesn't exist
+func (s *DiskStorage) loadConsumers() error {
+	b, err := readFile(s.fs, s.consumersFileName())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	consumers := make(map[string]Position)
+	if err = gob.NewDecoder(bytes.NewBuffer(b)).Decode(&consumers); err != nil {
+		return err
+	}
+	s.consumers = consumers
+
+	return nil
+}
+
+func (s *DiskStorage) writeConsumers(consumers map[string]Position) error {
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(consumers); err != nil {
+		return err
+	}
+
+	return writeFile(s.fs, s.consumersFileName(), b.Bytes())
+}
+
+func (s *DiskStorage) consumersFileName() string {
+	return fmt.Sprintf("%s.%s", s.dbFileFullPath, consumersFileExtension)
+}
@@ -0,0 +1,168 @@
+package caskdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllChanges will read the changes until the change log is caught up
+func readAllChanges(t *testing.T, c *ChangeLog) []Change {
+	all := make([]Change, 0)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		changes, err := c.Next(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return all
+		}
+		require.Nil(t, err)
+		all = append(all, changes...)
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+
+	_, err := store.ChangeLog("indexer")
+	assert.ErrorIs(t, err, ErrConsumerNotFound)
+
+	assert.Nil(t, store.Set([]byte("before"), []byte("value")))
+	assert.Nil(t, store.RegisterConsumer("indexer", store.Head()))
+	assert.Nil(t, store.RegisterConsumer("audit", Position{}))
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))))
+	}
+	assert.Nil(t, store.Delete([]byte("0")))
+
+	c, err := store.ChangeLog("indexer")
+	require.Nil(t, err)
+	changes := readAllChanges(t, c)
+	require.Len(t, changes, 51)
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, EventPut, changes[i].Type)
+		assert.Equal(t, strconv.Itoa(i), string(changes[i].Key))
+		assert.Equal(t, "value"+strconv.Itoa(i), string(changes[i].Value))
+		// next change is either right after it, or at the start of the next file
+		if changes[i].Next.FileID == changes[i+1].Position.FileID {
+			assert.Equal(t, changes[i].Next, changes[i+1].Position)
+		} else {
+			assert.Equal(t, Position{FileID: changes[i].Next.FileID + 1, Offset: dataFileHeaderLength}, changes[i+1].Position)
+		}
+	}
+	assert.Equal(t, EventDelete, changes[50].Type)
+	assert.Equal(t, "0", string(changes[50].Key))
+	assert.Equal(t, store.Head(), c.Position())
+
+	// the change log continue from the committed position after restart
+	assert.Nil(t, c.Commit(changes[24].Next))
+	assert.Nil(t, store.Close())
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	assert.Equal(t, map[string]Position{"indexer": changes[24].Next, "audit": {}}, store.Consumers())
+
+	c, err = store.ChangeLog("indexer")
+	require.Nil(t, err)
+	resumed := readAllChanges(t, c)
+	assert.Equal(t, changes[25:], resumed)
+
+	audit, err := store.ChangeLog("audit")
+	require.Nil(t, err)
+	all := readAllChanges(t, audit)
+	require.Len(t, all, 52)
+	assert.Equal(t, "before", string(all[0].Key))
+
+	assert.Nil(t, store.RemoveConsumer("audit"))
+	assert.ErrorIs(t, store.RemoveConsumer("audit"), ErrConsumerNotFound)
+	assert.ErrorIs(t, audit.Commit(Position{}), ErrConsumerNotFound)
+}
+
+func TestChangeLog_Next(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+	assert.Nil(t, store.RegisterConsumer("consumer", store.Head()))
+	c, err := store.ChangeLog("consumer")
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Next is waiting until there is a new change
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, store.SetWithTTL([]byte("key"), []byte("value"), time.Hour))
+	}()
+	changes, err := c.Next(context.Background())
+	require.Nil(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "key", string(changes[0].Key))
+	assert.Equal(t, "value", string(changes[0].Value))
+	assert.NotZero(t, changes[0].Expiry)
+}
+
+func TestChangeLog_merge(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	store := NewDiskStorage("db/test", NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		SetMaxFileSize("1KB").
+		SetEncryptionKey(key))
+	defer store.Close()
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("old")))
+	}
+	assert.Nil(t, store.RegisterConsumer("consumer", store.Head()))
+	store.RLock()
+	pin := store.activeFileID
+	store.RUnlock()
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("new")))
+	}
+
+	// the datafiles needed by the consumer are kept, the entries
+	// rewritten by merge are not read as changes
+	assert.Nil(t, store.Merge())
+	store.RLock()
+	fileIDs := store.sortedFileIDs()
+	store.RUnlock()
+	assert.Equal(t, pin, fileIDs[0])
+	for i := 0; i < 50; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "new", string(res))
+	}
+
+	c, err := store.ChangeLog("consumer")
+	require.Nil(t, err)
+	changes := readAllChanges(t, c)
+	require.Len(t, changes, 50)
+	for i, change := range changes {
+		assert.Equal(t, strconv.Itoa(i), string(change.Key))
+		assert.Equal(t, "new", string(change.Value))
+	}
+
+	// once the consumer is committed, the files before its position can be merged
+	assert.Nil(t, c.Commit(c.Position()))
+	assert.Nil(t, store.Merge())
+	store.RLock()
+	assert.Equal(t, c.Position().FileID, store.sortedFileIDs()[0])
+	assert.Greater(t, c.Position().FileID, pin)
+	store.RUnlock()
+	assert.Empty(t, readAllChanges(t, c))
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Batch queue commands that are sent together in a single round trip by
+// Client.Exec. The commands are not atomic, each of them is applied on its
+// own, and the whole batch is sent again if it fails because of network error
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	cmd   [][]byte
+	parse func(reply interface{}) ([]byte, error)
+	// err is set when the command is invalid, so it is not sent
+	err error
+}
+
+// BatchResult is the result of a single command in the batch,
+// Value is only set for Get
+type BatchResult struct {
+	Value []byte
+	Err   error
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+func (b *Batch) Get(key []byte) *Batch {
+	b.ops = append(b.ops, batchOp{cmd: command("GET", key), parse: parseGet})
+
+	return b
+}
+
+func (b *Batch) Set(key, value []byte) *Batch {
+	b.ops = append(b.ops, batchOp{cmd: command("SET", key, value), parse: parseNoValue(parseOK)})
+
+	return b
+}
+
+func (b *Batch) SetWithTTL(key, value []byte, ttl time.Duration) *Batch {
+	cmd, err := setWithTTLCommand(key, value, ttl)
+	b.ops = append(b.ops, batchOp{cmd: cmd, parse: parseNoValue(parseOK), err: err})
+
+	return b
+}
+
+func (b *Batch) Delete(key []byte) *Batch {
+	b.ops = append(b.ops, batchOp{cmd: command("DEL", key), parse: parseNoValue(parseDelete)})
+
+	return b
+}
+
+// Exec will send every command in the batch and return their results in the
+// same order, error is only returned if the batch can't be sent at all
+func (c *Client) Exec(ctx context.Context, b *Batch) ([]BatchResult, error) {
+	cmds := make([][][]byte, 0, len(b.ops))
+	for _, op := range b.ops {
+		if op.err == nil {
+			cmds = append(cmds, op.cmd)
+		}
+	}
+
+	var replies []interface{}
+	if len(cmds) > 0 {
+		var err error
+		if replies, err = c.do(ctx, cmds); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BatchResult, len(b.ops))
+	for i, op := range b.ops {
+		if op.err != nil {
+			results[i].Err = op.err
+			continue
+		}
+		results[i].Value, results[i].Err = op.parse(replies[0])
+		replies = replies[1:]
+	}
+
+	return results, nil
+}
+
+func parseNoValue(parse func(reply interface{}) error) func(reply interface{}) ([]byte, error) {
+	return func(reply interface{}) ([]byte, error) {
+		return nil, parse(reply)
+	}
+}
@@ -0,0 +1,315 @@
+// Package client is a Go client of caskdb-server using the redis protocol
+// (RESP). Client implements caskdb.Store along with the Context variants of
+// its methods, so the application using caskdb.Store can switch between
+// embedded and remote database. The methods of caskdb.DiskStorage outside
+// caskdb.Store, e.g. Stats, GetRecord or Merge, are not supported
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/resp"
+)
+
+var (
+	// ErrClientClosed is returned when the client is used after Close
+	ErrClientClosed = errors.New("client: closed")
+	errInvalidTTL   = errors.New("ttl must be positive")
+)
+
+var _ caskdb.Store = (*Client)(nil)
+
+// Client is safe for concurrent use, every command takes a connection
+// from the pool and returns it once the reply is read
+type Client struct {
+	addr    string
+	options *Options
+	pool    *pool
+}
+
+// New will return client of the server at addr, connection is only
+// dialed once it is needed
+func New(addr string, options ...*Options) *Client {
+	c := &Client{
+		addr:    addr,
+		options: NewOptions(),
+	}
+	for _, o := range options {
+		c.options = o
+	}
+	c.pool = newPool(c.options.poolSize, c.dial)
+
+	return c
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.options.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{Conn: netConn, r: resp.NewReader(netConn), w: resp.NewWriter(netConn)}, nil
+}
+
+func (c *Client) Get(key []byte) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext will return caskdb.ErrRecordNotFound if the key doesn't exist
+func (c *Client) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	reply, err := c.doOne(ctx, command("GET", key))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGet(reply)
+}
+
+func (c *Client) Set(key, value []byte) error {
+	return c.SetContext(context.Background(), key, value)
+}
+
+func (c *Client) SetContext(ctx context.Context, key, value []byte) error {
+	reply, err := c.doOne(ctx, command("SET", key, value))
+	if err != nil {
+		return err
+	}
+
+	return parseOK(reply)
+}
+
+func (c *Client) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return c.SetWithTTLContext(context.Background(), key, value, ttl)
+}
+
+// SetWithTTLContext will set the key that is expired after the ttl,
+// the ttl is rounded up to milliseconds
+func (c *Client) SetWithTTLContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	cmd, err := setWithTTLCommand(key, value, ttl)
+	if err != nil {
+		return err
+	}
+	reply, err := c.doOne(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	return parseOK(reply)
+}
+
+func (c *Client) Delete(key []byte) error {
+	return c.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will return caskdb.ErrRecordNotFound if the key doesn't exist.
+// Note that it is also returned if the key is deleted by the previous attempt
+// that is retried because the reply is lost
+func (c *Client) DeleteContext(ctx context.Context, key []byte) error {
+	reply, err := c.doOne(ctx, command("DEL", key))
+	if err != nil {
+		return err
+	}
+
+	return parseDelete(reply)
+}
+
+func (c *Client) Iterate(fn func(key, value []byte) error) error {
+	return c.IterateContext(context.Background(), fn)
+}
+
+// IterateContext will call fn for every key in ascending order, the value
+// is read right before fn is called, so key that is deleted is skipped
+func (c *Client) IterateContext(ctx context.Context, fn func(key, value []byte) error) error {
+	return c.IterateKeysContext(ctx, func(key []byte) error {
+		value, err := c.GetContext(ctx, key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return fn(key, value)
+	})
+}
+
+func (c *Client) IterateKeys(fn func(key []byte) error) error {
+	return c.IterateKeysContext(context.Background(), fn)
+}
+
+// IterateKeysContext will read every key at once, the same as DiskStorage
+// that keeps every key in memory, then call fn in ascending order
+func (c *Client) IterateKeysContext(ctx context.Context, fn func(key []byte) error) error {
+	reply, err := c.doOne(ctx, command("KEYS", []byte("*")))
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeys(reply)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = fn(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close will close every connection, command that is in progress is not interrupted
+func (c *Client) Close() error {
+	return c.pool.close()
+}
+
+func (c *Client) doOne(ctx context.Context, cmd [][]byte) (interface{}, error) {
+	replies, err := c.do(ctx, [][][]byte{cmd})
+	if err != nil {
+		return nil, err
+	}
+
+	return replies[0], nil
+}
+
+// do will send the commands in a single round trip and return their replies,
+// every command is sent again if it fails because of network error
+func (c *Client) do(ctx context.Context, cmds [][][]byte) ([]interface{}, error) {
+	var err error
+	for attempt := 0; attempt <= c.options.maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		var replies []interface{}
+		replies, err = c.roundTrip(ctx, cmds)
+		if err == nil {
+			return replies, nil
+		}
+		if errors.Is(err, ErrClientClosed) || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, cmds [][][]byte) ([]interface{}, error) {
+	cn, err := c.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := cn.watch(ctx)
+	replies, err := cn.roundTrip(ctx, cmds, c.options.readTimeout, c.options.writeTimeout)
+	stop()
+
+	// connection with unread reply can't be reused
+	c.pool.put(cn, err != nil)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return replies, err
+}
+
+// backoff will return the delay before the attempt, it is doubled on every attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.options.minRetryBackoff
+	for i := 1; i < attempt && backoff < c.options.maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.options.maxRetryBackoff {
+		backoff = c.options.maxRetryBackoff
+	}
+
+	return backoff
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func command(name string, args ...[]byte) [][]byte {
+	return append([][]byte{[]byte(name)}, args...)
+}
+
+func setWithTTLCommand(key, value []byte, ttl time.Duration) ([][]byte, error) {
+	if ttl <= 0 {
+		return nil, errInvalidTTL
+	}
+	milliseconds := (ttl + time.Millisecond - 1) / time.Millisecond
+
+	return command("SET", key, value, []byte("PX"), []byte(strconv.FormatInt(int64(milliseconds), 10))), nil
+}
+
+func parseGet(reply interface{}) ([]byte, error) {
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case nil:
+		return nil, caskdb.ErrRecordNotFound
+	default:
+		return nil, unexpectedReply(reply)
+	}
+}
+
+func parseOK(reply interface{}) error {
+	if reply != "OK" {
+		return unexpectedReply(reply)
+	}
+
+	return nil
+}
+
+func parseDelete(reply interface{}) error {
+	switch reply {
+	case int64(1):
+		return nil
+	case int64(0):
+		return caskdb.ErrRecordNotFound
+	default:
+		return unexpectedReply(reply)
+	}
+}
+
+func parseKeys(reply interface{}) ([][]byte, error) {
+	array, ok := reply.([]interface{})
+	if !ok {
+		return nil, unexpectedReply(reply)
+	}
+
+	keys := make([][]byte, len(array))
+	for i, v := range array {
+		if keys[i], ok = v.([]byte); !ok {
+			return nil, unexpectedReply(v)
+		}
+	}
+
+	return keys, nil
+}
+
+// unexpectedReply will return error replied by the server as is
+func unexpectedReply(reply interface{}) error {
+	if err, ok := reply.(resp.Error); ok {
+		return err
+	}
+
+	return fmt.Errorf("client: unexpected reply %v", reply)
+}
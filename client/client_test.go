@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/resp"
+	"github.com/luqmansen/go-caskdb/storetest"
+)
+
+// newTestServer will start resp server on top of new DiskStorage and return its address
+func newTestServer(t *testing.T) (*resp.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	return startServer(t, l), l.Addr().String()
+}
+
+func startServer(t *testing.T, l net.Listener) *resp.Server {
+	store := caskdb.NewDiskStorage("db/test", caskdb.NewOptions().SetFileSystem(caskdb.NewMemFileSystem()))
+	server := resp.NewServer(store)
+	go server.Serve(l)
+
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+		assert.Nil(t, store.Close())
+	})
+
+	return server
+}
+
+func TestClient_conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) caskdb.Store {
+		_, addr := newTestServer(t)
+		return New(addr)
+	})
+}
+
+func TestClient_Exec(t *testing.T) {
+	t.Parallel()
+
+	_, addr := newTestServer(t)
+	client := New(addr)
+	defer client.Close()
+
+	batch := NewBatch().
+		Set([]byte("a"), []byte("1")).
+		SetWithTTL([]byte("b"), []byte("2"), time.Hour).
+		SetWithTTL([]byte("c"), []byte("3"), 0).
+		Get([]byte("a")).
+		Get([]byte("c")).
+		Delete([]byte("a")).
+		Delete([]byte("a"))
+	assert.Equal(t, 7, batch.Len())
+
+	results, err := client.Exec(context.Background(), batch)
+	require.Nil(t, err)
+	assert.Equal(t, []BatchResult{
+		{},
+		{},
+		{Err: errInvalidTTL},
+		{Value: []byte("1")},
+		{Err: caskdb.ErrRecordNotFound},
+		{},
+		{Err: caskdb.ErrRecordNotFound},
+	}, results)
+
+	res, err := client.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(res))
+
+	results, err = client.Exec(context.Background(), NewBatch())
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+}
+
+func TestClient_retry(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	server := startServer(t, l)
+
+	client := New(addr, NewOptions().SetPoolSize(1).SetRetries(3, time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+	noRetry := New(addr, NewOptions().SetPoolSize(1).SetRetries(0, 0, 0))
+	defer noRetry.Close()
+
+	assert.Nil(t, client.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, noRetry.Set([]byte("key"), []byte("value")))
+
+	// pooled connections are closed by the restarted server
+	assert.Nil(t, server.Close())
+	l, err = net.Listen("tcp", addr)
+	require.Nil(t, err)
+	startServer(t, l)
+
+	_, err = client.Get([]byte("key"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+
+	_, err = noRetry.Get([]byte("key"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, caskdb.ErrRecordNotFound)
+	// broken connection is discarded
+	_, err = noRetry.Get([]byte("key"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+}
+
+// newSilentServer will accept connections but never reply
+func newSilentServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	var mu sync.Mutex
+	conns := make([]net.Conn, 0)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		mu.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+	})
+
+	return l.Addr().String()
+}
+
+func TestClient_timeout(t *testing.T) {
+	t.Parallel()
+
+	addr := newSilentServer(t)
+
+	client := New(addr, NewOptions().
+		SetTimeouts(time.Second, 50*time.Millisecond, time.Second).
+		SetRetries(0, 0, 0))
+	defer client.Close()
+
+	start := time.Now()
+	_, err := client.Get([]byte("key"))
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+	assert.Less(t, time.Since(start), time.Second)
+
+	// context is used when it is done earlier than the timeout
+	client = New(addr, NewOptions().SetTimeouts(0, 0, 0))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.GetContext(ctx, []byte("key"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	assert.ErrorIs(t, client.SetContext(ctx, []byte("key"), []byte("value")), context.Canceled)
+}
+
+func TestClient_pool(t *testing.T) {
+	t.Parallel()
+
+	_, addr := newTestServer(t)
+	client := New(addr, NewOptions().SetPoolSize(2))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := []byte(strconv.Itoa(g) + "-" + strconv.Itoa(i))
+				assert.Nil(t, client.Set(key, key))
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, len(client.pool.idle), 2)
+
+	// waiting for idle connection respect the context
+	held := make([]*conn, 0, 2)
+	for i := 0; i < 2; i++ {
+		cn, err := client.pool.get(context.Background())
+		require.Nil(t, err)
+		held = append(held, cn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetContext(ctx, []byte("0-0"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	for _, cn := range held {
+		client.pool.put(cn, false)
+	}
+
+	assert.Nil(t, client.Close())
+	_, err = client.Get([]byte("0-0"))
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
@@ -0,0 +1,70 @@
+package client
+
+import "time"
+
+const (
+	defaultPoolSize        = 10
+	defaultDialTimeout     = 5 * time.Second
+	defaultReadTimeout     = 3 * time.Second
+	defaultWriteTimeout    = 3 * time.Second
+	defaultMaxRetries      = 3
+	defaultMinRetryBackoff = 8 * time.Millisecond
+	defaultMaxRetryBackoff = 512 * time.Millisecond
+)
+
+type Options struct {
+	poolSize int
+
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	maxRetries      int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+}
+
+func NewOptions() *Options {
+	return &Options{
+		poolSize:        defaultPoolSize,
+		dialTimeout:     defaultDialTimeout,
+		readTimeout:     defaultReadTimeout,
+		writeTimeout:    defaultWriteTimeout,
+		maxRetries:      defaultMaxRetries,
+		minRetryBackoff: defaultMinRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+	}
+}
+
+// SetPoolSize is the maximum number of open connections, command
+// waits for idle connection once the limit is reached
+func (o *Options) SetPoolSize(size int) *Options {
+	if size < 1 {
+		panic("pool size must be positive")
+	}
+	o.poolSize = size
+
+	return o
+}
+
+// SetTimeouts set the timeout of dialing new connection, reading the reply and
+// writing the command, 0 means no timeout. Deadline of the context passed to
+// the command is used instead if it is earlier
+func (o *Options) SetTimeouts(dial, read, write time.Duration) *Options {
+	o.dialTimeout = dial
+	o.readTimeout = read
+	o.writeTimeout = write
+
+	return o
+}
+
+// SetRetries set how many times the command is retried on network error, the
+// backoff between retries is doubled from minBackoff up to maxBackoff.
+// Error replied by the server is never retried
+func (o *Options) SetRetries(maxRetries int, minBackoff, maxBackoff time.Duration) *Options {
+	o.maxRetries = maxRetries
+	o.minRetryBackoff = minBackoff
+	o.maxRetryBackoff = maxBackoff
+
+	return o
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/luqmansen/go-caskdb/resp"
+)
+
+type conn struct {
+	net.Conn
+	r *resp.Reader
+	w *resp.Writer
+}
+
+// roundTrip will write every command at once, then read a reply for each of them
+func (cn *conn) roundTrip(ctx context.Context, cmds [][][]byte, readTimeout, writeTimeout time.Duration) ([]interface{}, error) {
+	if err := cn.SetWriteDeadline(deadline(ctx, writeTimeout)); err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		cn.w.WriteCommand(cmd...)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := cn.SetReadDeadline(deadline(ctx, readTimeout)); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		reply, err := cn.r.ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+
+	return replies, nil
+}
+
+// watch will interrupt the pending read and write once the context is done,
+// the returned function must be called once the connection is no longer used
+func (cn *conn) watch(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			cn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// deadline will return the earlier of the timeout and the context deadline,
+// zero time means no deadline
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (t.IsZero() || d.Before(t)) {
+		t = d
+	}
+
+	return t
+}
+
+// pool limit the number of open connections and keep the idle ones for reuse
+type pool struct {
+	dial func(ctx context.Context) (*conn, error)
+	// open hold a token for every open connection
+	open chan struct{}
+	idle chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPool(size int, dial func(ctx context.Context) (*conn, error)) *pool {
+	return &pool{
+		dial: dial,
+		open: make(chan struct{}, size),
+		idle: make(chan *conn, size),
+	}
+}
+
+// get will return idle connection, or dial a new one if the pool is not full
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+
+	select {
+	case cn := <-p.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-p.idle:
+		return cn, nil
+	case p.open <- struct{}{}:
+		cn, err := p.dial(ctx)
+		if err != nil {
+			<-p.open
+			return nil, err
+		}
+		return cn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put will return the connection to the pool, broken connection is closed
+func (p *pool) put(cn *conn, broken bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if broken || p.closed {
+		cn.Close()
+		<-p.open
+		return
+	}
+	p.idle <- cn
+}
+
+// close will close every idle connection, connection that is in use
+// is closed once it is returned to the pool
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for {
+		select {
+		case cn := <-p.idle:
+			cn.Close()
+			<-p.open
+		default:
+			return nil
+		}
+	}
+}
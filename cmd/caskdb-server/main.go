@@ -0,0 +1,192 @@
+// Command caskdb-server serves a caskdb database over the network
+// using the redis protocol (RESP) or the memcached text protocol,
+// and optionally HTTP/JSON REST API. The database can be replicated
+// to followers, follower is promoted using REPLICAOF NO ONE or by
+// sending SIGUSR1 to the process (except on windows)
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/httpapi"
+	"github.com/luqmansen/go-caskdb/memcache"
+	"github.com/luqmansen/go-caskdb/metrics"
+	"github.com/luqmansen/go-caskdb/resp"
+	"go.uber.org/zap"
+)
+
+// server is implemented by resp.Server and memcache.Server
+type server interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+func main() {
+	protocol := flag.String("protocol", "resp", "protocol to serve, either resp or memcache")
+	addr := flag.String("addr", "", "address to listen on (default \":6379\" for resp, \":11211\" for memcache)")
+	httpAddr := flag.String("http-addr", "", "address of the HTTP API to listen on, disabled if empty")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve the Prometheus metrics on at /metrics, disabled if empty")
+	dbPath := flag.String("db", "data/caskdb", "path of the database files, without the file id suffix")
+	maxFileSize := flag.String("max-file-size", "100MB", "maximum size of single datafile, e.g. 512KB, 100MB, 1GB")
+	syncWrites := flag.Bool("sync", false, "sync the datafile after every write")
+	replicationAddr := flag.String("replication-addr", "", "address to serve the followers on, disabled if empty")
+	logLevel := flag.String("log-level", "error", "minimum level of the database logs, either debug, info, warn or error")
+	replicateFrom := flag.String("replicate-from", "", "replication address of the primary to follow, the database is read-only until it is promoted")
+	flag.Parse()
+
+	defaultAddrs := map[string]string{"resp": ":6379", "memcache": ":11211"}
+	if _, found := defaultAddrs[*protocol]; !found {
+		log.Fatalf("unknown protocol %q", *protocol)
+	}
+	if *addr == "" {
+		*addr = defaultAddrs[*protocol]
+	}
+	// memcache stores the client flags as the prefix of the value, which
+	// would be returned as part of the value by the HTTP API
+	if *protocol == "memcache" && *httpAddr != "" {
+		log.Fatal("-http-addr can't be used with -protocol memcache")
+	}
+
+	if dir, _ := path.Split(*dbPath); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	level, err := zap.ParseAtomicLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logConfig := zap.NewProductionConfig()
+	logConfig.Level = level
+	logger, err := logConfig.Build()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logger.Sync()
+
+	options := caskdb.NewOptions().
+		SetMaxFileSize(*maxFileSize).
+		SetSyncWrites(*syncWrites).
+		SetLogger(caskdb.NewZapLogger(logger))
+	var collector *metrics.Collector
+	if *metricsAddr != "" {
+		collector = metrics.NewCollector()
+		options.SetObserver(collector)
+	}
+	store := caskdb.NewDiskStorage(*dbPath, options)
+
+	repl := &replication{primaryAddr: *replicateFrom}
+	if *replicationAddr != "" {
+		repl.server = caskdb.NewReplicationServer(store)
+		go func() {
+			log.Printf("replication listening on %s", *replicationAddr)
+			err := repl.server.ListenAndServe(*replicationAddr)
+			if err != nil && !errors.Is(err, caskdb.ErrReplicationServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if *replicateFrom != "" {
+		log.Printf("replicating from %s", *replicateFrom)
+		repl.follower = caskdb.NewFollower(store, *replicateFrom)
+	}
+
+	var server server
+	if *protocol == "memcache" {
+		server = memcache.NewServer(store)
+	} else {
+		respServer := resp.NewServer(store)
+		repl.register(respServer)
+		server = respServer
+	}
+
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		httpServer = &http.Server{Addr: *httpAddr, Handler: httpapi.NewHandler(store)}
+		go func() {
+			log.Printf("http listening on %s", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	var metricsServer *http.Server
+	if collector != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", collector.Handler(store))
+		metricsServer = &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			log.Printf("metrics listening on %s", *metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// shutdown is called by the signal handler, and by main once the server is stopped, the
+	// replication must be stopped before the store is closed, since it is still writing to it
+	var shutdownOnce sync.Once
+	shutdown := func() {
+		shutdownOnce.Do(func() {
+			log.Println("shutting down")
+			for _, s := range []*http.Server{httpServer, metricsServer} {
+				if s == nil {
+					continue
+				}
+				if err := s.Close(); err != nil {
+					log.Println(err)
+				}
+			}
+			if err := server.Close(); err != nil {
+				log.Println(err)
+			}
+			if err := repl.close(); err != nil {
+				log.Println(err)
+			}
+		})
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		if promoteSignal != nil {
+			signal.Notify(signals, promoteSignal)
+		}
+		for sig := range signals {
+			// the follower served using memcache can't be promoted using REPLICAOF
+			if sig == promoteSignal {
+				if err := repl.promote(); err != nil {
+					log.Println(err)
+				} else {
+					log.Println("promoted to primary")
+				}
+				continue
+			}
+			shutdown()
+			return
+		}
+	}()
+
+	log.Printf("%s listening on %s", *protocol, *addr)
+	err = server.ListenAndServe(*addr)
+	if err != nil && !errors.Is(err, resp.ErrServerClosed) && !errors.Is(err, memcache.ErrServerClosed) {
+		log.Println(err)
+	}
+	// waits for the shutdown started by the signal handler to finish
+	shutdown()
+
+	if err := store.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
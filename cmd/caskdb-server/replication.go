@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/resp"
+)
+
+// replication hold the replication role of the server, it can be
+// either primary or follower until the follower is promoted
+type replication struct {
+	// server is nil if the followers are not served
+	server *caskdb.ReplicationServer
+
+	mu          sync.Mutex
+	follower    *caskdb.Follower
+	primaryAddr string
+}
+
+// register will add REPLICAOF NO ONE to promote the follower,
+// and INFO [replication] to report the replication state
+func (r *replication) register(server *resp.Server) {
+	server.Register("replicaof", 3, 3, r.replicaOf)
+	server.Register("info", 1, 2, r.info)
+}
+
+func (r *replication) replicaOf(_ caskdb.Store, w *resp.Writer, args [][]byte) error {
+	if !strings.EqualFold(string(args[0]), "no") || !strings.EqualFold(string(args[1]), "one") {
+		return resp.Error("ERR only REPLICAOF NO ONE is supported, use -replicate-from to follow a primary")
+	}
+
+	if err := r.promote(); err != nil {
+		return err
+	}
+
+	w.WriteSimpleString("OK")
+	return nil
+}
+
+// promote will make the follower writable, it does nothing on primary
+func (r *replication) promote() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.follower == nil {
+		return nil
+	}
+	if err := r.follower.Promote(); err != nil {
+		return err
+	}
+	r.follower = nil
+
+	return nil
+}
+
+func (r *replication) info(_ caskdb.Store, w *resp.Writer, args [][]byte) error {
+	if len(args) == 1 && !strings.EqualFold(string(args[0]), "replication") {
+		w.WriteBulk([]byte{})
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# Replication\r\n")
+
+	r.mu.Lock()
+	follower := r.follower
+	r.mu.Unlock()
+	if follower != nil {
+		status := follower.Status()
+		link := "down"
+		if status.Connected {
+			link = "up"
+		}
+		b.WriteString("role:follower\r\n")
+		fmt.Fprintf(&b, "primary_addr:%s\r\n", r.primaryAddr)
+		fmt.Fprintf(&b, "primary_link_status:%s\r\n", link)
+		fmt.Fprintf(&b, "position:%s\r\n", status.Position)
+		fmt.Fprintf(&b, "lag_bytes:%d\r\n", status.Lag)
+		if !status.LastContact.IsZero() {
+			fmt.Fprintf(&b, "last_contact_seconds:%d\r\n", int64(time.Since(status.LastContact).Seconds()))
+		}
+	} else {
+		b.WriteString("role:primary\r\n")
+		var replicas []caskdb.ReplicaStatus
+		if r.server != nil {
+			replicas = r.server.Replicas()
+		}
+		fmt.Fprintf(&b, "connected_followers:%d\r\n", len(replicas))
+		for i, replica := range replicas {
+			fmt.Fprintf(&b, "follower%d:addr=%s,position=%s,lag_bytes=%d\r\n", i, replica.Addr, replica.Position, replica.Lag)
+		}
+	}
+
+	w.WriteBulk([]byte(b.String()))
+	return nil
+}
+
+// close will stop the replication, the follower is not promoted
+func (r *replication) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.follower != nil {
+		if err := r.follower.Close(); err != nil {
+			return err
+		}
+	}
+	if r.server != nil {
+		return r.server.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// promoteSignal promotes the follower, e.g. kill -USR1 <pid>
+var promoteSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// promoteSignal is nil, since windows doesn't have SIGUSR1,
+// the follower can only be promoted using REPLICAOF NO ONE
+var promoteSignal os.Signal
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+func get(store *caskdb.DiskStorage, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	value, err := store.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", value)
+
+	return err
+}
+
+func set(store *caskdb.DiskStorage, args []string) error {
+	flags := flag.NewFlagSet("set", flag.ContinueOnError)
+	ttl := flags.Duration("ttl", 0, "expire the key after the duration, e.g. 10m, 24h")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return errUsage
+	}
+
+	key := []byte(flags.Arg(0))
+	var value []byte
+	if flags.NArg() == 2 {
+		value = []byte(flags.Arg(1))
+	} else {
+		var err error
+		if value, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	if *ttl != 0 {
+		return store.SetWithTTL(key, value, *ttl)
+	}
+
+	return store.Set(key, value)
+}
+
+func del(store *caskdb.DiskStorage, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	return store.Delete([]byte(args[0]))
+}
+
+func scan(store *caskdb.DiskStorage, args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "only print the keys with the prefix")
+	values := flags.Bool("values", false, "print the value after the key, separated by tab")
+	limit := flags.Int("limit", 0, "maximum number of keys to print, 0 means no limit")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	count := 0
+	err := store.IterateKeys(func(key []byte) error {
+		if !bytes.HasPrefix(key, []byte(*prefix)) {
+			return nil
+		}
+		if *limit > 0 && count == *limit {
+			return errStopScan
+		}
+		count++
+
+		if !*values {
+			_, err := fmt.Fprintf(w, "%s\n", key)
+			return err
+		}
+		value, err := store.Get(key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			// the key is expired after it is listed
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\t%s\n", key, value)
+		return err
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return err
+	}
+
+	return w.Flush()
+}
+
+var errStopScan = errors.New("scan limit is reached")
+
+func stats(store *caskdb.DiskStorage, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	b, err := json.MarshalIndent(store.Stats(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+
+	return err
+}
+
+func merge(store *caskdb.DiskStorage, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	before := store.Stats()
+	if err := store.Merge(); err != nil {
+		return err
+	}
+	after := store.Stats()
+	fmt.Printf("datafiles: %d -> %d, size: %d -> %d bytes\n", before.FileCount, after.FileCount, before.TotalSize, after.TotalSize)
+
+	return nil
+}
+
+func verify(dbPath string, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := checkDatabase(dbPath, false); err != nil {
+		return err
+	}
+
+	report, err := caskdb.Verify(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range report.Files {
+		fmt.Printf("datafile %d: %d bytes, %d entries\n", f.FileID, f.Size, f.Entries)
+		for _, r := range f.Corrupted {
+			fmt.Printf("  corrupted %d-%d (%d bytes): %s\n", r.Start, r.End, r.End-r.Start, r.Reason)
+		}
+	}
+
+	hint := report.Hint
+	switch {
+	case !hint.Exists:
+		fmt.Println("hint files: not found")
+	case hint.Err != "":
+		fmt.Printf("hint files: %s\n", hint.Err)
+	default:
+		stale := ""
+		if hint.Stale {
+			stale = ", stale and ignored when the database is opened"
+		}
+		fmt.Printf("hint files: %d keys%s\n", hint.Keys, stale)
+		for _, k := range hint.Orphaned {
+			fmt.Printf("  orphaned %q at datafile %d offset %d: %s\n", k.Key, k.FileID, k.Offset, k.Reason)
+		}
+		for _, k := range hint.PastEnd {
+			fmt.Printf("  past end %q at datafile %d offset %d length %d\n", k.Key, k.FileID, k.Offset, k.Length)
+		}
+	}
+
+	if !report.OK() {
+		return errors.New("database is corrupted")
+	}
+
+	return nil
+}
+
+func repair(dbPath string, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := checkDatabase(dbPath, false); err != nil {
+		return err
+	}
+
+	report, err := caskdb.Repair(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range report.Files {
+		fmt.Printf("datafile %d: %d entries salvaged\n", f.FileID, f.Entries)
+		for _, r := range f.Corrupted {
+			fmt.Printf("  skipped %d-%d (%d bytes): %s\n", r.Start, r.End, r.End-r.Start, r.Reason)
+		}
+	}
+	for _, name := range report.Quarantined {
+		fmt.Printf("quarantined %s\n", name)
+	}
+	fmt.Printf("%d keys in datafiles %v\n", report.KeyCount, report.FileIDs)
+
+	return nil
+}
+
+func inspect(_ string, args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print every entry as JSON Lines, the key and value are base64 encoded")
+	previewSize := flags.Int("preview", 32, "maximum bytes of the key and value to print, 0 means no limit")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	var tw *tabwriter.Writer
+	var encoder *json.Encoder
+	if *asJSON {
+		encoder = json.NewEncoder(w)
+	} else {
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "OFFSET\tSIZE\tTIMESTAMP\tEXPIRY\tKEY SIZE\tVALUE SIZE\tCODEC\tFLAGS\tCHECKSUM\tKEY\tVALUE")
+	}
+
+	err := caskdb.InspectDataFile(flags.Arg(0), func(record caskdb.DataFileRecord) error {
+		record.Key, record.Value = truncate(record.Key, *previewSize), truncate(record.Value, *previewSize)
+		if *asJSON {
+			return encoder.Encode(record)
+		}
+
+		checksum := "ok"
+		switch {
+		case record.Truncated:
+			checksum = "truncated"
+		case !record.ChecksumOK:
+			checksum = "mismatch"
+		}
+		expiry := "-"
+		if record.Expiry != 0 {
+			expiry = formatTimestamp(record.Expiry)
+		}
+		flagNames := strings.Join(record.Flags, ",")
+		if flagNames == "" {
+			flagNames = "-"
+		}
+		_, err := fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%s\t%08x %s\t%s\t%s\n",
+			record.Offset, record.Size, formatTimestamp(record.Timestamp), expiry,
+			record.KeySize, record.ValueSize, record.Codec, flagNames, record.Checksum, checksum,
+			preview(record.Key, record.KeySize), preview(record.Value, record.ValueSize))
+		return err
+	})
+	if tw != nil {
+		if flushErr := tw.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+
+	return err
+}
+
+// truncate will return the first n bytes of b, or b if n is 0
+func truncate(b []byte, n int) []byte {
+	if n > 0 && len(b) > n {
+		return b[:n]
+	}
+
+	return b
+}
+
+// preview will quote the truncated data, followed by ... if it is shorter than size
+func preview(b []byte, size uint64) string {
+	quoted := strconv.Quote(string(b))
+	if uint64(len(b)) < size {
+		quoted += "..."
+	}
+
+	return quoted
+}
+
+func formatTimestamp(unixNano int64) string {
+	return time.Unix(0, unixNano).UTC().Format(time.RFC3339Nano)
+}
+
+func export(store *caskdb.DiskStorage, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 0 {
+		return store.Export(os.Stdout)
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err = store.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func importRecords(store *caskdb.DiskStorage, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 0 {
+		return store.Import(os.Stdin)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return store.Import(f)
+}
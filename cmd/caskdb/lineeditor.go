@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when Ctrl-C is pressed
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor read a line from the terminal with history and tab completion,
+// it supports the usual emacs keys and the arrow keys
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+
+	history []string
+	// historyFile is where the history is kept between sessions, empty to disable
+	historyFile string
+	// complete will return the candidates to replace the word before the cursor
+	complete func(line []rune, pos int) (candidates []string, start int)
+}
+
+func newLineEditor(in *os.File, out io.Writer, historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, fd: int(in.Fd()), historyFile: historyFile}
+	if historyFile != "" {
+		if b, err := os.ReadFile(historyFile); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if line != "" {
+					e.history = append(e.history, line)
+				}
+			}
+		}
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+	}
+
+	return e
+}
+
+// addHistory will append the line to the history and the history file
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	// history is best effort, the shell works without it
+	f, err := os.OpenFile(e.historyFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// readLine will show the prompt and read a line. io.EOF is returned when
+// Ctrl-D is pressed on empty line, errInterrupted when Ctrl-C is pressed
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line []rune
+	pos := 0
+	// historyPos is the history entry being shown, len(history) is the new line
+	historyPos := len(e.history)
+	pending := ""
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	showHistory := func(i int) {
+		if historyPos == len(e.history) {
+			pending = string(line)
+		}
+		historyPos = i
+		if i == len(e.history) {
+			line = []rune(pending)
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+		redraw()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\n")
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+				redraw()
+			}
+		case 127, 8: // backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+				redraw()
+			}
+		case 1: // Ctrl-A
+			pos = 0
+			redraw()
+		case 5: // Ctrl-E
+			pos = len(line)
+			redraw()
+		case 21: // Ctrl-U
+			line = line[pos:]
+			pos = 0
+			redraw()
+		case 11: // Ctrl-K
+			line = line[:pos]
+			redraw()
+		case 16: // Ctrl-P
+			if historyPos > 0 {
+				showHistory(historyPos - 1)
+			}
+		case 14: // Ctrl-N
+			if historyPos < len(e.history) {
+				showHistory(historyPos + 1)
+			}
+		case '\t':
+			line, pos = e.completeLine(prompt, line, pos)
+			redraw()
+		case 27: // escape sequence of the arrow keys
+			key := e.readEscape()
+			switch key {
+			case "A":
+				if historyPos > 0 {
+					showHistory(historyPos - 1)
+				}
+			case "B":
+				if historyPos < len(e.history) {
+					showHistory(historyPos + 1)
+				}
+			case "C":
+				if pos < len(line) {
+					pos++
+					redraw()
+				}
+			case "D":
+				if pos > 0 {
+					pos--
+					redraw()
+				}
+			case "H", "1~":
+				pos = 0
+				redraw()
+			case "F", "4~":
+				pos = len(line)
+				redraw()
+			case "3~":
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+					redraw()
+				}
+			}
+		default:
+			if !unicode.IsPrint(r) {
+				continue
+			}
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+			redraw()
+		}
+	}
+}
+
+// readEscape will read the rest of "ESC [ ..." sequence, and return the part after "["
+func (e *lineEditor) readEscape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+
+	var seq strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq.WriteRune(r)
+		// the sequence ends with a letter or ~
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || r == '~' {
+			return seq.String()
+		}
+	}
+}
+
+// completeLine will replace the word before the cursor with the only candidate or their
+// common prefix, every candidate is printed if there are more than one
+func (e *lineEditor) completeLine(prompt string, line []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return line, pos
+	}
+	candidates, start := e.complete(line, pos)
+	if len(candidates) == 0 {
+		return line, pos
+	}
+
+	replacement := candidates[0]
+	if len(candidates) == 1 {
+		replacement += " "
+	} else {
+		for _, c := range candidates[1:] {
+			for !strings.HasPrefix(c, replacement) {
+				replacement = replacement[:len(replacement)-1]
+			}
+		}
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+
+	completed := append(append([]rune{}, line[:start]...), []rune(replacement)...)
+	newPos := len(completed)
+	completed = append(completed, line[pos:]...)
+
+	return completed, newPos
+}
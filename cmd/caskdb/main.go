@@ -0,0 +1,211 @@
+// Command caskdb operates on a caskdb database directly, the
+// database must not be opened by other process at the same time
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(store *caskdb.DiskStorage, args []string) error
+	// create is set for the command that writes new records, it creates the
+	// database if it doesn't exist, every other command requires existing database
+	create bool
+	// open is used instead of run by the command that opens the database itself
+	open func(dbPath string, args []string) error
+}
+
+var commands = map[string]command{
+	"get": {
+		usage:       "get <key>",
+		description: "print the value of the key",
+		run:         get,
+	},
+	"set": {
+		usage:       "set [--ttl duration] <key> [value]",
+		description: "set the value of the key, the value is read from stdin if it is omitted",
+		run:         set,
+		create:      true,
+	},
+	"del": {
+		usage:       "del <key>",
+		description: "delete the key",
+		run:         del,
+	},
+	"scan": {
+		usage:       "scan [--prefix prefix] [--values] [--limit n]",
+		description: "print the keys in ascending order, along with the values if --values is set",
+		run:         scan,
+	},
+	"stats": {
+		usage:       "stats",
+		description: "print the database statistics as JSON",
+		run:         stats,
+	},
+	"merge": {
+		usage:       "merge",
+		description: "compact the datafiles",
+		run:         merge,
+	},
+	"verify": {
+		usage:       "verify",
+		description: "check the datafiles and hint files without opening the database, and report the corruptions",
+		open:        verify,
+	},
+	"repair": {
+		usage:       "repair",
+		description: "rebuild the database from the valid entries, the corrupted ranges are moved to quarantine files",
+		open:        repair,
+	},
+	"inspect": {
+		usage:       "inspect [--json] [--preview n] <datafile>",
+		description: "print the layout of every entry in the datafile, e.g. data/caskdb_0",
+		open:        inspect,
+	},
+	"shell": {
+		usage:       "shell [--addr host:port] [path]",
+		description: "interactive shell on the database at the path (default -db), or on caskdb-server at --addr",
+		open:        runShell,
+	},
+	"export": {
+		usage:       "export [file]",
+		description: "write every record as JSON Lines to the file, or stdout",
+		run:         export,
+	},
+	"import": {
+		usage:       "import [file]",
+		description: "write the records from JSON Lines file, or stdin",
+		run:         importRecords,
+		create:      true,
+	},
+	"dump": {
+		usage:       "dump [file]",
+		description: "same as export",
+		run:         export,
+	},
+	"load": {
+		usage:       "load [file]",
+		description: "same as import",
+		run:         importRecords,
+		create:      true,
+	},
+}
+
+// errUsage is returned by the command when the arguments are invalid
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	dbPath := flag.String("db", "data/caskdb", "path of the database files, without the file id suffix")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, found := commands[flag.Arg(0)]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	err := run(cmd, *dbPath, flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "Usage: caskdb [flags] %s\n", cmd.usage)
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd command, dbPath string, args []string) error {
+	if cmd.open != nil {
+		return cmd.open(dbPath, args)
+	}
+
+	store, err := openStore(dbPath, cmd.create)
+	if err != nil {
+		return err
+	}
+	err = cmd.run(store, args)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// checkDatabase will return error if the directory of the database doesn't exist,
+// or if the database doesn't have any datafile and create is false, so mistyped
+// path is reported instead of creating new database
+func checkDatabase(dbPath string, create bool) error {
+	dir, file := filepath.Split(dbPath)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("database directory %s doesn't exist", dir)
+	} else if err != nil {
+		return err
+	}
+	if create {
+		return nil
+	}
+
+	for _, entry := range entries {
+		if id := strings.TrimPrefix(entry.Name(), file+"_"); id != entry.Name() {
+			if _, err = strconv.Atoi(id); err == nil {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("database %s doesn't exist", dbPath)
+}
+
+// openStore will check the database, then open it. The error that the
+// storage panics with, e.g. ErrUnsupportedFormat, is returned instead
+func openStore(dbPath string, create bool) (store *caskdb.DiskStorage, err error) {
+	if err = checkDatabase(dbPath, create); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if err, _ = r.(error); err == nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	return caskdb.NewDiskStorage(dbPath), nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: caskdb [flags] <command> [args]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-48s %s\n", commands[name].usage, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
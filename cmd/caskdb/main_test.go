@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCommand will run the command with stdin, and return what is written to stdout.
+// os.Stdin and os.Stdout are replaced, so the tests must not be parallel
+func runCommand(t *testing.T, dbPath, stdin string, args ...string) (string, error) {
+	cmd, found := commands[args[0]]
+	require.True(t, found, args[0])
+
+	in := filepath.Join(t.TempDir(), "stdin")
+	require.Nil(t, os.WriteFile(in, []byte(stdin), 0600))
+	inFile, err := os.Open(in)
+	require.Nil(t, err)
+	defer inFile.Close()
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+	defer r.Close()
+
+	stdinBefore, stdoutBefore := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inFile, w
+	defer func() {
+		os.Stdin, os.Stdout = stdinBefore, stdoutBefore
+	}()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+	err = run(cmd, dbPath, args[1:])
+	w.Close()
+
+	return <-output, err
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestRun_missingDatabase(t *testing.T) {
+	tests := []struct {
+		args []string
+		// create is true if the command creates the database once the directory exists
+		create bool
+	}{
+		{args: []string{"get", "key"}},
+		{args: []string{"set", "key", "value"}, create: true},
+		{args: []string{"del", "key"}},
+		{args: []string{"scan"}},
+		{args: []string{"stats"}},
+		{args: []string{"merge"}},
+		{args: []string{"verify"}},
+		{args: []string{"repair"}},
+		{args: []string{"export"}},
+		{args: []string{"dump"}},
+		{args: []string{"import"}, create: true},
+		{args: []string{"load"}, create: true},
+		{args: []string{"shell"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			dir := t.TempDir()
+
+			// mistyped directory is reported without creating anything
+			_, err := runCommand(t, filepath.Join(dir, "nodir", "db"), "", tt.args...)
+			assert.EqualError(t, err, "database directory "+filepath.Join(dir, "nodir")+string(filepath.Separator)+" doesn't exist")
+			assert.Empty(t, listDir(t, dir))
+
+			_, err = runCommand(t, filepath.Join(dir, "db"), "", tt.args...)
+			if tt.create {
+				assert.Nil(t, err)
+				assert.Contains(t, listDir(t, dir), "db_0")
+				return
+			}
+			assert.EqualError(t, err, "database "+filepath.Join(dir, "db")+" doesn't exist")
+			assert.Empty(t, listDir(t, dir))
+		})
+	}
+}
+
+func TestRun_commands(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	exported := filepath.Join(t.TempDir(), "export.jsonl")
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+		// contains is checked instead of expected if it is set
+		contains string
+		err      string
+	}{
+		{name: "set", args: []string{"set", "hello", "world"}},
+		{name: "set from stdin", args: []string{"set", "user:1"}, stdin: "alice"},
+		{name: "set with ttl", args: []string{"set", "--ttl", "1h", "user:2", "bob"}},
+		{name: "set usage", args: []string{"set"}, err: errUsage.Error()},
+		{name: "get", args: []string{"get", "user:1"}, expected: "alice\n"},
+		{name: "inspect", args: []string{"inspect", "--preview", "4", dbPath + "_0"}, contains: `"user"...`},
+		{name: "inspect missing", args: []string{"inspect", dbPath + "_100"}, err: "no such file or directory"},
+		{name: "get missing", args: []string{"get", "missing"}, err: "record not found"},
+		{name: "scan", args: []string{"scan"}, expected: "hello\nuser:1\nuser:2\n"},
+		{name: "scan prefix", args: []string{"scan", "--prefix", "user:", "--values", "--limit", "1"}, expected: "user:1\talice\n"},
+		{name: "stats", args: []string{"stats"}, contains: `"key_count": 3`},
+		{name: "export", args: []string{"export", exported}},
+		{name: "dump", args: []string{"dump"}, contains: `"key":"aGVsbG8="`},
+		{name: "del", args: []string{"del", "hello"}},
+		{name: "del missing", args: []string{"del", "hello"}, err: "record not found"},
+		{name: "import", args: []string{"import", exported}},
+		{name: "get imported", args: []string{"get", "hello"}, expected: "world\n"},
+		{name: "load", args: []string{"load"}, stdin: `{"key":"bG9hZGVk","value":"dmFsdWU="}` + "\n"},
+		{name: "get loaded", args: []string{"get", "loaded"}, expected: "value\n"},
+		{name: "merge", args: []string{"merge"}, contains: "datafiles: "},
+		{name: "verify", args: []string{"verify"}, contains: "hint files: 4 keys"},
+		{name: "repair", args: []string{"repair"}, contains: "4 keys in datafiles"},
+		{name: "shell", args: []string{"shell"}, stdin: "get loaded\n", contains: "value"},
+		{name: "shell failed", args: []string{"shell"}, stdin: "get missing\nget loaded\n", err: "1 of 2 lines of the script failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runCommand(t, dbPath, tt.stdin, tt.args...)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.Nil(t, err)
+			if tt.contains != "" {
+				assert.True(t, strings.Contains(output, tt.contains), output)
+				return
+			}
+			assert.Equal(t, tt.expected, output)
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/client"
+)
+
+const defaultScanLimit = 100
+
+// errExit is returned by the exit command to stop the shell
+var errExit = errors.New("exit")
+
+type shellCommand struct {
+	usage       string
+	description string
+	minArgs     int
+	maxArgs     int
+	run         func(sh *shell, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"get": {
+			usage: "get <key>", description: "print the value of the key",
+			minArgs: 1, maxArgs: 1, run: (*shell).get,
+		},
+		"set": {
+			usage: "set <key> <value> [ttl]", description: "set the value of the key, ttl is a duration, e.g. 10m",
+			minArgs: 2, maxArgs: 3, run: (*shell).set,
+		},
+		"del": {
+			usage: "del <key>", description: "delete the key",
+			minArgs: 1, maxArgs: 1, run: (*shell).del,
+		},
+		"delete": {
+			usage: "delete <key>", description: "same as del",
+			minArgs: 1, maxArgs: 1, run: (*shell).del,
+		},
+		"scan": {
+			usage: "scan [prefix] [limit]", description: fmt.Sprintf("print the keys with the prefix and their values, up to %d keys by default", defaultScanLimit),
+			minArgs: 0, maxArgs: 2, run: (*shell).scan,
+		},
+		"stats": {
+			usage: "stats", description: "print the database statistics",
+			minArgs: 0, maxArgs: 0, run: (*shell).stats,
+		},
+		"timestamp": {
+			usage: "timestamp <key>", description: "print when the key is written and when it expires",
+			minArgs: 1, maxArgs: 1, run: (*shell).timestamp,
+		},
+		"format": {
+			usage: "format [auto|hex|utf8]", description: "print or change how the keys and values are printed",
+			minArgs: 0, maxArgs: 1, run: (*shell).setFormat,
+		},
+		"help": {
+			usage: "help", description: "print the commands",
+			minArgs: 0, maxArgs: 0, run: (*shell).help,
+		},
+		"exit": {
+			usage: "exit", description: "leave the shell, Ctrl-D also works",
+			minArgs: 0, maxArgs: 0, run: func(*shell, []string) error { return errExit },
+		},
+	}
+}
+
+// shell is an interactive session on either DiskStorage or caskdb-server
+type shell struct {
+	store caskdb.Store
+	out   io.Writer
+	// format is how the keys and values are printed, either auto, hex or utf8
+	format string
+}
+
+// runShell will start the shell on the database at the path, or
+// on caskdb-server if --addr is set
+func runShell(dbPath string, args []string) error {
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	addr := flags.String("addr", "", "address of caskdb-server to connect to instead of opening the database")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+		return errUsage
+	}
+	if flags.NArg() == 1 {
+		dbPath = flags.Arg(0)
+	}
+
+	sh := &shell{out: os.Stdout, format: "auto"}
+	prompt := dbPath + "> "
+	if *addr != "" {
+		c := client.New(*addr)
+		defer c.Close()
+		sh.store = c
+		prompt = *addr + "> "
+	} else {
+		store, err := openStore(dbPath, false)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		sh.store = store
+	}
+
+	if !isTerminal(int(os.Stdin.Fd())) {
+		return sh.runScript(os.Stdin)
+	}
+
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".caskdb_history")
+	}
+	editor := newLineEditor(os.Stdin, os.Stdout, historyFile)
+	editor.complete = completeCommand
+	fmt.Fprintln(sh.out, `type "help" for the commands`)
+	for {
+		line, err := editor.readLine(prompt)
+		if errors.Is(err, errInterrupted) {
+			continue
+		} else if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		editor.addHistory(strings.TrimSpace(line))
+		if err = sh.exec(line); errors.Is(err, errExit) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(sh.out, "error: %v\n", err)
+		}
+	}
+}
+
+// runScript will execute every line read from r, e.g. when the input is piped.
+// Every line is executed even if the previous one failed, but the error is
+// returned at the end, so the script exit with non-zero status
+func (sh *shell) runScript(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	executed, failed := 0, 0
+	for scanner.Scan() {
+		executed++
+		if err := sh.exec(scanner.Text()); errors.Is(err, errExit) {
+			break
+		} else if err != nil {
+			fmt.Fprintf(sh.out, "error: %v\n", err)
+			failed++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lines of the script failed", failed, executed)
+	}
+
+	return nil
+}
+
+func (sh *shell) exec(line string) error {
+	args, err := splitArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd, found := shellCommands[strings.ToLower(args[0])]
+	if !found {
+		return fmt.Errorf("unknown command %q, type \"help\" for the commands", args[0])
+	}
+	if len(args)-1 < cmd.minArgs || len(args)-1 > cmd.maxArgs {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+
+	return cmd.run(sh, args[1:])
+}
+
+func (sh *shell) get(args []string) error {
+	value, err := sh.store.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, sh.formatBytes(value))
+
+	return nil
+}
+
+func (sh *shell) set(args []string) error {
+	key, value := []byte(args[0]), []byte(args[1])
+	if len(args) == 3 {
+		ttl, err := time.ParseDuration(args[2])
+		if err != nil {
+			return err
+		}
+		if err = sh.store.SetWithTTL(key, value, ttl); err != nil {
+			return err
+		}
+	} else if err := sh.store.Set(key, value); err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "OK")
+
+	return nil
+}
+
+func (sh *shell) del(args []string) error {
+	if err := sh.store.Delete([]byte(args[0])); err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "OK")
+
+	return nil
+}
+
+var errStopShellScan = errors.New("scan limit is reached")
+
+func (sh *shell) scan(args []string) error {
+	prefix, limit := "", defaultScanLimit
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	if len(args) > 1 {
+		var err error
+		if limit, err = strconv.Atoi(args[1]); err != nil || limit < 1 {
+			return fmt.Errorf("limit must be a positive number")
+		}
+	}
+
+	count := 0
+	err := sh.store.IterateKeys(func(key []byte) error {
+		if !strings.HasPrefix(string(key), prefix) {
+			return nil
+		}
+		if count == limit {
+			return errStopShellScan
+		}
+
+		value, err := sh.store.Get(key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		count++
+		fmt.Fprintf(sh.out, "%s\t%s\n", sh.formatBytes(key), sh.formatBytes(value))
+		return nil
+	})
+	if errors.Is(err, errStopShellScan) {
+		fmt.Fprintf(sh.out, "(limited to %d keys)\n", limit)
+		return nil
+	}
+	fmt.Fprintf(sh.out, "(%d keys)\n", count)
+
+	return err
+}
+
+func (sh *shell) stats([]string) error {
+	store, ok := sh.store.(interface{ Stats() caskdb.Stats })
+	if !ok {
+		return errors.New("stats is only supported on the database, not on the server")
+	}
+
+	stats := store.Stats()
+	fmt.Fprintf(sh.out, "keys:      %d\n", stats.KeyCount)
+	fmt.Fprintf(sh.out, "datafiles: %d\n", stats.FileCount)
+	fmt.Fprintf(sh.out, "size:      %d bytes (%d live, %d dead)\n", stats.TotalSize, stats.LiveSize, stats.DeadSize)
+	fmt.Fprintf(sh.out, "active:    datafile %d, %d of %d bytes\n", stats.ActiveFileID, stats.ActiveFileSize, stats.MaxFileSize)
+	fmt.Fprintf(sh.out, "keydir:    ~%d bytes\n", stats.KeyDirMemory)
+	fmt.Fprintf(sh.out, "gets:      %d (%d misses), sets: %d, deletes: %d\n", stats.Gets, stats.Misses, stats.Sets, stats.Deletes)
+	fmt.Fprintf(sh.out, "read:      %d bytes, written: %d bytes\n", stats.BytesRead, stats.BytesWritten)
+
+	return nil
+}
+
+func (sh *shell) timestamp(args []string) error {
+	store, ok := sh.store.(interface {
+		GetRecord(key []byte) (*caskdb.Record, error)
+	})
+	if !ok {
+		return errors.New("timestamp is only supported on the database, not on the server")
+	}
+
+	record, err := store.GetRecord([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "written: %s\n", time.Unix(0, record.Timestamp).Format(time.RFC3339Nano))
+	if record.Expiry == 0 {
+		fmt.Fprintln(sh.out, "expires: never")
+	} else {
+		expiry := time.Unix(0, record.Expiry)
+		fmt.Fprintf(sh.out, "expires: %s (in %s)\n", expiry.Format(time.RFC3339Nano), time.Until(expiry).Round(time.Second))
+	}
+
+	return nil
+}
+
+func (sh *shell) setFormat(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(sh.out, sh.format)
+		return nil
+	}
+
+	switch args[0] {
+	case "auto", "hex", "utf8":
+		sh.format = args[0]
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q, use auto, hex or utf8", args[0])
+	}
+}
+
+func (sh *shell) help([]string) error {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(sh.out, "  %-24s %s\n", shellCommands[name].usage, shellCommands[name].description)
+	}
+	fmt.Fprintln(sh.out, `Arguments with space or binary data can be quoted, e.g. "hello world" or "\x00\xff"`)
+
+	return nil
+}
+
+// formatBytes will print the data as UTF-8 if it is printable in auto format, or hex otherwise
+func (sh *shell) formatBytes(b []byte) string {
+	switch sh.format {
+	case "hex":
+		return "0x" + hex.EncodeToString(b)
+	case "utf8":
+		return string(b)
+	}
+
+	if !utf8.Valid(b) {
+		return "0x" + hex.EncodeToString(b)
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return strconv.Quote(string(b))
+		}
+	}
+
+	return string(b)
+}
+
+// splitArgs will split the line by spaces, argument in double quotes
+// can have spaces and Go escape sequences, e.g. "hello\tworld\x00"
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return args, nil
+		}
+
+		if line[0] != '"' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end == -1 {
+				end = len(line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+			continue
+		}
+
+		// find the closing quote that is not escaped
+		end := 1
+		for ; end < len(line) && line[end] != '"'; end++ {
+			if line[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(line) {
+			return nil, errors.New("unterminated quoted argument")
+		}
+		arg, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted argument %s", line[:end+1])
+		}
+		args = append(args, arg)
+		line = line[end+1:]
+	}
+}
+
+// completeCommand will complete the command name and the format argument
+func completeCommand(line []rune, pos int) ([]string, int) {
+	start := pos
+	for start > 0 && !unicode.IsSpace(line[start-1]) {
+		start--
+	}
+	word := string(line[start:pos])
+	before := strings.Fields(string(line[:start]))
+
+	var options []string
+	switch {
+	case len(before) == 0:
+		for name := range shellCommands {
+			options = append(options, name)
+		}
+	case len(before) == 1 && before[0] == "format":
+		options = []string{"auto", "hex", "utf8"}
+	}
+
+	candidates := make([]string, 0)
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			candidates = append(candidates, option)
+		}
+	}
+	sort.Strings(candidates)
+
+	return candidates, start
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errRawModeUnsupported = errors.New("terminal raw mode is not supported on this platform")
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errRawModeUnsupported
+}
+
+// isTerminal always return false, so the shell reads plain lines without line editing
+func isTerminal(fd int) bool {
+	return false
+}
@@ -0,0 +1,141 @@
+package caskdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// codecNone is stored in the header of value that is not compressed,
+	// it is reserved and can't be used by custom Compressor
+	codecNone uint8 = iota
+	codecFlate
+	codecGzip
+)
+
+var errUnknownCodec = errors.New("unknown compression codec")
+
+// Compressor compress value before it is written to the datafiles.
+// The ID of the Compressor is recorded in the header of each entry,
+// so the value can be decompressed regardless of current Options
+type Compressor interface {
+	// ID must be unique for each codec and must not be 0
+	ID() uint8
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// builtinCompressors is registered to every DiskStorage
+var builtinCompressors = []Compressor{
+	FlateCompressor{Level: flate.DefaultCompression},
+	GzipCompressor{Level: gzip.DefaultCompression},
+}
+
+// FlateCompressor compress value using DEFLATE
+type FlateCompressor struct {
+	Level int
+}
+
+func (f FlateCompressor) ID() uint8 {
+	return codecFlate
+}
+
+func (f FlateCompressor) Compress(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, f.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (f FlateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// GzipCompressor compress value using gzip
+type GzipCompressor struct {
+	Level int
+}
+
+func (g GzipCompressor) ID() uint8 {
+	return codecGzip
+}
+
+func (g GzipCompressor) Compress(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, g.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (g GzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// compress will compress the value using configured compressor if the value
+// is larger than the threshold, it returns the codec id that should be
+// stored in the header. Value will be stored as is if compression doesn't
+// make it smaller
+func (s *DiskStorage) compress(value []byte) ([]byte, uint8, error) {
+	if s.compressor == nil || int64(len(value)) < s.compressionThreshold {
+		return value, codecNone, nil
+	}
+
+	compressed, err := s.compressor.Compress(value)
+	if err != nil {
+		return nil, codecNone, err
+	}
+	if len(compressed) >= len(value) {
+		return value, codecNone, nil
+	}
+
+	return compressed, s.compressor.ID(), nil
+}
+
+func (s *DiskStorage) decompress(codec uint8, value []byte) ([]byte, error) {
+	if codec == codecNone {
+		return value, nil
+	}
+
+	c, found := s.compressors[codec]
+	if !found {
+		return nil, fmt.Errorf("%w: %d", errUnknownCodec, codec)
+	}
+
+	decompressed, err := c.Decompress(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,102 @@
+package caskdb
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor_roundTrip(t *testing.T) {
+	t.Parallel()
+
+	value := bytes.Repeat([]byte(`{"hello":"world"}`), 100)
+	for _, c := range builtinCompressors {
+		compressed, err := c.Compress(value)
+		assert.Nil(t, err)
+		assert.Less(t, len(compressed), len(value))
+
+		res, err := c.Decompress(compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, value, res)
+	}
+}
+
+func TestDiskStorage_compression(t *testing.T) {
+	t.Parallel()
+
+	t.Run("compress value above threshold", func(t *testing.T) {
+		t.Parallel()
+
+		store, filePath, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetCompressor(FlateCompressor{Level: 9}, "1KB"))
+
+		value := bytes.Repeat([]byte(`{"hello":"world"}`), 1000)
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), value))
+		}
+		for i := 0; i < 10; i++ {
+			res, err := store.Get([]byte(strconv.Itoa(i)))
+			assert.Nil(t, err)
+			assert.Equal(t, value, res)
+		}
+
+		stat, err := os.Stat(filePath + "_0")
+		assert.Nil(t, err)
+		assert.Less(t, stat.Size(), int64(len(value)))
+	})
+
+	t.Run("keep value below threshold", func(t *testing.T) {
+		t.Parallel()
+
+		store, _, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetCompressor(GzipCompressor{}, "1KB"))
+
+		value := bytes.Repeat([]byte("a"), 100)
+		assert.Nil(t, store.Set([]byte("small"), value))
+
+		compressed, codec, err := store.compress(value)
+		assert.Nil(t, err)
+		assert.Equal(t, codecNone, codec)
+		assert.Equal(t, value, compressed)
+
+		res, err := store.Get([]byte("small"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, res)
+	})
+
+	t.Run("unknown codec", func(t *testing.T) {
+		t.Parallel()
+
+		store, filename, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetCompressor(halfCompressor{}, "1KB"))
+
+		value := bytes.Repeat([]byte("ab"), 1024)
+		assert.Nil(t, store.Set([]byte("key"), value))
+		res, err := store.Get([]byte("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, res)
+
+		// reopening without the custom compressor can't decode the value
+		reopened := NewDiskStorage(filename)
+		_, err = reopened.Get([]byte("key"))
+		assert.ErrorIs(t, err, errUnknownCodec)
+	})
+}
+
+// halfCompressor is a custom codec that "compress" value by
+// dropping its second half, only useful for repetitive test value
+type halfCompressor struct{}
+
+func (r halfCompressor) ID() uint8 { return 42 }
+func (r halfCompressor) Compress(src []byte) ([]byte, error) {
+	return src[:len(src)/2], nil
+}
+func (r halfCompressor) Decompress(src []byte) ([]byte, error) {
+	return append(src, src...), nil
+}
@@ -1,44 +1,129 @@
 package caskdb
 
 import (
-	"io"
-	"os"
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"sync"
 )
 
+const (
+	// formatVersion is the version of the datafiles and hint files written by this package,
+	// it is increased whenever the layout of the entry or the hint files is changed
+	formatVersion = 1
+	// byte length of the header at the start of every datafile
+	// | magic 4B | version 4B |
+	dataFileHeaderLength = 8
+)
+
+var dataFileMagic = []byte("CASK")
+
+// encodeDataFileHeader will return the header written at the start of every datafile
+func encodeDataFileHeader() []byte {
+	b := make([]byte, dataFileHeaderLength)
+	copy(b, dataFileMagic)
+	binary.LittleEndian.PutUint32(b[len(dataFileMagic):], formatVersion)
+
+	return b
+}
+
+// checkDataFileHeader will return ErrUnsupportedFormat if the datafile starting with
+// data is not written in the current format. Datafile shorter than the header is
+// accepted as long as it is the beginning of the header, as it is not completely
+// written when the datafile is created
+func checkDataFileHeader(data []byte) error {
+	header := encodeDataFileHeader()
+	if len(data) < dataFileHeaderLength {
+		if !bytes.HasPrefix(header, data) {
+			return fmt.Errorf("%w: datafile header is truncated", ErrUnsupportedFormat)
+		}
+		return nil
+	}
+	if !bytes.Equal(data[:len(dataFileMagic)], dataFileMagic) {
+		return fmt.Errorf("%w: datafile doesn't start with the magic, it is written by caskdb "+
+			"before the format is versioned and must be upgraded by opening the database, "+
+			"or it is not a datafile", ErrUnsupportedFormat)
+	}
+	if version := binary.LittleEndian.Uint32(data[len(dataFileMagic):]); version != formatVersion {
+		return fmt.Errorf("%w: datafile version is %d, only version %d is supported",
+			ErrUnsupportedFormat, version, formatVersion)
+	}
+
+	return nil
+}
+
 type datafile struct {
 	fileID string
-	file   *os.File
+	file   File
 	offset int64
+	// failed is set when an entry is failed to be written, it
+	// might be partially written, so no entry should be appended
+	// after it. guarded by DiskStorage lock
+	failed bool
 	sync.RWMutex
 }
 
 // openDataFile will open data files if exists, else
-// it will create new one.
-func openDataFile(name string) *datafile {
-	rw, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+// it will create new one. New data will be appended
+// after the existing one. The header of the existing
+// datafile is checked, and it is written to the new one
+func openDataFile(fs FileSystem, name string) (*datafile, error) {
+	rw, err := fs.OpenFile(name)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	offset, err := rw.Size()
+	if err == nil {
+		offset, err = writeDataFileHeader(rw, offset)
+	}
+	if err != nil {
+		rw.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
 	return &datafile{
 		fileID:  name,
 		file:    rw,
 		RWMutex: sync.RWMutex{},
-		offset:  io.SeekStart,
+		offset:  offset,
+	}, nil
+}
+
+// writeDataFileHeader will check the header of the file, then write the
+// missing part of it, the new size of the file is returned
+func writeDataFileHeader(file File, size int64) (int64, error) {
+	n := size
+	if n > dataFileHeaderLength {
+		n = dataFileHeaderLength
+	}
+	existing := make([]byte, n)
+	if n > 0 {
+		if _, err := file.ReadAt(existing, 0); err != nil {
+			return 0, err
+		}
 	}
+	if err := checkDataFileHeader(existing); err != nil {
+		return 0, err
+	}
+	if size >= dataFileHeaderLength {
+		return size, nil
+	}
+
+	written, err := file.Write(encodeDataFileHeader()[size:])
+	return size + int64(written), err
 }
 
 func (d *datafile) Close() error {
 	return d.file.Close()
 }
 
+// Size will return the size of the files, since data is only
+// appended, it is the same as current offset
 func (d *datafile) Size() int64 {
 	d.RLock()
-	stat, _ := d.file.Stat()
-	d.RUnlock()
+	defer d.RUnlock()
 
-	return stat.Size()
+	return d.offset
 }
 
 func (d *datafile) Write(p []byte) (n int, offset int64, err error) {
@@ -51,6 +136,10 @@ func (d *datafile) Write(p []byte) (n int, offset int64, err error) {
 	return n, d.offset, err
 }
 
+func (d *datafile) Sync() error {
+	return d.file.Sync()
+}
+
 // implement io.ReadAt
 func (d *datafile) ReadAt(p []byte, off int64) (int, error) {
 	return d.file.ReadAt(p, off)
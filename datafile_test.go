@@ -0,0 +1,152 @@
+package caskdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkDataFileHeader(t *testing.T) {
+	t.Parallel()
+
+	header := encodeDataFileHeader()
+	assert.Nil(t, checkDataFileHeader(header))
+	assert.Nil(t, checkDataFileHeader(append(header, 1, 2, 3)))
+	// the header is partially written when the datafile is created
+	assert.Nil(t, checkDataFileHeader(nil))
+	assert.Nil(t, checkDataFileHeader(header[:3]))
+
+	// datafile written before the format is versioned starts with the entry header
+	_, data := newEntry(1, []byte("key"), []byte("value")).encode()
+	assert.ErrorIs(t, checkDataFileHeader(data), ErrUnsupportedFormat)
+	assert.ErrorIs(t, checkDataFileHeader(data[:3]), ErrUnsupportedFormat)
+
+	newer := encodeDataFileHeader()
+	newer[len(dataFileMagic)] = formatVersion + 1
+	assert.ErrorIs(t, checkDataFileHeader(newer), ErrUnsupportedFormat)
+}
+
+func Test_openDataFile(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	file, err := openDataFile(fs, "db/test_0")
+	require.Nil(t, err)
+	assert.Equal(t, int64(dataFileHeaderLength), file.Size())
+	assert.Nil(t, file.Close())
+
+	// the missing part of the partially written header is completed
+	fs.files["db/test_1"] = &memFileData{data: encodeDataFileHeader()[:5]}
+	file, err = openDataFile(fs, "db/test_1")
+	require.Nil(t, err)
+	assert.Equal(t, int64(dataFileHeaderLength), file.Size())
+	assert.Equal(t, encodeDataFileHeader(), fs.files["db/test_1"].data)
+	assert.Nil(t, file.Close())
+
+	_, data := newEntry(1, []byte("key"), []byte("value")).encode()
+	fs.files["db/test_2"] = &memFileData{data: data}
+	_, err = openDataFile(fs, "db/test_2")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.Contains(t, err.Error(), "db/test_2")
+}
+
+func TestDiskStorage_unsupportedFormat(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs)
+	store := NewDiskStorage("db/test", options)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, store.Close())
+
+	// hint files written before the format is versioned is ignored, so the keys are loaded from the datafiles
+	b := new(bytes.Buffer)
+	require.Nil(t, gob.NewEncoder(b).Encode(hintFiles{
+		KeyDir:    map[string]*keyDirEntry{},
+		FileSizes: map[int]int64{0: int64(len(fs.files["db/test_0"].data))},
+	}))
+	_, err := store.decodeHintFiles(b.Bytes())
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	fs.files["db/test.hint"].data = b.Bytes()
+	store = NewDiskStorage("db/test", options)
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+	assert.Nil(t, store.Close())
+
+	// datafile that isn't written by any version of caskdb is rejected, and it is left as is
+	fs.files["db/test_0"].data = []byte("garbage")
+	assert.PanicsWithError(t, "db/test_0: "+ErrUnsupportedFormat.Error()+": datafile doesn't start with the magic, "+
+		"and it is not a datafile written before the format is versioned", func() {
+		NewDiskStorage("db/test", options)
+	})
+	assert.Equal(t, []byte("garbage"), fs.files["db/test_0"].data)
+}
+
+// encodeV0Entry will encode the entry as it is written before the format is versioned
+func encodeV0Entry(timestamp int64, key, value string) []byte {
+	b := make([]byte, v0HeaderLength, v0HeaderLength+len(key)+len(value))
+	binary.LittleEndian.PutUint64(b[0:], uint64(timestamp))
+	binary.LittleEndian.PutUint64(b[8:], uint64(len(key)))
+	binary.LittleEndian.PutUint64(b[16:], uint64(len(value)))
+
+	return append(append(b, key...), value...)
+}
+
+func TestDiskStorage_upgrade(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs)
+	var first, second []byte
+	first = append(first, encodeV0Entry(1, "key", "old")...)
+	first = append(first, encodeV0Entry(2, "other", "value")...)
+	second = append(second, encodeV0Entry(3, "key", "new")...)
+	// the last entry is partially written
+	second = append(second, encodeV0Entry(4, "partial", "value")[:10]...)
+	fs.files["db/test_0"] = &memFileData{data: first}
+	fs.files["db/test_1"] = &memFileData{data: second}
+	// the hint files is the gob encoded keyDir, it doesn't match the upgraded datafiles
+	fs.files["db/test.hint"] = &memFileData{data: []byte("stale hint files")}
+
+	// verify and repair doesn't modify the database
+	_, err := Verify("db/test", options)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	_, err = Repair("db/test", options)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.Equal(t, first, fs.files["db/test_0"].data)
+
+	store := NewDiskStorage("db/test", options)
+	for key, expected := range map[string]string{"key": "new", "other": "value"} {
+		res, err := store.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(res))
+	}
+	_, err = store.Get([]byte("partial"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	record, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), record.Timestamp)
+	assert.Nil(t, store.Set([]byte("after"), []byte("upgrade")))
+	assert.Nil(t, store.Close())
+
+	for _, name := range []string{"db/test_0", "db/test_1"} {
+		assert.Nil(t, checkDataFileHeader(fs.files[name].data))
+		assert.Equal(t, dataFileMagic, fs.files[name].data[:len(dataFileMagic)])
+	}
+	report, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.True(t, report.OK())
+	assert.False(t, report.Hint.Stale)
+
+	// the upgraded database is opened from the regenerated hint files
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	res, err := store.Get([]byte("after"))
+	assert.Nil(t, err)
+	assert.Equal(t, "upgrade", string(res))
+}
@@ -0,0 +1,147 @@
+package caskdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// minimumEncryptedDataBytes is the size of nonce + GCM tag
+	minimumEncryptedDataBytes = 12 + 16
+)
+
+var (
+	errDecryption            = errors.New("unable to decrypt record")
+	errEncryptionKeyRequired = errors.New("record is encrypted but no encryption key is configured")
+	additionalDataHintFiles  = []byte("hint")
+)
+
+// keyring hold AES-GCM cipher of the current encryption key,
+// followed by the previous keys. New data is always sealed using
+// the current key, while the previous keys are only used to open
+// data that hasn't been re-encrypted by Merge yet
+type keyring struct {
+	aeads []cipher.AEAD
+}
+
+func newKeyring(keys ...[]byte) (*keyring, error) {
+	k := &keyring{aeads: make([]cipher.AEAD, 0, len(keys))}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads = append(k.aeads, aead)
+	}
+
+	return k, nil
+}
+
+// seal will encrypt and authenticate the plaintext using current key,
+// nonce is prepended to the result
+// | nonce 12B | ciphertext | tag 16B |
+func (k *keyring) seal(plaintext, additionalData []byte) ([]byte, error) {
+	aead := k.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open will try to decrypt the data using every known key
+func (k *keyring) open(data, additionalData []byte) ([]byte, error) {
+	if len(data) < minimumEncryptedDataBytes {
+		return nil, errDecryption
+	}
+
+	for _, aead := range k.aeads {
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, errDecryption
+}
+
+// sealEntry will encrypt key and value of the entry if encryption is enabled,
+// the header is used as additional data so it can't be tampered
+func (s *DiskStorage) sealEntry(e *entry) error {
+	if s.keyring == nil {
+		return nil
+	}
+
+	e.header.flags |= flagEncrypted
+	key, err := s.keyring.seal(e.key, entryAdditionalData(e.header, roleKey, nil))
+	if err != nil {
+		return err
+	}
+	value, err := s.keyring.seal(e.value, entryAdditionalData(e.header, roleValue, key))
+	if err != nil {
+		return err
+	}
+
+	e.key, e.value = key, value
+	e.header.keySize = uint64(len(key))
+	e.header.valueSize = uint64(len(value))
+
+	return nil
+}
+
+// openEntry will decrypt key and value of the entry if it is encrypted
+func (s *DiskStorage) openEntry(e *entry) error {
+	if e.header.flags&flagEncrypted == 0 {
+		return nil
+	}
+	if s.keyring == nil {
+		return errEncryptionKeyRequired
+	}
+
+	key, err := s.keyring.open(e.key, entryAdditionalData(e.header, roleKey, nil))
+	if err != nil {
+		return err
+	}
+	value, err := s.keyring.open(e.value, entryAdditionalData(e.header, roleValue, e.key))
+	if err != nil {
+		return err
+	}
+
+	e.key, e.value = key, value
+	e.header.keySize = uint64(len(key))
+	e.header.valueSize = uint64(len(value))
+	e.header.flags &^= flagEncrypted
+
+	return nil
+}
+
+// role of the sealed data in the additional data, so the key
+// and value ciphertexts can't be swapped
+const (
+	roleKey   uint8 = 0
+	roleValue uint8 = 1
+)
+
+// entryAdditionalData is part of the header that doesn't change after encryption,
+// flags are included so the entry can't be turned into a tombstone or merged entry.
+// The value is bound to the sealed key, so it can't be moved to another entry
+// | timestamp 8B | expiry 8B | codec 1B | flags 1B | role 1B | sealed key (value only) |
+func entryAdditionalData(h headerEntry, role uint8, sealedKey []byte) []byte {
+	b := make([]byte, 19, 19+len(sealedKey))
+	binary.LittleEndian.PutUint64(b[0:], uint64(h.timestamp))
+	binary.LittleEndian.PutUint64(b[8:], uint64(h.expiry))
+	b[16] = h.codec
+	b[17] = h.flags
+	b[18] = role
+
+	return append(b, sealedKey...)
+}
@@ -0,0 +1,225 @@
+package caskdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testEncryptionKey    = bytes.Repeat([]byte("k"), 32)
+	testNewEncryptionKey = bytes.Repeat([]byte("n"), 32)
+)
+
+func Test_keyring(t *testing.T) {
+	t.Parallel()
+
+	oldKeyring, err := newKeyring(testEncryptionKey)
+	assert.Nil(t, err)
+	sealed, err := oldKeyring.seal([]byte("secret"), []byte("ad"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	t.Run("open using previous key", func(t *testing.T) {
+		k, err := newKeyring(testNewEncryptionKey, testEncryptionKey)
+		assert.Nil(t, err)
+		res, err := k.open(sealed, []byte("ad"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("secret"), res)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		k, err := newKeyring(testNewEncryptionKey)
+		assert.Nil(t, err)
+		_, err = k.open(sealed, []byte("ad"))
+		assert.ErrorIs(t, err, errDecryption)
+	})
+
+	t.Run("tampered additional data", func(t *testing.T) {
+		_, err := oldKeyring.open(sealed, []byte("tampered"))
+		assert.ErrorIs(t, err, errDecryption)
+	})
+
+	t.Run("invalid key size", func(t *testing.T) {
+		_, err := newKeyring([]byte("short"))
+		assert.Error(t, err)
+		assert.Panics(t, func() {
+			NewOptions().SetEncryptionKey([]byte("short"))
+		})
+	})
+}
+
+func TestDiskStorage_encryption(t *testing.T) {
+	t.Parallel()
+
+	t.Run("encrypt datafiles and hint files", func(t *testing.T) {
+		t.Parallel()
+
+		store, filename, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetEncryptionKey(testEncryptionKey))
+
+		assert.Nil(t, store.Set([]byte("customer"), []byte("john doe")))
+		res, err := store.Get([]byte("customer"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("john doe"), res)
+		assert.Nil(t, store.Close())
+
+		for _, name := range []string{store.dataFileName(0), store.hintFileName()} {
+			b, err := os.ReadFile(name)
+			assert.Nil(t, err)
+			assert.NotContains(t, string(b), "customer")
+			assert.NotContains(t, string(b), "john doe")
+		}
+
+		store = NewDiskStorage(filename, NewOptions().SetEncryptionKey(testEncryptionKey))
+		res, err = store.Get([]byte("customer"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("john doe"), res)
+	})
+
+	t.Run("compressed and encrypted", func(t *testing.T) {
+		t.Parallel()
+
+		store, filename, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		options := NewOptions().
+			SetEncryptionKey(testEncryptionKey).
+			SetCompressor(GzipCompressor{}, "1KB")
+		store.WithOptions(options)
+
+		value := bytes.Repeat([]byte(`{"hello":"world"}`), 1000)
+		assert.Nil(t, store.Set([]byte("key"), value))
+
+		// hint files is not written, so key is decrypted from datafiles
+		store = NewDiskStorage(filename, options)
+		res, err := store.Get([]byte("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, res)
+	})
+
+	t.Run("open without encryption key", func(t *testing.T) {
+		t.Parallel()
+
+		store, filename, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetEncryptionKey(testEncryptionKey))
+		assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+
+		assert.Panics(t, func() {
+			NewDiskStorage(filename)
+		})
+		assert.Panics(t, func() {
+			NewDiskStorage(filename, NewOptions().SetEncryptionKey(testNewEncryptionKey))
+		})
+	})
+
+	t.Run("tampered datafiles", func(t *testing.T) {
+		t.Parallel()
+
+		fs := NewMemFileSystem()
+		store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetEncryptionKey(testEncryptionKey))
+		assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+
+		// flip the last byte of the value
+		f, err := fs.Open(store.dataFileName(0))
+		assert.Nil(t, err)
+		f.(*memFile).data.data[len(f.(*memFile).data.data)-1] ^= 0xff
+
+		_, err = store.Get([]byte("key"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("tampered flags", func(t *testing.T) {
+		t.Parallel()
+
+		fs := NewMemFileSystem()
+		store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetEncryptionKey(testEncryptionKey))
+		assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+
+		// mark the entry as merged, the checksum is updated so only the authentication can detect it
+		f, err := fs.Open(store.dataFileName(0))
+		assert.Nil(t, err)
+		data := f.(*memFile).data.data[dataFileHeaderLength:]
+		data[defaultHeaderLength-1] |= flagMerged
+		binary.LittleEndian.PutUint32(data, crc32.Checksum(data[checksumLength:], castagnoli))
+
+		_, err = store.Get([]byte("key"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("swapped key and value", func(t *testing.T) {
+		t.Parallel()
+
+		fs := NewMemFileSystem()
+		store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetEncryptionKey(testEncryptionKey))
+		// key and value of the same size have the same ciphertext size, so they can be swapped
+		assert.Nil(t, store.Set([]byte("same"), []byte("size")))
+
+		f, err := fs.Open(store.dataFileName(0))
+		assert.Nil(t, err)
+		data := f.(*memFile).data.data[dataFileHeaderLength:]
+		size := (len(data) - defaultHeaderLength) / 2
+		key := append([]byte{}, data[defaultHeaderLength:defaultHeaderLength+size]...)
+		copy(data[defaultHeaderLength:], data[defaultHeaderLength+size:])
+		copy(data[defaultHeaderLength+size:], key)
+		binary.LittleEndian.PutUint32(data, crc32.Checksum(data[checksumLength:], castagnoli))
+
+		_, err = store.Get([]byte("same"))
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+
+	t.Run("value of another entry", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()).SetEncryptionKey(testEncryptionKey))
+		defer store.Close()
+
+		// the entries have the same header, only the sealed key binds the value to its entry
+		first, second := newEntry(1, []byte("first"), []byte("value")), newEntry(1, []byte("second"), []byte("other"))
+		require.Nil(t, store.sealEntry(first))
+		require.Nil(t, store.sealEntry(second))
+		second.value = first.value
+		assert.ErrorIs(t, store.openEntry(second), errDecryption)
+		assert.Nil(t, store.openEntry(first))
+		assert.Equal(t, "value", string(first.value))
+	})
+
+	t.Run("rotate key using merge", func(t *testing.T) {
+		t.Parallel()
+
+		store, filename, cleanupFunc := initStorageHelper(t.Name(), "test")
+		defer cleanupFunc()
+		store.WithOptions(NewOptions().SetEncryptionKey(testEncryptionKey).SetMaxFileSize("1KB"))
+
+		kv := make(map[string][]byte)
+		for i := 0; i <= 100; i++ {
+			kv[strconv.Itoa(i)] = []byte(strconv.Itoa(i))
+		}
+		for k, v := range kv {
+			assert.Nil(t, store.Set([]byte(k), v))
+		}
+		assert.Nil(t, store.Close())
+
+		store = NewDiskStorage(filename, NewOptions().SetEncryptionKey(testNewEncryptionKey, testEncryptionKey))
+		assert.Nil(t, store.Merge())
+		assert.Nil(t, store.Close())
+
+		// old key is no longer needed after merge
+		store = NewDiskStorage(filename, NewOptions().SetEncryptionKey(testNewEncryptionKey))
+		for k, v := range kv {
+			res, err := store.Get([]byte(k))
+			assert.Nil(t, err)
+			assert.Equal(t, v, res)
+		}
+		assert.Panics(t, func() {
+			NewDiskStorage(filename, NewOptions().SetEncryptionKey(testEncryptionKey))
+		})
+	})
+}
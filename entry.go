@@ -1,5 +1,12 @@
 package caskdb
 
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 type entry struct {
 	header headerEntry
 	key    []byte
@@ -29,9 +36,31 @@ func (e *entry) encode() (int64, []byte) {
 	copy(data[len(headerByte):], e.key)
 	copy(data[len(headerByte)+len(e.key):], e.value)
 
+	e.header.checksum = crc32.Checksum(data[checksumLength:], castagnoli)
+	binary.LittleEndian.PutUint32(data, e.header.checksum)
+
 	return int64(length), data
 }
 
+// entryFits will return true if the entry of the header fits in the remaining
+// bytes, the sizes are checked one by one so corrupted sizes can't overflow
+func entryFits(h headerEntry, remaining int64) bool {
+	if remaining < defaultHeaderLength {
+		return false
+	}
+	remaining -= defaultHeaderLength
+	if h.keySize > uint64(remaining) {
+		return false
+	}
+
+	return h.valueSize <= uint64(remaining)-h.keySize
+}
+
+// validChecksum will return true if the checksum of the encoded entry matches its content
+func validChecksum(data []byte) bool {
+	return binary.LittleEndian.Uint32(data) == crc32.Checksum(data[checksumLength:], castagnoli)
+}
+
 func decodeEntry(data []byte) entry {
 	header := data[0:defaultHeaderLength]
 	h := decodeHeader(header)
@@ -53,3 +53,27 @@ func Test_encodeKV(t *testing.T) {
 		})
 	}
 }
+
+func Test_validChecksum(t *testing.T) {
+	t.Parallel()
+
+	_, data := newEntry(time.Now().UnixNano(), []byte("hello"), []byte("world")).encode()
+	assert.True(t, validChecksum(data))
+
+	// every byte after the checksum is covered, including the header
+	for _, i := range []int{checksumLength, defaultHeaderLength - 1, len(data) - 1} {
+		data[i] ^= 0xff
+		assert.False(t, validChecksum(data), "byte %d", i)
+		data[i] ^= 0xff
+	}
+}
+
+func Test_entryFits(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, entryFits(headerEntry{keySize: 5, valueSize: 5}, defaultHeaderLength+10))
+	assert.False(t, entryFits(headerEntry{keySize: 5, valueSize: 6}, defaultHeaderLength+10))
+	assert.False(t, entryFits(headerEntry{}, defaultHeaderLength-1))
+	// corrupted sizes must not overflow
+	assert.False(t, entryFits(headerEntry{keySize: 1, valueSize: ^uint64(0)}, defaultHeaderLength+10))
+}
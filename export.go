@@ -0,0 +1,90 @@
+package caskdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// exportRecord is a single line of the exported JSON Lines,
+// key and value are base64 encoded by encoding/json
+type exportRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	// Timestamp is when the record is written in unixnano
+	Timestamp int64 `json:"timestamp"`
+	// Expiry in unixnano, omitted if the record never expire
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// Export will write every live record as JSON Lines in ascending order of the key,
+// only a single value is kept in memory at a time. Records written during
+// the export might not be included. The records are read directly from the
+// datafiles, so the export doesn't call the hooks and isn't counted as Get
+func (s *DiskStorage) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, key := range s.sortedKeys() {
+		record, err := s.peekRecord(key)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = enc.Encode(exportRecord{
+			Key:       []byte(key),
+			Value:     record.Value,
+			Timestamp: record.Timestamp,
+			Expiry:    record.Expiry,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Import will write every record read from the JSON Lines written by Export,
+// keeping their timestamp and expiry. Expired records and records older than
+// the existing record of the key are skipped, so the timestamp of the key never
+// goes backwards. Records without timestamp are written with the current time
+func (s *DiskStorage) Import(r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for line := 1; ; line++ {
+		var record exportRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("import line %d: %w", line, err)
+		}
+		if len(record.Key) == 0 {
+			return fmt.Errorf("import line %d: key is required", line)
+		}
+
+		now := time.Now().UnixNano()
+		if record.Expiry != 0 && record.Expiry <= now {
+			continue
+		}
+		if record.Timestamp == 0 {
+			record.Timestamp = s.nextTimestamp()
+		}
+		if record.Value == nil {
+			record.Value = []byte{}
+		}
+
+		err := s.setRecord(context.Background(), record.Key, &Record{
+			Value:     record.Value,
+			Timestamp: record.Timestamp,
+			Expiry:    record.Expiry,
+		}, true)
+		if err != nil {
+			return fmt.Errorf("import line %d: %w", line, err)
+		}
+	}
+}
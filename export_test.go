@@ -0,0 +1,103 @@
+package caskdb
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage_Export(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	binary := []byte{0, 1, 0xff, '\n'}
+	assert.Nil(t, store.Set(binary, binary))
+	assert.Nil(t, store.SetWithTTL([]byte("ttl"), []byte("value"), time.Hour))
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))))
+	}
+	assert.Nil(t, store.Delete([]byte("0")))
+
+	// export doesn't call the hooks and isn't counted as get
+	hook := &tracingHook{}
+	store.WithOptions(NewOptions().AddHook(hook))
+	gets := store.Stats().Gets
+	var b bytes.Buffer
+	require.Nil(t, store.Export(&b))
+	assert.Empty(t, hook.take())
+	assert.Equal(t, gets, store.Stats().Gets)
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, 11)
+	// keys are exported in ascending order, binary key and value is base64 encoded
+	record, err := store.GetRecord(binary)
+	require.Nil(t, err)
+	assert.Equal(t, `{"key":"AAH/Cg==","value":"AAH/Cg==","timestamp":`+strconv.FormatInt(record.Timestamp, 10)+`}`, lines[0])
+	assert.Contains(t, lines[10], `"key":"dHRs"`)
+	assert.Contains(t, lines[10], `"expiry":`)
+
+	imported := NewDiskStorage("db/imported", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer imported.Close()
+	require.Nil(t, imported.Import(&b))
+
+	// every record is imported along with its timestamp and expiry
+	assert.Nil(t, store.IterateKeys(func(key []byte) error {
+		expected, err := store.GetRecord(key)
+		require.Nil(t, err)
+		actual, err := imported.GetRecord(key)
+		require.Nil(t, err)
+		assert.Equal(t, expected, actual)
+		return nil
+	}))
+	_, err = imported.Get([]byte("0"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestDiskStorage_Import(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano(), 10)
+	input := `{"key":"a2V5","value":"dmFsdWU="}
+{"key":"ZXhwaXJlZA==","value":"dmFsdWU=","timestamp":1,"expiry":` + expired + `}
+{"key":"ZW1wdHk="}
+`
+	before := time.Now().UnixNano()
+	require.Nil(t, store.Import(strings.NewReader(input)))
+
+	record, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, "value", string(record.Value))
+	assert.GreaterOrEqual(t, record.Timestamp, before)
+	_, err = store.Get([]byte("expired"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	res, err := store.Get([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Empty(t, res)
+
+	// record older than the existing one is skipped, so the timestamp never goes backwards
+	older := strconv.FormatInt(record.Timestamp-1, 10)
+	newer := strconv.FormatInt(record.Timestamp+1, 10)
+	require.Nil(t, store.Import(strings.NewReader(`{"key":"a2V5","value":"b2xk","timestamp":`+older+`}`)))
+	current, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, record, current)
+	require.Nil(t, store.Import(strings.NewReader(`{"key":"a2V5","value":"bmV3","timestamp":`+newer+`}`)))
+	current, err = store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, "new", string(current.Value))
+	assert.Equal(t, record.Timestamp+1, current.Timestamp)
+
+	err = store.Import(strings.NewReader(`{"key":"a2V5","value":"dmFsdWU="}` + "\n" + `{"value":"dmFsdWU="}`))
+	assert.EqualError(t, err, "import line 2: key is required")
+	err = store.Import(strings.NewReader(`{"key":"not base64"}`))
+	assert.ErrorContains(t, err, "import line 1")
+}
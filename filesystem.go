@@ -0,0 +1,142 @@
+package caskdb
+
+import (
+	"io"
+	"os"
+)
+
+// FileSystem abstract every file operation done by DiskStorage,
+// so the database can be stored somewhere other than the OS
+// filesystem, e.g. in memory for testing
+type FileSystem interface {
+	// OpenFile will open the named file for reading and appending,
+	// the file is created if it doesn't exist
+	OpenFile(name string) (File, error)
+	// Open will open existing file for reading, error wrapping
+	// os.ErrNotExist is returned if the file doesn't exist
+	Open(name string) (File, error)
+	Rename(oldName, newName string) error
+	Remove(name string) error
+	// List will return name (not the full path) of every files in the directory
+	List(dir string) ([]string, error)
+}
+
+// File is a file opened by FileSystem
+type File interface {
+	io.ReaderAt
+	// Write will always append the data to the end of the file
+	io.Writer
+	io.Closer
+	Sync() error
+	Size() (int64, error)
+}
+
+// OSFileSystem is FileSystem backed by the os package, it is used by default
+type OSFileSystem struct{}
+
+func (OSFileSystem) OpenFile(name string) (File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osFile{f}, nil
+}
+
+func (OSFileSystem) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osFile{f}, nil
+}
+
+func (OSFileSystem) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (OSFileSystem) Link(oldName, newName string) error {
+	return os.Link(oldName, newName)
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) List(dir string) ([]string, error) {
+	dirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if d.IsDir() {
+			continue
+		}
+		names = append(names, d.Name())
+	}
+
+	return names, nil
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f *osFile) Size() (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Size(), nil
+}
+
+// readFile will read the whole content of the named file
+func readFile(fs FileSystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	if _, err = f.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// writeFile will atomically replace the content of the named file
+// by writing to temporary files first, then rename it
+func writeFile(fs FileSystem, name string, data []byte) error {
+	tmpName := name + ".tmp"
+	if err := fs.Remove(tmpName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := fs.OpenFile(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return fs.Rename(tmpName, name)
+}
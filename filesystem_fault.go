@@ -0,0 +1,264 @@
+package caskdb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// FaultFileSystem wraps FileSystem to simulate disk failure and power loss,
+// it is meant for testing how DiskStorage survives such event.
+// File creation, rename and removal are considered durable immediately,
+// while written data is only durable after the file is synced
+type FaultFileSystem struct {
+	fs FileSystem
+
+	mu sync.Mutex
+	// synced is the durable size of each file opened through this filesystem
+	synced map[string]int64
+	// writeBudget is the remaining bytes can be written before writes
+	// start to fail, negative means unlimited
+	writeBudget  int64
+	writesFailed bool
+	failReads    bool
+	// generation is increased on power loss, files opened
+	// before it can't be used anymore
+	generation int
+}
+
+func NewFaultFileSystem(fs FileSystem) *FaultFileSystem {
+	return &FaultFileSystem{
+		fs:          fs,
+		synced:      make(map[string]int64),
+		writeBudget: -1,
+	}
+}
+
+// FailWritesAfter will make writes fail with EIO after n more bytes is written.
+// The write that exceeds the budget is partially written, and every write and
+// sync afterwards is failed until Heal or PowerLoss is called
+func (f *FaultFileSystem) FailWritesAfter(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writeBudget = n
+	f.writesFailed = false
+}
+
+// FailReads will make every read fail with EIO
+func (f *FaultFileSystem) FailReads(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failReads = fail
+}
+
+// Heal will remove every injected fault
+func (f *FaultFileSystem) Heal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writeBudget = -1
+	f.writesFailed = false
+	f.failReads = false
+}
+
+// PowerLoss will drop every data that hasn't been synced and invalidate
+// every opened files, as if the machine is restarted. Injected faults are
+// removed as well
+func (f *FaultFileSystem) PowerLoss() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.generation++
+	f.writeBudget = -1
+	f.writesFailed = false
+	f.failReads = false
+
+	for name, synced := range f.synced {
+		data, err := readFile(f.fs, name)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) <= synced {
+			continue
+		}
+
+		if err = f.fs.Remove(name); err != nil {
+			return err
+		}
+		file, err := f.fs.OpenFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(data[:synced]); err != nil {
+			return err
+		}
+		if err = file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FaultFileSystem) OpenFile(name string) (File, error) {
+	file, err := f.fs.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.track(name, file)
+}
+
+func (f *FaultFileSystem) Open(name string) (File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.track(name, file)
+}
+
+func (f *FaultFileSystem) Rename(oldName, newName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fs.Rename(oldName, newName); err != nil {
+		return err
+	}
+	if synced, exists := f.synced[oldName]; exists {
+		delete(f.synced, oldName)
+		f.synced[newName] = synced
+	}
+
+	return nil
+}
+
+func (f *FaultFileSystem) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fs.Remove(name); err != nil {
+		return err
+	}
+	delete(f.synced, name)
+
+	return nil
+}
+
+func (f *FaultFileSystem) List(dir string) ([]string, error) {
+	return f.fs.List(dir)
+}
+
+// track will register the file, existing data of the file is considered durable
+func (f *FaultFileSystem) track(name string, file File) (File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.synced[name]; !exists {
+		size, err := file.Size()
+		if err != nil {
+			return nil, err
+		}
+		f.synced[name] = size
+	}
+
+	return &faultFile{File: file, fs: f, name: name, generation: f.generation}, nil
+}
+
+type faultFile struct {
+	File
+	fs         *FaultFileSystem
+	name       string
+	generation int
+}
+
+// check will return error if the file is opened before power loss,
+// caller must hold the filesystem lock
+func (f *faultFile) check(op string) error {
+	if f.generation != f.fs.generation {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+
+	return nil
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if f.fs.failReads {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EIO}
+	}
+
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+
+	if f.fs.writesFailed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EIO}
+	}
+
+	budget := f.fs.writeBudget
+	if budget < 0 || int64(len(p)) <= budget {
+		if budget >= 0 {
+			f.fs.writeBudget -= int64(len(p))
+		}
+		return f.File.Write(p)
+	}
+
+	// short write, only part of the data is written
+	f.fs.writesFailed = true
+	n, err := f.File.Write(p[:budget])
+	if err != nil {
+		return n, err
+	}
+
+	return n, &os.PathError{Op: "write", Path: f.name, Err: fmt.Errorf("short write: %w", syscall.EIO)}
+}
+
+func (f *faultFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("sync"); err != nil {
+		return err
+	}
+	if f.fs.writesFailed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: syscall.EIO}
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+
+	size, err := f.File.Size()
+	if err != nil {
+		return err
+	}
+	f.fs.synced[f.name] = size
+
+	return nil
+}
+
+func (f *faultFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("close"); err != nil {
+		return err
+	}
+
+	return f.File.Close()
+}
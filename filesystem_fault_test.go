@@ -0,0 +1,239 @@
+package caskdb
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultFileSystem(t *testing.T) {
+	t.Parallel()
+
+	fs := NewFaultFileSystem(NewMemFileSystem())
+	f, err := fs.OpenFile("db/file")
+	assert.Nil(t, err)
+
+	_, err = f.Write([]byte("synced"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	_, err = f.Write([]byte("unsynced"))
+	assert.Nil(t, err)
+
+	fs.FailReads(true)
+	_, err = f.ReadAt(make([]byte, 1), 0)
+	assert.ErrorIs(t, err, syscall.EIO)
+	fs.FailReads(false)
+
+	fs.FailWritesAfter(2)
+	n, err := f.Write([]byte("short"))
+	assert.ErrorIs(t, err, syscall.EIO)
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, f.Sync(), syscall.EIO)
+
+	assert.Nil(t, fs.PowerLoss())
+	_, err = f.Write([]byte("stale handle"))
+	assert.Error(t, err)
+
+	b, err := readFile(fs, "db/file")
+	assert.Nil(t, err)
+	assert.Equal(t, "synced", string(b))
+}
+
+func TestDiskStorage_writeFailure(t *testing.T) {
+	t.Parallel()
+
+	fs := NewFaultFileSystem(NewMemFileSystem())
+	options := NewOptions().SetFileSystem(fs).SetSyncWrites(true)
+	store := NewDiskStorage("db/test", options)
+
+	assert.Nil(t, store.Set([]byte("before"), []byte("value")))
+
+	fs.FailWritesAfter(10)
+	assert.Error(t, store.Set([]byte("failed"), []byte("value")))
+	fs.Heal()
+
+	// entry written after the partially written entry must be readable after restart
+	assert.Nil(t, store.Set([]byte("after"), []byte("value")))
+	assert.Nil(t, fs.PowerLoss())
+
+	store = NewDiskStorage("db/test", options)
+	for _, key := range []string{"before", "after"} {
+		res, err := store.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), res)
+	}
+	_, err := store.Get([]byte("failed"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestDiskStorage_writeFailure_hintFiles(t *testing.T) {
+	t.Parallel()
+
+	t.Run("close", func(t *testing.T) {
+		t.Parallel()
+
+		fs := NewFaultFileSystem(NewMemFileSystem())
+		options := NewOptions().SetFileSystem(fs)
+		store := NewDiskStorage("db/test", options)
+		assert.Nil(t, store.Set([]byte("before"), []byte("value")))
+		fs.FailWritesAfter(10)
+		assert.Error(t, store.Set([]byte("failed"), []byte("value")))
+		fs.Heal()
+
+		// the failed datafile is rotated before the hint files is written
+		assert.Nil(t, store.Close())
+		assert.Equal(t, 1, store.activeFileID)
+		store = NewDiskStorage("db/test", options)
+		assert.Nil(t, store.Set([]byte("after"), []byte("value")))
+		assert.Equal(t, 1, store.activeFileID)
+		assert.Nil(t, store.Close())
+
+		// the keyDir is recovered from the datafiles without the hint files
+		assert.Nil(t, fs.Remove(store.hintFileName()))
+		store = NewDiskStorage("db/test", options)
+		for _, key := range []string{"before", "after"} {
+			res, err := store.Get([]byte(key))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("value"), res)
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		t.Parallel()
+
+		fs := NewFaultFileSystem(NewMemFileSystem())
+		options := NewOptions().SetFileSystem(fs)
+		store := NewDiskStorage("db/test", options)
+		assert.Nil(t, store.Set([]byte("before"), []byte("value")))
+		fs.FailWritesAfter(10)
+		assert.Error(t, store.Set([]byte("failed"), []byte("value")))
+		fs.Heal()
+
+		// the hint files is written without rotating the failed datafile, e.g. by older version
+		assert.Nil(t, store.flush())
+		store = NewDiskStorage("db/test", options)
+		assert.True(t, store.files[0].failed)
+		assert.Nil(t, store.Set([]byte("after"), []byte("value")))
+		assert.Equal(t, 1, store.activeFileID)
+
+		assert.Nil(t, fs.Remove(store.hintFileName()))
+		store = NewDiskStorage("db/test", options)
+		for _, key := range []string{"before", "after"} {
+			res, err := store.Get([]byte(key))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("value"), res)
+		}
+	})
+}
+
+func TestDiskStorage_readFailure(t *testing.T) {
+	t.Parallel()
+
+	fs := NewFaultFileSystem(NewMemFileSystem())
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs))
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+
+	fs.FailReads(true)
+	_, err := store.Get([]byte("key"))
+	assert.ErrorIs(t, err, syscall.EIO)
+
+	fs.FailReads(false)
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res)
+}
+
+// crashSeed is fixed, so the failure is reproducible, e.g. go test -run TestDiskStorage_crash -crash-seed 42
+var crashSeed = flag.Int64("crash-seed", 1, "seed of the random operations of TestDiskStorage_crash")
+
+// TestDiskStorage_crash will crash the storage at random point during Set, Delete
+// and Merge, then verify every acknowledged write is recovered after restart
+func TestDiskStorage_crash(t *testing.T) {
+	t.Parallel()
+
+	t.Logf("seed: %d", *crashSeed)
+	rnd := rand.New(rand.NewSource(*crashSeed))
+
+	fs := NewFaultFileSystem(NewMemFileSystem())
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB").SetSyncWrites(true)
+
+	// acknowledged is the last value that Set or Delete successfully written, while
+	// pending is the value of failed Set or Delete, which might or might not be durable.
+	// nil value means the key is deleted
+	acknowledged := make(map[string][]byte)
+	pending := make(map[string][]byte)
+
+	for crash := 0; crash < 100; crash++ {
+		store := NewDiskStorage("db/test", options)
+
+		for key, value := range acknowledged {
+			res, err := store.Get([]byte(key))
+			if pendingValue, exists := pending[key]; exists {
+				if (pendingValue == nil && errors.Is(err, ErrRecordNotFound)) ||
+					(pendingValue != nil && err == nil && string(res) == string(pendingValue)) {
+					acknowledged[key] = pendingValue
+					continue
+				}
+			}
+			if value == nil {
+				assert.ErrorIs(t, err, ErrRecordNotFound, "deleted key %s is back after crash %d", key, crash)
+				continue
+			}
+			if !assert.Nil(t, err, "key %s is lost after crash %d", key, crash) {
+				continue
+			}
+			assert.Equal(t, string(value), string(res), "key %s after crash %d", key, crash)
+		}
+		for key, value := range pending {
+			if _, exists := acknowledged[key]; exists {
+				continue
+			}
+			res, err := store.Get([]byte(key))
+			if value == nil {
+				assert.ErrorIs(t, err, ErrRecordNotFound)
+			} else if err == nil {
+				assert.Equal(t, string(value), string(res))
+				acknowledged[key] = res
+			}
+		}
+		pending = make(map[string][]byte)
+
+		fs.FailWritesAfter(rnd.Int63n(8 * 1024))
+		for {
+			if rnd.Intn(100) == 0 {
+				if err := store.Merge(); err != nil {
+					break
+				}
+				continue
+			}
+
+			key := strconv.Itoa(rnd.Intn(200))
+			if rnd.Intn(5) == 0 {
+				err := store.Delete([]byte(key))
+				if errors.Is(err, ErrRecordNotFound) {
+					assert.Nil(t, acknowledged[key], "key %s is not found before crash %d", key, crash)
+					continue
+				} else if err != nil {
+					pending[key] = nil
+					break
+				}
+				acknowledged[key] = nil
+				continue
+			}
+
+			value := []byte(strconv.Itoa(rnd.Int()))
+			if err := store.Set([]byte(key), value); err != nil {
+				pending[key] = value
+				break
+			}
+			acknowledged[key] = value
+		}
+
+		assert.Nil(t, fs.PowerLoss())
+	}
+}
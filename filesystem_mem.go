@@ -0,0 +1,184 @@
+package caskdb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var errFileClosed = errors.New("file already closed")
+
+// MemFileSystem is FileSystem that keep every file in memory,
+// it is useful for testing or embedded use where persistence
+// is not needed
+type MemFileSystem struct {
+	mu    sync.RWMutex
+	files map[string]*memFileData
+}
+
+type memFileData struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{files: make(map[string]*memFileData)}
+}
+
+func (m *MemFileSystem) OpenFile(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	data, exists := m.files[name]
+	if !exists {
+		data = &memFileData{}
+		m.files[name] = data
+	}
+
+	return &memFile{name: name, data: data}, nil
+}
+
+func (m *MemFileSystem) Open(name string) (File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name = path.Clean(name)
+	data, exists := m.files[name]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return &memFile{name: name, data: data, readOnly: true}, nil
+}
+
+func (m *MemFileSystem) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldName, newName = path.Clean(oldName), path.Clean(newName)
+	data, exists := m.files[oldName]
+	if !exists {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldName)
+	m.files[newName] = data
+
+	return nil
+}
+
+// Link will make newName share the data of oldName, like hard link
+func (m *MemFileSystem) Link(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldName, newName = path.Clean(oldName), path.Clean(newName)
+	data, exists := m.files[oldName]
+	if !exists {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+	if _, exists = m.files[newName]; exists {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: os.ErrExist}
+	}
+	m.files[newName] = data
+
+	return nil
+}
+
+func (m *MemFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if _, exists := m.files[name]; !exists {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+
+	return nil
+}
+
+func (m *MemFileSystem) List(dir string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dir = path.Clean(dir)
+	names := make([]string, 0)
+	for name := range m.files {
+		if path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// memFile is a handle of memFileData, the data is shared between handles
+type memFile struct {
+	name     string
+	data     *memFileData
+	readOnly bool
+	closed   int32
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errFileClosed}
+	}
+
+	f.data.mu.RLock()
+	defer f.data.mu.RUnlock()
+
+	if off >= int64(len(f.data.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errFileClosed}
+	}
+	if f.readOnly {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	f.data.data = append(f.data.data, p...)
+
+	return len(p), nil
+}
+
+func (f *memFile) Sync() error {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return &os.PathError{Op: "sync", Path: f.name, Err: errFileClosed}
+	}
+
+	return nil
+}
+
+func (f *memFile) Size() (int64, error) {
+	f.data.mu.RLock()
+	defer f.data.mu.RUnlock()
+
+	return int64(len(f.data.data)), nil
+}
+
+func (f *memFile) Close() error {
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return &os.PathError{Op: "close", Path: f.name, Err: errFileClosed}
+	}
+
+	return nil
+}
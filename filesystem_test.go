@@ -0,0 +1,119 @@
+package caskdb
+
+import (
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem(t *testing.T) {
+	t.Parallel()
+
+	osDir := path.Join("testdata", t.Name()+"_"+uuid.NewString())
+	assert.Nil(t, os.MkdirAll(osDir, 0777))
+	defer os.RemoveAll(osDir)
+
+	fileSystems := map[string]struct {
+		fs  FileSystem
+		dir string
+	}{
+		"os":     {fs: OSFileSystem{}, dir: osDir},
+		"memory": {fs: NewMemFileSystem(), dir: "db"},
+	}
+	for name, tt := range fileSystems {
+		fs, dir := tt.fs, tt.dir
+		t.Run(name, func(t *testing.T) {
+			filename := path.Join(dir, "file")
+
+			_, err := fs.Open(filename)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			f, err := fs.OpenFile(filename)
+			assert.Nil(t, err)
+			_, err = f.Write([]byte("hello "))
+			assert.Nil(t, err)
+			_, err = f.Write([]byte("world"))
+			assert.Nil(t, err)
+			assert.Nil(t, f.Sync())
+			size, err := f.Size()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(11), size)
+			assert.Nil(t, f.Close())
+
+			// reopening will append to the existing data
+			f, err = fs.OpenFile(filename)
+			assert.Nil(t, err)
+			_, err = f.Write([]byte("!"))
+			assert.Nil(t, err)
+
+			b := make([]byte, 6)
+			n, err := f.ReadAt(b, 6)
+			assert.Nil(t, err)
+			assert.Equal(t, 6, n)
+			assert.Equal(t, "world!", string(b))
+
+			n, err = f.ReadAt(b, 10)
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, 2, n)
+			assert.Nil(t, f.Close())
+
+			assert.Nil(t, writeFile(fs, path.Join(dir, "other"), []byte("content")))
+			content, err := readFile(fs, path.Join(dir, "other"))
+			assert.Nil(t, err)
+			assert.Equal(t, "content", string(content))
+
+			names, err := fs.List(dir)
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, []string{"file", "other"}, names)
+
+			assert.Nil(t, fs.Rename(filename, path.Join(dir, "renamed")))
+			assert.Nil(t, fs.Remove(path.Join(dir, "other")))
+			assert.ErrorIs(t, fs.Remove(path.Join(dir, "other")), os.ErrNotExist)
+
+			names, err = fs.List(dir)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"renamed"}, names)
+
+			// linked file share the content, and it is kept after the original is removed
+			linker := fs.(Linker)
+			assert.Nil(t, linker.Link(path.Join(dir, "renamed"), path.Join(dir, "linked")))
+			assert.ErrorIs(t, linker.Link(path.Join(dir, "renamed"), path.Join(dir, "linked")), os.ErrExist)
+			assert.Nil(t, fs.Remove(path.Join(dir, "renamed")))
+			content, err = readFile(fs, path.Join(dir, "linked"))
+			assert.Nil(t, err)
+			assert.Equal(t, "hello world!", string(content))
+		})
+	}
+}
+
+func TestDiskStorage_memFileSystem(t *testing.T) {
+	t.Parallel()
+
+	options := NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+
+	kv := make(map[string][]byte)
+	for i := 0; i <= 1_000; i++ {
+		kv[strconv.Itoa(i)] = []byte(strconv.Itoa(i))
+	}
+	for k, v := range kv {
+		assert.Nil(t, store.Set([]byte(k), v))
+	}
+	assert.Nil(t, store.Merge())
+	assert.Nil(t, store.Close())
+
+	_, err := os.Stat("db")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	store = NewDiskStorage("db/test", options)
+	for k, v := range kv {
+		res, err := store.Get([]byte(k))
+		assert.Nil(t, err)
+		assert.Equal(t, v, res)
+	}
+}
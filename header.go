@@ -4,33 +4,57 @@ import "encoding/binary"
 
 const (
 	// byte length of the header
-	defaultHeaderLength = 24
+	defaultHeaderLength = 38
+	// byte length of the checksum at the start of the header
+	checksumLength = 4
+)
+
+const (
+	// flagEncrypted mark the key and value of the entry is sealed using AES-GCM
+	flagEncrypted uint8 = 1 << iota
+	// flagTombstone mark the key is deleted
+	flagTombstone
+	// flagMerged mark the entry is rewritten by merge, it is not a new mutation
+	flagMerged
 )
 
 // headerEntry will hold header of an entry
 type headerEntry struct {
+	// checksum is CRC-32C of the rest of the entry, it is set by entry.encode
+	checksum  uint32
 	timestamp int64 // default is using time.UnixNano which produce int64
+	expiry    int64 // unixnano of when the entry is expired, 0 means never expire
 	keySize   uint64
 	valueSize uint64
+	codec     uint8 // id of the Compressor used for the value, see compression.go
+	flags     uint8
 }
 
-// Encode header of an entry. Each of header item is uint64 which
-// takes 8 Byte, so we need to allocate 24 Byte for the header
+// Encode header of an entry. The checksum takes 4 Byte, each of the other header item is uint64
+// which takes 8 Byte, plus 1 Byte each for the codec id and flags, so we need to allocate 38 Byte for the header
 // ref http://golang.org/ref/spec#Size_and_alignment_guarantees
-// | timestamp 8B | keySize 8B | valueSize 8B | -> total allocate 24 Byte
+// | checksum 4B | timestamp 8B | expiry 8B | keySize 8B | valueSize 8B | codec 1B | flags 1B | -> total allocate 38 Byte
 func (h *headerEntry) encode() []byte {
 	b := make([]byte, defaultHeaderLength)
-	binary.LittleEndian.PutUint64(b[0:], uint64(h.timestamp))
-	binary.LittleEndian.PutUint64(b[8:], h.keySize)
-	binary.LittleEndian.PutUint64(b[16:], h.valueSize)
+	binary.LittleEndian.PutUint32(b[0:], h.checksum)
+	binary.LittleEndian.PutUint64(b[4:], uint64(h.timestamp))
+	binary.LittleEndian.PutUint64(b[12:], uint64(h.expiry))
+	binary.LittleEndian.PutUint64(b[20:], h.keySize)
+	binary.LittleEndian.PutUint64(b[28:], h.valueSize)
+	b[36] = h.codec
+	b[37] = h.flags
 
 	return b
 }
 
 func decodeHeader(data []byte) headerEntry {
 	return headerEntry{
-		timestamp: int64(binary.LittleEndian.Uint64(data[0:])),
-		keySize:   binary.LittleEndian.Uint64(data[8:]),
-		valueSize: binary.LittleEndian.Uint64(data[16:]),
+		checksum:  binary.LittleEndian.Uint32(data[0:]),
+		timestamp: int64(binary.LittleEndian.Uint64(data[4:])),
+		expiry:    int64(binary.LittleEndian.Uint64(data[12:])),
+		keySize:   binary.LittleEndian.Uint64(data[20:]),
+		valueSize: binary.LittleEndian.Uint64(data[28:]),
+		codec:     data[36],
+		flags:     data[37],
 	}
 }
@@ -12,8 +12,11 @@ func Test_HeaderDecoding(t *testing.T) {
 
 	type args struct {
 		timestamp int64
+		expiry    int64
 		keySize   uint64
 		valueSize uint64
+		codec     uint8
+		flags     uint8
 	}
 	tests := []struct {
 		name string
@@ -43,19 +46,52 @@ func Test_HeaderDecoding(t *testing.T) {
 				valueSize: 4294967295,
 			},
 		},
+		{
+			name: "compressed value",
+			args: args{
+				timestamp: time.Now().Unix(),
+				keySize:   16,
+				valueSize: 512,
+				codec:     codecGzip,
+			},
+		},
+		{
+			name: "encrypted entry",
+			args: args{
+				timestamp: time.Now().Unix(),
+				keySize:   16 + minimumEncryptedDataBytes,
+				valueSize: 512 + minimumEncryptedDataBytes,
+				flags:     flagEncrypted,
+			},
+		},
+		{
+			name: "entry with expiry",
+			args: args{
+				timestamp: time.Now().UnixNano(),
+				expiry:    time.Now().Add(time.Hour).UnixNano(),
+				keySize:   16,
+				valueSize: 16,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			header := headerEntry{
 				timestamp: tt.args.timestamp,
+				expiry:    tt.args.expiry,
 				keySize:   tt.args.keySize,
 				valueSize: tt.args.valueSize,
+				codec:     tt.args.codec,
+				flags:     tt.args.flags,
 			}
 			b := header.encode()
 			headerRes := decodeHeader(b)
 			assert.Equal(t, tt.args.timestamp, headerRes.timestamp)
+			assert.Equal(t, tt.args.expiry, headerRes.expiry)
 			assert.Equal(t, tt.args.keySize, headerRes.keySize)
 			assert.Equal(t, tt.args.valueSize, headerRes.valueSize)
+			assert.Equal(t, tt.args.codec, headerRes.codec)
+			assert.Equal(t, tt.args.flags, headerRes.flags)
 			assert.Equal(t, defaultHeaderLength, len(b)) // encoded header should exactly 12 Byte in length
 		})
 	}
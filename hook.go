@@ -0,0 +1,48 @@
+package caskdb
+
+import "context"
+
+// Hook is called before and after the storage operations, e.g. to start a
+// tracing span in Before and end it in After, or to audit the writes. Hooks
+// are called in the order they are added, and After in the reverse order.
+// Rotation, merge and recovery are called while the storage is locked,
+// so the hook must not use the storage
+type Hook interface {
+	// Before is called before the operation, the returned context is passed
+	// to After and to the hooks of the operation done by this operation,
+	// e.g. rotation of the active datafile during Set
+	Before(ctx context.Context, info HookInfo) context.Context
+	// After is called once the operation is finished, err is the error
+	// returned by the operation, e.g. ErrRecordNotFound on Get
+	After(ctx context.Context, info HookInfo, err error)
+}
+
+// HookInfo describe the operation passed to Hook
+type HookInfo struct {
+	Operation Operation
+	// Key is the key of get, set and delete. It is shared with
+	// the caller, so it must not be modified or retained
+	Key []byte
+	// FileID is the new active datafile of rotation
+	FileID int
+}
+
+// runHooks will call Before of every hook, the returned function must be
+// called with the error of the operation to call After of every hook
+func (s *DiskStorage) runHooks(ctx context.Context, info HookInfo) (context.Context, func(err error)) {
+	if len(s.hooks) == 0 {
+		return ctx, func(error) {}
+	}
+
+	contexts := make([]context.Context, len(s.hooks))
+	for i, h := range s.hooks {
+		ctx = h.Before(ctx, info)
+		contexts[i] = ctx
+	}
+
+	return ctx, func(err error) {
+		for i := len(s.hooks) - 1; i >= 0; i-- {
+			s.hooks[i].After(contexts[i], info, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package caskdb
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+// span is a finished operation recorded by tracingHook
+type span struct {
+	name   string
+	parent string
+	key    string
+	fileID int
+	err    error
+}
+
+// tracingHook record every operation as span, the parent span is passed through the context
+type tracingHook struct {
+	mu    sync.Mutex
+	spans []span
+}
+
+func (h *tracingHook) Before(ctx context.Context, info HookInfo) context.Context {
+	parent, _ := ctx.Value(spanKey{}).(string)
+	return context.WithValue(ctx, spanKey{}, parent+"/"+string(info.Operation))
+}
+
+func (h *tracingHook) After(ctx context.Context, info HookInfo, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name := ctx.Value(spanKey{}).(string)
+	h.spans = append(h.spans, span{
+		name:   name,
+		parent: name[:len(name)-len(info.Operation)-1],
+		key:    string(info.Key),
+		fileID: info.FileID,
+		err:    err,
+	})
+}
+
+// take will return the recorded spans, and clear them
+func (h *tracingHook) take() []span {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	spans := h.spans
+	h.spans = nil
+
+	return spans
+}
+
+func TestOptions_AddHook(t *testing.T) {
+	t.Parallel()
+
+	hook := &tracingHook{}
+	store := NewDiskStorage("db/test", NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		SetMaxFileSize("1KB").
+		AddHook(hook))
+	defer store.Close()
+
+	spans := hook.take()
+	assert.Equal(t, []span{{name: "/recover"}}, spans)
+
+	_, err := store.Get([]byte("missing"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	spans = hook.take()
+	assert.Equal(t, []span{{name: "/get", key: "missing", err: err}}, spans)
+
+	// the rotation is traced as the child of the set that triggers it
+	var rotated []span
+	for i := 0; i < 50 && len(rotated) == 0; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+		spans = hook.take()
+		for _, s := range spans {
+			if s.parent != "" {
+				rotated = append(rotated, s)
+			}
+		}
+	}
+	require.Len(t, rotated, 1)
+	assert.Equal(t, span{name: "/set/rotate", parent: "/set", fileID: 1}, rotated[0])
+
+	assert.Nil(t, store.Delete([]byte("0")))
+	assert.Nil(t, store.Merge())
+	spans = hook.take()
+	assert.Equal(t, []span{{name: "/delete", key: "0"}, {name: "/merge"}}, spans)
+}
+
+// orderHook append its calls to the log shared by every hook
+type orderHook struct {
+	name string
+	log  *[]string
+}
+
+func (h orderHook) Before(ctx context.Context, info HookInfo) context.Context {
+	*h.log = append(*h.log, h.name+" before "+string(info.Operation))
+	return context.WithValue(ctx, spanKey{}, h.name)
+}
+
+func (h orderHook) After(ctx context.Context, info HookInfo, err error) {
+	*h.log = append(*h.log, h.name+" after "+string(info.Operation)+" with "+ctx.Value(spanKey{}).(string))
+}
+
+func TestOptions_AddHook_order(t *testing.T) {
+	t.Parallel()
+
+	log := make([]string, 0)
+	store := NewDiskStorage("db/test", NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		AddHook(orderHook{name: "first", log: &log}).
+		AddHook(orderHook{name: "second", log: &log}))
+	defer store.Close()
+
+	// Before is called in order, After in reverse order with the context returned by its Before
+	log = log[:0]
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Equal(t, []string{
+		"first before set",
+		"second before set",
+		"second after set with second",
+		"first after set with first",
+	}, log)
+}
+
+func TestDiskStorage_WithOptions_hooks(t *testing.T) {
+	t.Parallel()
+
+	log := make([]string, 0)
+	options := NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		AddHook(orderHook{name: "hook", log: &log})
+	store := NewDiskStorage("db/test", options)
+	defer store.Close()
+
+	// applying the same options again doesn't call the hook twice
+	store.WithOptions(options)
+	// options without hooks keeps the existing ones
+	store.WithOptions(NewOptions().SetMaxFileSize("1MB"))
+	log = log[:0]
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Equal(t, []string{"hook before set", "hook after set with hook"}, log)
+
+	store.WithOptions(NewOptions().AddHook(orderHook{name: "replaced", log: &log}))
+	log = log[:0]
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Equal(t, []string{"replaced before set", "replaced after set with replaced"}, log)
+}
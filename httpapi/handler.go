@@ -0,0 +1,516 @@
+// Package httpapi exposes caskdb.Store as HTTP/JSON REST API
+//
+//	GET    /keys/{key}        get the raw value
+//	PUT    /keys/{key}?ttl=1m set the value from the raw request body
+//	DELETE /keys/{key}        delete the key
+//	GET    /keys              list keys, see Handler.list for the parameters
+//	POST   /batch/get         get multiple keys
+//	POST   /batch/set         set multiple keys
+//	POST   /batch/delete      delete multiple keys
+//	GET    /stats             storage statistics
+//
+// Keys in the JSON request and response are strings, which can't carry binary key.
+// Add encoding=base64 query parameter to /keys and /batch/* to base64 encode every
+// key, including the list parameters and the cursor
+//
+// Every non 2xx response has JSON body {"error": "...", "code": "..."}, errors
+// returned by the store are written as
+//
+//	404 not_found  caskdb.ErrRecordNotFound
+//	409 read_only  caskdb.ErrReadOnly, the storage is a follower, write to the primary instead
+//	503 corrupted  caskdb.ErrCorrupted, the entry in the datafiles is not valid, it can be
+//	               read from another replica or recovered using repair
+//	500 internal   every other error
+package httpapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+const (
+	defaultMaxBodyBytes = 10 * 1024 * 1024
+	defaultListLimit    = 100
+	maxListLimit        = 1000
+)
+
+var (
+	errBodyTooLarge  = errors.New("request body too large")
+	errStopIteration = errors.New("stop iteration")
+)
+
+// Handler is http.Handler that serve the REST API
+type Handler struct {
+	store caskdb.Store
+	// MaxBodyBytes limit the size of request body, default is 10MB
+	MaxBodyBytes int64
+}
+
+func NewHandler(store caskdb.Store) *Handler {
+	return &Handler{
+		store:        store,
+		MaxBodyBytes: defaultMaxBodyBytes,
+	}
+}
+
+// errorResponse is the body of every non 2xx response
+type errorResponse struct {
+	Error string `json:"error"`
+	// Code is only set for the errors returned by the store, see the package doc
+	Code string `json:"code,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/keys" || r.URL.Path == "/keys/":
+		h.allow(w, r, http.MethodGet, h.list)
+	case strings.HasPrefix(r.URL.Path, "/keys/"):
+		switch r.Method {
+		case http.MethodGet:
+			h.get(w, r)
+		case http.MethodPut:
+			h.set(w, r)
+		case http.MethodDelete:
+			h.delete(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case r.URL.Path == "/batch/get":
+		h.allow(w, r, http.MethodPost, h.batchGet)
+	case r.URL.Path == "/batch/set":
+		h.allow(w, r, http.MethodPost, h.batchSet)
+	case r.URL.Path == "/batch/delete":
+		h.allow(w, r, http.MethodPost, h.batchDelete)
+	case r.URL.Path == "/stats":
+		h.allow(w, r, http.MethodGet, h.stats)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, method string, fn http.HandlerFunc) {
+	if r.Method != method {
+		methodNotAllowed(w, method)
+		return
+	}
+	fn(w, r)
+}
+
+// base64Keys will return true if the keys are base64 encoded, see the package doc
+func base64Keys(r *http.Request) (bool, error) {
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "":
+		return false, nil
+	case "base64":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+func encodeKey(key []byte, b64 bool) string {
+	if b64 {
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	return string(key)
+}
+
+func decodeKey(key string, b64 bool) ([]byte, error) {
+	if b64 {
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 key %q: %w", key, err)
+		}
+		return b, nil
+	}
+	return []byte(key), nil
+}
+
+// keyFromPath will return the key from /keys/{key}, the key can be percent-encoded
+func keyFromPath(r *http.Request) ([]byte, error) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), "/keys/")
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(key), nil
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	key, err := keyFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	value, err := h.store.Get(key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+func (h *Handler) set(w http.ResponseWriter, r *http.Request) {
+	key, err := keyFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var ttl time.Duration
+	if rawTTL := r.URL.Query().Get("ttl"); rawTTL != "" {
+		ttl, err = time.ParseDuration(rawTTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl %q", rawTTL))
+			return
+		}
+	}
+
+	value, err := h.readBody(r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if ttl > 0 {
+		err = h.store.SetWithTTL(key, value, ttl)
+	} else {
+		err = h.store.Set(key, value)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	key, err := keyFromPath(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = h.store.Delete(key); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listItem value is only included when the values parameter is true,
+// it is encoded as base64 since it might be binary
+type listItem struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type listResponse struct {
+	Items []listItem `json:"items"`
+	// Next is passed as after parameter to get the next page,
+	// it is empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// list will return keys in ascending order, the parameters are
+//
+//	prefix: only return key with this prefix
+//	start:  only return key >= start
+//	end:    only return key < end
+//	after:  only return key > after, used for pagination
+//	limit:  maximum number of keys returned, default 100, maximum 1000
+//	values: include the value if it is true
+//
+// prefix, start, end and after are base64 encoded like the keys with encoding=base64
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	b64, err := base64Keys(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	var params [4][]byte
+	for i, name := range []string{"prefix", "start", "end", "after"} {
+		if params[i], err = decodeKey(query.Get(name), b64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+	}
+	prefix, start, end, after := params[0], params[1], params[2], params[3]
+
+	limit := defaultListLimit
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+	}
+	withValues, _ := strconv.ParseBool(query.Get("values"))
+
+	res := listResponse{Items: make([]listItem, 0)}
+	var last []byte
+	err = h.store.IterateKeys(func(key []byte) error {
+		if !bytes.HasPrefix(key, prefix) || bytes.Compare(key, start) < 0 ||
+			(len(after) > 0 && bytes.Compare(key, after) <= 0) {
+			return nil
+		}
+		if len(end) > 0 && bytes.Compare(key, end) >= 0 {
+			return errStopIteration
+		}
+		if len(res.Items) == limit {
+			res.Next = encodeKey(last, b64)
+			return errStopIteration
+		}
+
+		item := listItem{Key: encodeKey(key, b64)}
+		if withValues {
+			value, err := h.store.Get(key)
+			if errors.Is(err, caskdb.ErrRecordNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			item.Value = value
+		}
+		res.Items = append(res.Items, item)
+		last = append(last[:0], key...)
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type batchKeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// decodeKeys will decode the keys of the batch request, see the package doc
+func decodeKeys(r *http.Request, keys []string) ([][]byte, error) {
+	b64, err := base64Keys(r)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([][]byte, len(keys))
+	for i, key := range keys {
+		if decoded[i], err = decodeKey(key, b64); err != nil {
+			return nil, err
+		}
+	}
+
+	return decoded, nil
+}
+
+type batchGetResponse struct {
+	// Values is nil for key that doesn't exist
+	Values map[string][]byte `json:"values"`
+}
+
+func (h *Handler) batchGet(w http.ResponseWriter, r *http.Request) {
+	var req batchKeysRequest
+	if err := h.decodeBody(r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	keys, err := decodeKeys(r, req.Keys)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the key in the request is used as is, so it is encoded like the request
+	res := batchGetResponse{Values: make(map[string][]byte, len(req.Keys))}
+	for i, key := range keys {
+		value, err := h.store.Get(key)
+		if err != nil && !errors.Is(err, caskdb.ErrRecordNotFound) {
+			writeStoreError(w, err)
+			return
+		}
+		res.Values[req.Keys[i]] = value
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type batchSetRequest struct {
+	Items []struct {
+		Key   string `json:"key"`
+		Value []byte `json:"value"` // base64 encoded
+		TTL   string `json:"ttl,omitempty"`
+	} `json:"items"`
+}
+
+// batchSet is not atomic, items before the failed one is already set
+func (h *Handler) batchSet(w http.ResponseWriter, r *http.Request) {
+	var req batchSetRequest
+	if err := h.decodeBody(r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	rawKeys := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		rawKeys[i] = item.Key
+	}
+	keys, err := decodeKeys(r, rawKeys)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ttls := make([]time.Duration, len(req.Items))
+	for i, item := range req.Items {
+		if item.TTL == "" {
+			continue
+		}
+		ttl, err := time.ParseDuration(item.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl %q of key %q", item.TTL, item.Key))
+			return
+		}
+		ttls[i] = ttl
+	}
+
+	for i, item := range req.Items {
+		var err error
+		if ttls[i] > 0 {
+			err = h.store.SetWithTTL(keys[i], item.Value, ttls[i])
+		} else {
+			err = h.store.Set(keys[i], item.Value)
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type batchDeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func (h *Handler) batchDelete(w http.ResponseWriter, r *http.Request) {
+	var req batchKeysRequest
+	if err := h.decodeBody(r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	keys, err := decodeKeys(r, req.Keys)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var res batchDeleteResponse
+	for _, key := range keys {
+		err := h.store.Delete(key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		res.Deleted++
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.store.(interface{ Stats() caskdb.Stats })
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("store doesn't support stats"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.Stats())
+}
+
+// readBody will read the whole body, errBodyTooLarge is
+// returned if it is larger than MaxBodyBytes
+func (h *Handler) readBody(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, h.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > h.MaxBodyBytes {
+		return nil, errBodyTooLarge
+	}
+
+	return b, nil
+}
+
+func (h *Handler) decodeBody(r *http.Request, v interface{}) error {
+	b, err := h.readBody(r)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	writeError(w, http.StatusBadRequest, err)
+}
+
+// writeStoreError will write the error returned by the store
+// with the status and code documented in the package doc
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, caskdb.ErrRecordNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error(), Code: "not_found"})
+	case errors.Is(err, caskdb.ErrReadOnly):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error(), Code: "read_only"})
+	case errors.Is(err, caskdb.ErrCorrupted):
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error(), Code: "corrupted"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error(), Code: "internal"})
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,329 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *Handler) {
+	store := caskdb.NewDiskStorage("db/test", caskdb.NewOptions().SetFileSystem(caskdb.NewMemFileSystem()))
+	handler := NewHandler(store)
+	server := httptest.NewServer(handler)
+
+	t.Cleanup(func() {
+		server.Close()
+		assert.Nil(t, store.Close())
+	})
+
+	return server, handler
+}
+
+func do(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.Nil(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	require.Nil(t, err)
+
+	return res.StatusCode, string(b)
+}
+
+func TestHandler_keys(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	status, _ := do(t, http.MethodPut, server.URL+"/keys/hello", "world")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, body := do(t, http.MethodGet, server.URL+"/keys/hello", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "world", body)
+
+	// key is percent-encoded
+	status, _ = do(t, http.MethodPut, server.URL+"/keys/a%2Fb%20c", "slash")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, body = do(t, http.MethodGet, server.URL+"/keys/a%2Fb%20c", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "slash", body)
+
+	status, _ = do(t, http.MethodDelete, server.URL+"/keys/hello", "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, body = do(t, http.MethodGet, server.URL+"/keys/hello", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.JSONEq(t, fmt.Sprintf(`{"error": %q, "code": "not_found"}`, caskdb.ErrRecordNotFound.Error()), body)
+
+	status, _ = do(t, http.MethodDelete, server.URL+"/keys/hello", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = do(t, http.MethodPost, server.URL+"/keys/hello", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	status, _ = do(t, http.MethodGet, server.URL+"/unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// failingStore returns err from every operation
+type failingStore struct {
+	caskdb.Store
+	err error
+}
+
+func (s failingStore) Get([]byte) ([]byte, error) { return nil, s.err }
+func (s failingStore) Set(_, _ []byte) error      { return s.err }
+func (s failingStore) Delete([]byte) error        { return s.err }
+
+func TestHandler_storeErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"read only", caskdb.ErrReadOnly, http.StatusConflict, "read_only"},
+		{"corrupted", fmt.Errorf("%w: checksum mismatch", caskdb.ErrCorrupted), http.StatusServiceUnavailable, "corrupted"},
+		{"internal", errors.New("disk failure"), http.StatusInternalServerError, "internal"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(NewHandler(failingStore{err: tt.err}))
+			defer server.Close()
+
+			expected := fmt.Sprintf(`{"error": %q, "code": %q}`, tt.err.Error(), tt.code)
+			for _, req := range []struct{ method, path, body string }{
+				{http.MethodGet, "/keys/key", ""},
+				{http.MethodPut, "/keys/key", "value"},
+				{http.MethodDelete, "/keys/key", ""},
+				{http.MethodPost, "/batch/set", `{"items": [{"key": "key", "value": "dmFsdWU="}]}`},
+			} {
+				status, body := do(t, req.method, server.URL+req.path, req.body)
+				assert.Equal(t, tt.status, status, req.method+" "+req.path)
+				assert.JSONEq(t, expected, body, req.method+" "+req.path)
+			}
+		})
+	}
+}
+
+func TestHandler_ttl(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	status, _ := do(t, http.MethodPut, server.URL+"/keys/key?ttl=invalid", "value")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, http.MethodPut, server.URL+"/keys/key?ttl=-1s", "value")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = do(t, http.MethodPut, server.URL+"/keys/key?ttl=50ms", "value")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do(t, http.MethodGet, server.URL+"/keys/key", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	time.Sleep(100 * time.Millisecond)
+	status, _ = do(t, http.MethodGet, server.URL+"/keys/key", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestHandler_bodyLimit(t *testing.T) {
+	t.Parallel()
+
+	server, handler := newTestServer(t)
+	handler.MaxBodyBytes = 10
+
+	status, _ := do(t, http.MethodPut, server.URL+"/keys/key", strings.Repeat("a", 10))
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, _ = do(t, http.MethodPut, server.URL+"/keys/key", strings.Repeat("a", 11))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	status, _ = do(t, http.MethodPost, server.URL+"/batch/get", `{"keys": ["key", "other"]}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestHandler_list(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+	for _, key := range []string{"a", "b", "user:1", "user:2", "user:3", "user:4", "z"} {
+		status, _ := do(t, http.MethodPut, server.URL+"/keys/"+key, "value-"+key)
+		require.Equal(t, http.StatusNoContent, status)
+	}
+
+	list := func(query string) listResponse {
+		status, body := do(t, http.MethodGet, server.URL+"/keys?"+query, "")
+		require.Equal(t, http.StatusOK, status, body)
+
+		var res listResponse
+		require.Nil(t, json.Unmarshal([]byte(body), &res))
+		return res
+	}
+	keys := func(res listResponse) []string {
+		keys := make([]string, 0, len(res.Items))
+		for _, item := range res.Items {
+			keys = append(keys, item.Key)
+		}
+		return keys
+	}
+
+	res := list("")
+	assert.Equal(t, []string{"a", "b", "user:1", "user:2", "user:3", "user:4", "z"}, keys(res))
+	assert.Empty(t, res.Next)
+	assert.Nil(t, res.Items[0].Value)
+
+	res = list("prefix=user:&values=true")
+	assert.Equal(t, []string{"user:1", "user:2", "user:3", "user:4"}, keys(res))
+	assert.Equal(t, "value-user:1", string(res.Items[0].Value))
+
+	res = list("start=b&end=user:3")
+	assert.Equal(t, []string{"b", "user:1", "user:2"}, keys(res))
+
+	// paginate through the prefix
+	res = list("prefix=user:&limit=3")
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys(res))
+	assert.Equal(t, "user:3", res.Next)
+	res = list("prefix=user:&limit=3&after=" + res.Next)
+	assert.Equal(t, []string{"user:4"}, keys(res))
+	assert.Empty(t, res.Next)
+
+	res = list("prefix=missing")
+	assert.Empty(t, res.Items)
+
+	status, _ := do(t, http.MethodGet, server.URL+"/keys?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, http.MethodGet, server.URL+"/keys?limit=1001", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHandler_base64Keys(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+	// the keys are not valid UTF-8, so they can't be written as JSON string
+	for _, key := range []string{"\xff\x00a", "\xff\x00b", "\xfe"} {
+		status, _ := do(t, http.MethodPut, server.URL+"/keys/"+url.PathEscape(key), "value")
+		require.Equal(t, http.StatusNoContent, status)
+	}
+	encode := func(key string) string {
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	list := func(query string) listResponse {
+		status, body := do(t, http.MethodGet, server.URL+"/keys?encoding=base64&"+query, "")
+		require.Equal(t, http.StatusOK, status, body)
+
+		var res listResponse
+		require.Nil(t, json.Unmarshal([]byte(body), &res))
+		return res
+	}
+
+	res := list("prefix=" + url.QueryEscape(encode("\xff\x00")) + "&limit=1")
+	require.Len(t, res.Items, 1)
+	assert.Equal(t, encode("\xff\x00a"), res.Items[0].Key)
+	assert.Equal(t, encode("\xff\x00a"), res.Next)
+	res = list("prefix=" + url.QueryEscape(encode("\xff\x00")) + "&after=" + url.QueryEscape(res.Next))
+	require.Len(t, res.Items, 1)
+	assert.Equal(t, encode("\xff\x00b"), res.Items[0].Key)
+	assert.Empty(t, res.Next)
+
+	status, body := do(t, http.MethodPost, server.URL+"/batch/get?encoding=base64",
+		fmt.Sprintf(`{"keys": [%q, %q]}`, encode("\xfe"), encode("\xfd")))
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, fmt.Sprintf(`{"values": {%q: "dmFsdWU=", %q: null}}`, encode("\xfe"), encode("\xfd")), body)
+
+	status, body = do(t, http.MethodPost, server.URL+"/batch/set?encoding=base64",
+		fmt.Sprintf(`{"items": [{"key": %q, "value": "dmFsdWU="}]}`, encode("\xfd")))
+	assert.Equal(t, http.StatusNoContent, status, body)
+	status, body = do(t, http.MethodPost, server.URL+"/batch/delete?encoding=base64",
+		fmt.Sprintf(`{"keys": [%q, %q]}`, encode("\xfd"), encode("\xfe")))
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"deleted": 2}`, body)
+
+	status, _ = do(t, http.MethodGet, server.URL+"/keys?encoding=base64&after=not-base64", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, http.MethodGet, server.URL+"/keys?encoding=hex", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, http.MethodPost, server.URL+"/batch/get?encoding=base64", `{"keys": ["not-base64"]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHandler_batch(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+
+	// value is base64 encoded, "dmFsdWU=" is "value"
+	status, body := do(t, http.MethodPost, server.URL+"/batch/set",
+		`{"items": [{"key": "a", "value": "dmFsdWU="}, {"key": "b", "value": "dmFsdWU=", "ttl": "1h"}]}`)
+	assert.Equal(t, http.StatusNoContent, status, body)
+
+	status, body = do(t, http.MethodPost, server.URL+"/batch/get", `{"keys": ["a", "b", "c"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"values": {"a": "dmFsdWU=", "b": "dmFsdWU=", "c": null}}`, body)
+
+	status, body = do(t, http.MethodPost, server.URL+"/batch/delete", `{"keys": ["a", "c"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"deleted": 1}`, body)
+
+	status, _ = do(t, http.MethodGet, server.URL+"/keys/a", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// invalid ttl will reject the whole batch
+	status, _ = do(t, http.MethodPost, server.URL+"/batch/set",
+		`{"items": [{"key": "c", "value": "dmFsdWU="}, {"key": "d", "value": "dmFsdWU=", "ttl": "invalid"}]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, http.MethodGet, server.URL+"/keys/c", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = do(t, http.MethodPost, server.URL+"/batch/get", `not json`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = do(t, http.MethodGet, server.URL+"/batch/get", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
+
+func TestHandler_stats(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		status, _ := do(t, http.MethodPut, fmt.Sprintf("%s/keys/%d", server.URL, i), "value")
+		require.Equal(t, http.StatusNoContent, status)
+	}
+
+	status, body := do(t, http.MethodGet, server.URL+"/stats", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	var stats caskdb.Stats
+	require.Nil(t, json.Unmarshal([]byte(body), &stats))
+	assert.Equal(t, 3, stats.KeyCount)
+	assert.Equal(t, 1, stats.FileCount)
+
+	// memory storage doesn't have stats
+	memory := httptest.NewServer(NewHandler(caskdb.NewMemoryStorage()))
+	defer memory.Close()
+	status, _ = do(t, http.MethodGet, memory.URL+"/stats", "")
+	assert.Equal(t, http.StatusNotImplemented, status)
+}
@@ -0,0 +1,111 @@
+package caskdb
+
+import (
+	"errors"
+	"io"
+)
+
+// DataFileRecord is the raw layout of an entry in the datafile, the key
+// and value are as stored, i.e. they might be encrypted or compressed
+type DataFileRecord struct {
+	Offset    int64    `json:"offset"`
+	Size      int64    `json:"size"` // size of the whole entry including the header
+	Timestamp int64    `json:"timestamp"`
+	Expiry    int64    `json:"expiry,omitempty"`
+	KeySize   uint64   `json:"key_size"`
+	ValueSize uint64   `json:"value_size"`
+	Codec     uint8    `json:"codec"`
+	Flags     []string `json:"flags"`
+	Checksum  uint32   `json:"checksum"`
+	// ChecksumOK is false when the entry doesn't match its checksum
+	ChecksumOK bool `json:"checksum_ok"`
+	// Truncated is set when the entry exceeds the end of the datafile,
+	// Size is the remaining bytes of the datafile and there is no key
+	// or value, since the sizes in the header can't be trusted
+	Truncated bool   `json:"truncated,omitempty"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+}
+
+var flagNames = []struct {
+	flag uint8
+	name string
+}{
+	{flagEncrypted, "encrypted"},
+	{flagTombstone, "tombstone"},
+	{flagMerged, "merged"},
+}
+
+// InspectDataFile will call fn with every entry of the datafile in order, the
+// next entry is read right after the entry even if its checksum doesn't match,
+// so the datafile can be examined without a hex editor. Inspection stops at the
+// truncated entry, or when fn returns an error
+func InspectDataFile(name string, fn func(record DataFileRecord) error, options ...*Options) error {
+	fs := optionsFileSystem(options)
+	file, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size, err := file.Size()
+	if err != nil {
+		return err
+	}
+
+	fileHeader := make([]byte, dataFileHeaderLength)
+	if size < dataFileHeaderLength {
+		fileHeader = fileHeader[:size]
+	}
+	if _, err = file.ReadAt(fileHeader, 0); err != nil {
+		return err
+	}
+	if err = checkDataFileHeader(fileHeader); err != nil {
+		return err
+	}
+
+	header := make([]byte, defaultHeaderLength)
+	offset := int64(dataFileHeaderLength)
+	for offset < size {
+		if size-offset < defaultHeaderLength {
+			return fn(DataFileRecord{Offset: offset, Size: size - offset, Truncated: true})
+		}
+		if _, err = file.ReadAt(header, offset); err != nil {
+			return err
+		}
+		h := decodeHeader(header)
+		record := DataFileRecord{
+			Offset:    offset,
+			Timestamp: h.timestamp,
+			Expiry:    h.expiry,
+			KeySize:   h.keySize,
+			ValueSize: h.valueSize,
+			Codec:     h.codec,
+			Flags:     make([]string, 0),
+			Checksum:  h.checksum,
+		}
+		for _, f := range flagNames {
+			if h.flags&f.flag != 0 {
+				record.Flags = append(record.Flags, f.name)
+			}
+		}
+		if !entryFits(h, size-offset) {
+			record.Size, record.Truncated = size-offset, true
+			return fn(record)
+		}
+
+		record.Size = int64(defaultHeaderLength + h.keySize + h.valueSize)
+		data := make([]byte, record.Size)
+		if _, err = file.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		record.ChecksumOK = validChecksum(data)
+		dataEntry := decodeEntry(data)
+		record.Key, record.Value = dataEntry.key, dataEntry.value
+		if err = fn(record); err != nil {
+			return err
+		}
+		offset += record.Size
+	}
+
+	return nil
+}
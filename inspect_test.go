@@ -0,0 +1,64 @@
+package caskdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectDataFile(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs)
+	store := NewDiskStorage("db/test", options)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, store.SetWithTTL([]byte("ttl"), []byte("value"), time.Hour))
+	assert.Nil(t, store.Delete([]byte("key")))
+	assert.Nil(t, store.Set([]byte("last"), []byte("value")))
+	assert.Nil(t, store.Close())
+
+	data := fs.files["db/test_0"]
+	// the value of the second entry is corrupted, and the last entry is truncated
+	data.data[dataFileHeaderLength+2*defaultHeaderLength+len("keyvalue")+len("ttl")] ^= 0xff
+	data.data = data.data[:len(data.data)-1]
+
+	records := make([]DataFileRecord, 0)
+	err := InspectDataFile("db/test_0", func(record DataFileRecord) error {
+		records = append(records, record)
+		return nil
+	}, options)
+	require.Nil(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, int64(dataFileHeaderLength), records[0].Offset)
+	assert.Equal(t, int64(defaultHeaderLength+len("keyvalue")), records[0].Size)
+	assert.Equal(t, "key", string(records[0].Key))
+	assert.Equal(t, "value", string(records[0].Value))
+	assert.Empty(t, records[0].Flags)
+	assert.True(t, records[0].ChecksumOK)
+
+	assert.Equal(t, records[0].Offset+records[0].Size, records[1].Offset)
+	assert.NotZero(t, records[1].Expiry)
+	assert.False(t, records[1].ChecksumOK)
+
+	assert.Equal(t, []string{"tombstone"}, records[2].Flags)
+	assert.True(t, records[2].ChecksumOK)
+
+	assert.True(t, records[3].Truncated)
+	assert.Equal(t, uint64(len("last")), records[3].KeySize)
+	assert.Nil(t, records[3].Key)
+
+	// inspection stops at the error of fn
+	stop := errors.New("stop")
+	calls := 0
+	err = InspectDataFile("db/test_0", func(record DataFileRecord) error {
+		calls++
+		return stop
+	}, options)
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
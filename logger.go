@@ -0,0 +1,69 @@
+package caskdb
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+// Logger is the structured logger used by DiskStorage, args are alternating
+// keys and values. It is implemented by *slog.Logger on Go 1.21+, and zap
+// logger can be used through NewZapLogger
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// NewZapLogger will return Logger that writes to the zap logger
+func NewZapLogger(logger *zap.Logger) Logger {
+	return zapLogger{logger.Sugar()}
+}
+
+type zapLogger struct {
+	logger *zap.SugaredLogger
+}
+
+func (l zapLogger) Debug(msg string, args ...any) {
+	l.logger.Debugw(msg, args...)
+}
+
+func (l zapLogger) Info(msg string, args ...any) {
+	l.logger.Infow(msg, args...)
+}
+
+func (l zapLogger) Warn(msg string, args ...any) {
+	l.logger.Warnw(msg, args...)
+}
+
+func (l zapLogger) Error(msg string, args ...any) {
+	l.logger.Errorw(msg, args...)
+}
+
+// defaultLogger is used when the logger is not set, it writes
+// JSON to stdout, and only the errors are logged
+func defaultLogger() Logger {
+	rawJSON := []byte(`{
+   "level": "error",
+   "encoding": "json",
+   "outputPaths": ["stdout"],
+   "errorOutputPaths": ["stderr"],
+   "encoderConfig": {
+     "messageKey": "message",
+     "levelKey": "level",
+     "levelEncoder": "lowercase"
+   }
+ }`)
+
+	var cfg zap.Config
+	if err := json.Unmarshal(rawJSON, &cfg); err != nil {
+		panic(err)
+	}
+	logger, err := cfg.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return NewZapLogger(logger)
+}
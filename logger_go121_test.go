@@ -0,0 +1,12 @@
+//go:build go1.21
+
+package caskdb
+
+import "log/slog"
+
+// the module supports Go versions without log/slog, so the
+// assertions are only compiled where it is available
+var (
+	_ Logger = zapLogger{}
+	_ Logger = (*slog.Logger)(nil)
+)
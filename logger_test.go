@@ -0,0 +1,104 @@
+package caskdb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type logEntry struct {
+	level string
+	msg   string
+	args  []any
+}
+
+// recordingLogger keep every logged entry
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) log(level, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, args: args})
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.log("debug", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.log("info", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.log("warn", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.log("error", msg, args) }
+
+// messages will return the logged messages of the level, and clear every entry
+func (l *recordingLogger) messages(level string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	messages := make([]string, 0)
+	for _, e := range l.entries {
+		if e.level == level {
+			messages = append(messages, e.msg)
+		}
+	}
+	l.entries = nil
+
+	return messages
+}
+
+func TestOptions_SetLogger(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{}
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB").SetLogger(logger)
+	store := NewDiskStorage("db/test", options)
+	assert.Equal(t, []string{"keyDir is recovered from the datafiles"}, logger.messages("info"))
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	assert.Contains(t, logger.messages("info"), "active datafile is rotated")
+
+	assert.Nil(t, store.Merge())
+	messages := logger.messages("info")
+	assert.Equal(t, "merge is started", messages[0])
+	assert.Equal(t, "merge is finished", messages[len(messages)-1])
+	assert.Nil(t, store.Close())
+
+	store = NewDiskStorage("db/test", options)
+	assert.Equal(t, []string{"keyDir is loaded from the hint files"}, logger.messages("info"))
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	// the hint files is stale once the datafiles is changed without closing the storage
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	assert.Equal(t, []string{
+		"hint files is stale, the datafile is changed",
+		"keyDir is recovered from the datafiles",
+	}, logger.messages("info"))
+}
+
+func TestNewZapLogger(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewZapLogger(zap.New(core))
+	logger.Debug("debug", "fileID", 1)
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error", "error", assert.AnError)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 4)
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, map[string]interface{}{"fileID": int64(1)}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	assert.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	assert.Equal(t, zapcore.ErrorLevel, entries[3].Level)
+	assert.Equal(t, "error", entries[3].Message)
+}
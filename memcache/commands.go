@@ -0,0 +1,396 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+const (
+	maxKeyLength = 250
+	// flagsLength is the length of client flags prefix in the stored value
+	flagsLength = 4
+	// maxRelativeExptime is 30 days, exptime larger than this is unix timestamp
+	maxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+// protocolError is error reply that is written as is
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+var (
+	errUnknownCommand = protocolError("ERROR")
+	errBadFormat      = protocolError("CLIENT_ERROR bad command line format")
+	errBadDataChunk   = protocolError("CLIENT_ERROR bad data chunk")
+	errTooLarge       = protocolError("SERVER_ERROR object too large for cache")
+	errNonNumeric     = protocolError("CLIENT_ERROR cannot increment or decrement non-numeric value")
+	errInvalidValue   = protocolError("SERVER_ERROR value is not written by memcache protocol")
+)
+
+// status is returned from the Update callback to abort the update,
+// it is written as the reply of the command
+type status string
+
+func (s status) Error() string {
+	return string(s)
+}
+
+// Unwrap will return caskdb.ErrUpdateAborted, so the observer
+// doesn't count the status reply as failed operation
+func (s status) Unwrap() error {
+	return caskdb.ErrUpdateAborted
+}
+
+const (
+	statusNotStored status = "NOT_STORED"
+	statusNotFound  status = "NOT_FOUND"
+	statusExists    status = "EXISTS"
+)
+
+// client is the state of a single connection
+type client struct {
+	store         Store
+	maxValueBytes int
+	r             *bufio.Reader
+	w             *bufio.Writer
+	// noreply suppress the reply of the current command, except error
+	noreply bool
+}
+
+// execute will run the command line and write its reply, it returns
+// true if the connection should be closed
+func (c *client) execute(line []byte) bool {
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		c.writeLine(string(errUnknownCommand))
+		return false
+	}
+
+	name, args := fields[0], fields[1:]
+	c.noreply = false
+	if len(args) > 0 && args[len(args)-1] == "noreply" && name != "get" && name != "gets" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+
+	var err error
+	switch name {
+	case "get", "gets":
+		err = c.get(args, name == "gets")
+	case "set", "add", "replace", "cas":
+		err = c.storage(name, args)
+	case "delete":
+		err = c.delete(args)
+	case "incr", "decr":
+		err = c.incr(args, name == "incr")
+	case "touch":
+		err = c.touch(args)
+	case "version":
+		c.writeLine("VERSION caskdb")
+	case "quit":
+		return true
+	default:
+		err = errUnknownCommand
+	}
+
+	var reply status
+	var protoErr protocolError
+	switch {
+	case err == nil:
+	case errors.As(err, &reply):
+		c.reply(string(reply))
+	case errors.As(err, &protoErr):
+		c.writeLine(string(protoErr))
+	default:
+		c.writeLine("SERVER_ERROR " + err.Error())
+	}
+
+	return false
+}
+
+// get will write every key that exists, gets include the cas token
+//
+//	get <key>*
+//	gets <key>*
+func (c *client) get(keys []string, withCAS bool) error {
+	if len(keys) == 0 {
+		return errUnknownCommand
+	}
+
+	for _, key := range keys {
+		if !validKey(key) {
+			return errBadFormat
+		}
+	}
+
+	for _, key := range keys {
+		record, err := c.store.GetRecord([]byte(key))
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		flags, data, err := decodeValue(record.Value)
+		if err != nil {
+			return err
+		}
+
+		line := "VALUE " + key + " " + strconv.FormatUint(uint64(flags), 10) + " " + strconv.Itoa(len(data))
+		if withCAS {
+			line += " " + strconv.FormatUint(uint64(record.Timestamp), 10)
+		}
+		c.writeLine(line)
+		c.w.Write(data)
+		c.w.WriteString("\r\n")
+	}
+	c.writeLine("END")
+
+	return nil
+}
+
+// storage handle every command that store a value
+//
+//	set <key> <flags> <exptime> <bytes> [noreply]
+//	add <key> <flags> <exptime> <bytes> [noreply]
+//	replace <key> <flags> <exptime> <bytes> [noreply]
+//	cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+func (c *client) storage(name string, args []string) error {
+	expectedArgs := 4
+	if name == "cas" {
+		expectedArgs = 5
+	}
+	if len(args) != expectedArgs {
+		return errBadFormat
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		return errBadFormat
+	}
+
+	// the data block is always read, so the next command can be parsed
+	data, err := c.readData(size)
+	if err != nil {
+		return err
+	}
+
+	key := args[0]
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || !validKey(key) {
+		return errBadFormat
+	}
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errBadFormat
+	}
+	var casUnique uint64
+	if name == "cas" {
+		if casUnique, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return errBadFormat
+		}
+	}
+
+	value := encodeValue(uint32(flags), data)
+	err = c.store.Update([]byte(key), func(record *caskdb.Record) (*caskdb.Record, error) {
+		switch {
+		case name == "add" && record != nil:
+			return nil, statusNotStored
+		case name == "replace" && record == nil:
+			return nil, statusNotStored
+		case name == "cas" && record == nil:
+			return nil, statusNotFound
+		case name == "cas" && uint64(record.Timestamp) != casUnique:
+			return nil, statusExists
+		}
+
+		return &caskdb.Record{Value: value, Expiry: expiry(exptime, time.Now())}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.reply("STORED")
+	return nil
+}
+
+// delete <key> [noreply]
+func (c *client) delete(args []string) error {
+	if len(args) != 1 || !validKey(args[0]) {
+		return errBadFormat
+	}
+
+	err := c.store.Delete([]byte(args[0]))
+	if errors.Is(err, caskdb.ErrRecordNotFound) {
+		return statusNotFound
+	} else if err != nil {
+		return err
+	}
+
+	c.reply("DELETED")
+	return nil
+}
+
+// incr will treat the value as 64-bit unsigned integer, incr
+// wraps around on overflow while decr stops at 0
+//
+//	incr <key> <value> [noreply]
+//	decr <key> <value> [noreply]
+func (c *client) incr(args []string, increment bool) error {
+	if len(args) != 2 || !validKey(args[0]) {
+		return errBadFormat
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return protocolError("CLIENT_ERROR invalid numeric delta argument")
+	}
+
+	var n uint64
+	err = c.store.Update([]byte(args[0]), func(record *caskdb.Record) (*caskdb.Record, error) {
+		if record == nil {
+			return nil, statusNotFound
+		}
+		flags, data, err := decodeValue(record.Value)
+		if err != nil {
+			return nil, err
+		}
+		if n, err = strconv.ParseUint(string(data), 10, 64); err != nil {
+			return nil, errNonNumeric
+		}
+
+		switch {
+		case increment:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+
+		value := encodeValue(flags, []byte(strconv.FormatUint(n, 10)))
+		return &caskdb.Record{Value: value, Expiry: record.Expiry}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.reply(strconv.FormatUint(n, 10))
+	return nil
+}
+
+// touch will update the expiry without changing the value, the cas
+// token is changed as well since the record is rewritten
+//
+//	touch <key> <exptime> [noreply]
+func (c *client) touch(args []string) error {
+	if len(args) != 2 || !validKey(args[0]) {
+		return errBadFormat
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errBadFormat
+	}
+
+	err = c.store.Update([]byte(args[0]), func(record *caskdb.Record) (*caskdb.Record, error) {
+		if record == nil {
+			return nil, statusNotFound
+		}
+		return &caskdb.Record{Value: record.Value, Expiry: expiry(exptime, time.Now())}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.reply("TOUCHED")
+	return nil
+}
+
+// readData will read data block of the storage commands, data block
+// larger than maxValueBytes is discarded
+func (c *client) readData(size int) ([]byte, error) {
+	if size > c.maxValueBytes {
+		if _, err := io.CopyN(io.Discard, c.r, int64(size)+2); err != nil {
+			return nil, err
+		}
+		return nil, errTooLarge
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		// the rest of the line is discarded, so it isn't parsed as command
+		if data[size+1] != '\n' {
+			c.r.ReadSlice('\n')
+		}
+		return nil, errBadDataChunk
+	}
+
+	return data[:size], nil
+}
+
+// reply will write the line unless noreply is set
+func (c *client) reply(line string) {
+	if !c.noreply {
+		c.writeLine(line)
+	}
+}
+
+func (c *client) writeLine(line string) {
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
+
+// validKey check the key length, key can't contain whitespace
+// which is already handled when splitting the command, nor control characters
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiry will convert memcached exptime to unixnano, 0 means never expire
+// and negative means the record is expired immediately
+func expiry(exptime int64, now time.Time) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return now.UnixNano()
+	case exptime <= maxRelativeExptime:
+		return now.Add(time.Duration(exptime) * time.Second).UnixNano()
+	default:
+		return time.Unix(exptime, 0).UnixNano()
+	}
+}
+
+func encodeValue(flags uint32, data []byte) []byte {
+	value := make([]byte, flagsLength+len(data))
+	binary.BigEndian.PutUint32(value, flags)
+	copy(value[flagsLength:], data)
+
+	return value
+}
+
+func decodeValue(value []byte) (uint32, []byte, error) {
+	if len(value) < flagsLength {
+		return 0, nil, errInvalidValue
+	}
+
+	return binary.BigEndian.Uint32(value), value[flagsLength:], nil
+}
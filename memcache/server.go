@@ -0,0 +1,162 @@
+// Package memcache implements a server that speaks the memcached text
+// protocol on top of caskdb.DiskStorage, so existing memcached clients can
+// be used to access the database. The record timestamp is used as the CAS
+// token, it is unique for every write of the storage, and exptime is mapped
+// to the record expiry.
+//
+// The 32-bit client flags is stored as 4 bytes big-endian prefix of the
+// value, so value written by this server should only be read by this server,
+// the storage must not be served using other protocol at the same time
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+const (
+	defaultMaxValueBytes = 1024 * 1024
+	// readBufferSize also limit the length of command line
+	readBufferSize = 64 * 1024
+)
+
+// ErrServerClosed is returned by Serve after Close is called
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// Store is the storage used by the server, it is implemented by caskdb.DiskStorage
+type Store interface {
+	GetRecord(key []byte) (*caskdb.Record, error)
+	Update(key []byte, fn func(record *caskdb.Record) (*caskdb.Record, error)) error
+	Delete(key []byte) error
+}
+
+var _ Store = (*caskdb.DiskStorage)(nil)
+
+type Server struct {
+	store Store
+	// MaxValueBytes limit the size of a single value, default is 1MB
+	MaxValueBytes int
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer(store Store) *Server {
+	return &Server{
+		store:         store,
+		MaxValueBytes: defaultMaxValueBytes,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve will accept connection from the listener, each connection
+// is handled by its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Close will stop every listener and close every connection,
+// it doesn't close the store
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	c := &client{
+		store:         s.store,
+		maxValueBytes: s.MaxValueBytes,
+		r:             bufio.NewReaderSize(conn, readBufferSize),
+		w:             bufio.NewWriter(conn),
+	}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			}
+			return
+		}
+
+		quit := c.execute(line)
+
+		// pipelined commands is replied at once
+		if c.r.Buffered() == 0 || quit {
+			if err = c.w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package memcache
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newTestServer will start the server, configure is called before the server is started
+func newTestServer(t *testing.T, configure ...func(server *Server)) (*Server, *testClient) {
+	store := caskdb.NewDiskStorage("db/test", caskdb.NewOptions().SetFileSystem(caskdb.NewMemFileSystem()))
+	server := NewServer(store)
+	for _, fn := range configure {
+		fn(server)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go server.Serve(l)
+
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+		assert.Nil(t, store.Close())
+	})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return server, &testClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(t *testing.T, lines ...string) {
+	_, err := c.conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	require.Nil(t, err)
+}
+
+func (c *testClient) receive(t *testing.T) string {
+	require.Nil(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	line, err := c.r.ReadString('\n')
+	require.Nil(t, err)
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// do will send the lines and return the reply until the end of the reply
+func (c *testClient) do(t *testing.T, lines ...string) []string {
+	c.send(t, lines...)
+
+	replies := make([]string, 0)
+	for {
+		reply := c.receive(t)
+		replies = append(replies, reply)
+		if !strings.HasPrefix(reply, "VALUE ") && (len(replies) == 1 || reply == "END") {
+			return replies
+		}
+		if strings.HasPrefix(reply, "VALUE ") {
+			replies = append(replies, c.receive(t))
+		}
+	}
+}
+
+// gets will return the cas token of the key
+func (c *testClient) gets(t *testing.T, key string) string {
+	replies := c.do(t, "gets "+key)
+	require.Len(t, replies, 3)
+	fields := strings.Fields(replies[0])
+	require.Len(t, fields, 5)
+	return fields[4]
+}
+
+func TestServer_storage(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set key 42 0 5", "value"))
+	assert.Equal(t, []string{"VALUE key 42 5", "value", "END"}, client.do(t, "get key"))
+	assert.Equal(t, []string{"END"}, client.do(t, "get missing"))
+
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set other 0 0 0", ""))
+	assert.Equal(t, []string{"VALUE key 42 5", "value", "VALUE other 0 0", "", "END"},
+		client.do(t, "get key missing other"))
+
+	assert.Equal(t, []string{"NOT_STORED"}, client.do(t, "add key 0 0 3", "new"))
+	assert.Equal(t, []string{"STORED"}, client.do(t, "add added 0 0 3", "new"))
+	assert.Equal(t, []string{"NOT_STORED"}, client.do(t, "replace missing 0 0 3", "new"))
+	assert.Equal(t, []string{"STORED"}, client.do(t, "replace key 1 0 8", "replaced"))
+	assert.Equal(t, []string{"VALUE key 1 8", "replaced", "END"}, client.do(t, "get key"))
+
+	assert.Equal(t, []string{"DELETED"}, client.do(t, "delete key"))
+	assert.Equal(t, []string{"NOT_FOUND"}, client.do(t, "delete key"))
+	assert.Equal(t, []string{"END"}, client.do(t, "get key"))
+
+	// data block that contains CRLF
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set multiline 0 0 4", "a\r\nb"))
+	assert.Equal(t, []string{"VALUE multiline 0 4", "a", "b", "END"}, client.do(t, "get multiline"))
+}
+
+func TestServer_cas(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, []string{"NOT_FOUND"}, client.do(t, "cas key 0 0 5 1", "value"))
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set key 0 0 5", "value"))
+
+	token := client.gets(t, "key")
+	assert.Equal(t, []string{"STORED"}, client.do(t, "cas key 0 0 3 "+token, "new"))
+	// token is changed after the record is written
+	assert.Equal(t, []string{"EXISTS"}, client.do(t, "cas key 0 0 5 "+token, "stale"))
+	assert.NotEqual(t, token, client.gets(t, "key"))
+	assert.Equal(t, []string{"VALUE key 0 3", "new", "END"}, client.do(t, "get key"))
+	// the status aborts the update on purpose, so it is not counted as failed set
+	for _, s := range []status{statusNotStored, statusNotFound, statusExists} {
+		assert.ErrorIs(t, s, caskdb.ErrUpdateAborted)
+	}
+
+	// every write gets a new token, including the key written again after it is deleted
+	tokens := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, []string{"DELETED"}, client.do(t, "delete key"))
+		assert.Equal(t, []string{"STORED"}, client.do(t, "set key 0 0 5", "value"))
+		token := client.gets(t, "key")
+		assert.False(t, tokens[token], "token %s is reused", token)
+		tokens[token] = true
+	}
+}
+
+func TestServer_incr(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, []string{"NOT_FOUND"}, client.do(t, "incr counter 1"))
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set counter 7 0 2", "10"))
+
+	assert.Equal(t, []string{"15"}, client.do(t, "incr counter 5"))
+	assert.Equal(t, []string{"12"}, client.do(t, "decr counter 3"))
+	assert.Equal(t, []string{"0"}, client.do(t, "decr counter 100"))
+	assert.Equal(t, []string{"VALUE counter 7 1", "0", "END"}, client.do(t, "get counter"))
+
+	max := strconv.FormatUint(^uint64(0), 10)
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set counter 0 0 "+strconv.Itoa(len(max)), max))
+	assert.Equal(t, []string{"1"}, client.do(t, "incr counter 2"))
+
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set text 0 0 3", "abc"))
+	assert.Equal(t, []string{"CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		client.do(t, "incr text 1"))
+	assert.Equal(t, []string{"CLIENT_ERROR invalid numeric delta argument"}, client.do(t, "incr counter -1"))
+}
+
+func TestServer_expiry(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set expired 0 -1 5", "value"))
+	assert.Equal(t, []string{"END"}, client.do(t, "get expired"))
+
+	// absolute unix timestamp
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set past 0 "+past+" 5", "value"))
+	assert.Equal(t, []string{"END"}, client.do(t, "get past"))
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set future 0 "+future+" 5", "value"))
+	assert.Equal(t, []string{"VALUE future 0 5", "value", "END"}, client.do(t, "get future"))
+
+	assert.Equal(t, []string{"NOT_FOUND"}, client.do(t, "touch missing 10"))
+	assert.Equal(t, []string{"TOUCHED"}, client.do(t, "touch future -1"))
+	assert.Equal(t, []string{"END"}, client.do(t, "get future"))
+
+	assert.Equal(t, []string{"STORED"}, client.do(t, "set relative 0 1 5", "value"))
+	assert.Equal(t, []string{"VALUE relative 0 5", "value", "END"}, client.do(t, "get relative"))
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, []string{"END"}, client.do(t, "get relative"))
+}
+
+func TestServer_noreply(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	client.send(t,
+		"set key 0 0 5 noreply", "value",
+		"add key 0 0 5 noreply", "value",
+		"incr key 1 noreply",
+		"delete missing noreply",
+		"version",
+	)
+	// only the error and the version is replied
+	assert.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value", client.receive(t))
+	assert.Equal(t, "VERSION caskdb", client.receive(t))
+}
+
+func TestServer_errors(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t, func(server *Server) {
+		server.MaxValueBytes = 10
+	})
+
+	assert.Equal(t, []string{"ERROR"}, client.do(t, "unknown"))
+	assert.Equal(t, []string{"ERROR"}, client.do(t, "get"))
+	assert.Equal(t, []string{"CLIENT_ERROR bad command line format"}, client.do(t, "set key 0 0"))
+	assert.Equal(t, []string{"CLIENT_ERROR bad command line format"}, client.do(t, "set key invalid 0 1", "a"))
+	assert.Equal(t, []string{"CLIENT_ERROR bad command line format"},
+		client.do(t, "set "+strings.Repeat("k", maxKeyLength+1)+" 0 0 1", "a"))
+	assert.Equal(t, []string{"CLIENT_ERROR bad data chunk"}, client.do(t, "set key 0 0 1", "ab"))
+
+	// too large data is discarded, so the connection is still usable
+	assert.Equal(t, []string{"SERVER_ERROR object too large for cache"},
+		client.do(t, "set key 0 0 11", strings.Repeat("a", 11)))
+	assert.Equal(t, []string{"VERSION caskdb"}, client.do(t, "version"))
+
+	client.send(t, "quit")
+	require.Nil(t, client.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err := client.r.ReadString('\n')
+	assert.Error(t, err)
+}
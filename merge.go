@@ -0,0 +1,140 @@
+package caskdb
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Merge will compact the datafiles by rewriting every live entry into new
+// datafiles, then remove the old ones. Entries are re-encrypted using the
+// current encryption key, so it is also used to rotate the key.
+// Deleted and expired keys are removed. Datafiles from the committed
+// position of any change log consumer are kept as is.
+// Set and Get are blocked until merge is finished
+func (s *DiskStorage) Merge() error {
+	return s.MergeContext(context.Background())
+}
+
+// MergeContext is Merge that is aborted with the context error once the context
+// is done. The entries that are already merged are kept in the new datafiles,
+// while the old datafiles are not removed, so no data is lost, and the next
+// merge continues from there. The context is not checked after the old
+// datafiles are started to be removed
+func (s *DiskStorage) MergeContext(ctx context.Context) error {
+	return s.merge(ctx)
+}
+
+func (s *DiskStorage) merge(ctx context.Context) (err error) {
+	start := time.Now()
+	ctx, after := s.runHooks(ctx, HookInfo{Operation: OperationMerge})
+	defer func() {
+		after(err)
+		s.observe(OperationMerge, start, err)
+	}()
+
+	s.fileRemoval.Lock()
+	defer s.fileRemoval.Unlock()
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	oldFileIDs := s.sortedFileIDs()
+	if pin, found := s.consumersPin(); found {
+		oldFileIDs = oldFileIDs[:sort.SearchInts(oldFileIDs, pin)]
+	}
+	if len(oldFileIDs) == 0 {
+		return nil
+	}
+	merged := make(map[int]bool, len(oldFileIDs))
+	for _, fileID := range oldFileIDs {
+		merged[fileID] = true
+	}
+
+	firstMergedFileID, _, err := s.addNewDataFile()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("merge is started", "datafiles", len(oldFileIDs), "keys", len(s.keyDir))
+
+	// keyDir is updated one by one, if merge is failed in the middle,
+	// each key is still pointing to either old or new files
+	now := time.Now().UnixNano()
+	total, checked := len(s.keyDir), 0
+	for key, keyData := range s.keyDir {
+		if checked%mergeProgressInterval == 0 && s.observer != nil {
+			s.observer.ObserveMergeProgress(checked, total)
+		}
+		checked++
+		if keyData.expired(now) {
+			delete(s.keyDir, key)
+			continue
+		}
+		if !merged[keyData.FileID] {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			s.logger.Info("merge is cancelled", "checkedKeys", checked, "keys", total, "error", err)
+			return err
+		}
+
+		dataEntry, err := s.readEntry(keyData)
+		if err != nil {
+			s.logger.Error("merge is failed", "fileID", keyData.FileID, "offset", keyData.LocationOffset, "error", err)
+			return err
+		}
+		dataEntry.header.flags |= flagMerged
+		if err = s.sealEntry(dataEntry); err != nil {
+			return err
+		}
+
+		newKeyData, err := s.appendEntry(ctx, dataEntry)
+		if err != nil {
+			return err
+		}
+		s.keyDir[key] = newKeyData
+	}
+
+	if s.observer != nil {
+		s.observer.ObserveMergeProgress(total, total)
+	}
+
+	// merged files must be durable before the old files are removed
+	for fileID, file := range s.files {
+		if fileID < firstMergedFileID {
+			continue
+		}
+		if err := s.syncFile(file); err != nil {
+			return err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		s.logger.Info("merge is cancelled", "checkedKeys", checked, "keys", total, "error", err)
+		return err
+	}
+
+	for _, fileID := range oldFileIDs {
+		file := s.files[fileID]
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := s.fs.Remove(file.fileID); err != nil {
+			return err
+		}
+		delete(s.files, fileID)
+	}
+	s.lastMerge = time.Now()
+	s.notifyChanged()
+	s.logger.Info("merge is finished", "removedDatafiles", len(oldFileIDs),
+		"datafiles", len(s.files), "keys", len(s.keyDir), "duration", time.Since(start))
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package caskdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskStorage_Merge(t *testing.T) {
+	t.Parallel()
+
+	store, fs, open := initMemStorageHelper(NewOptions().SetMaxFileSize("1KB"))
+
+	// overwrite the same keys, so most of the data is stale
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(round))))
+		}
+	}
+	before, err := fs.List("db")
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.Merge())
+
+	after, err := fs.List("db")
+	assert.Nil(t, err)
+	assert.Less(t, len(after), len(before))
+
+	for i := 0; i < 50; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("9"), res)
+	}
+
+	// new entry is written after the merged entries
+	assert.Nil(t, store.Set([]byte("new"), []byte("value")))
+
+	store = open()
+	for i := 0; i < 50; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("9"), res)
+	}
+	res, err := store.Get([]byte("new"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res)
+}
+
+// cancelHook cancel the context before the operation is started
+type cancelHook struct {
+	operation Operation
+	cancel    context.CancelFunc
+}
+
+func (h cancelHook) Before(ctx context.Context, info HookInfo) context.Context {
+	if info.Operation == h.operation {
+		h.cancel()
+	}
+	return ctx
+}
+
+func (h cancelHook) After(context.Context, HookInfo, error) {}
+
+func TestDiskStorage_MergeContext(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	defer store.Close()
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(round))))
+		}
+	}
+	before := store.Stats().FileCount
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, store.MergeContext(ctx), context.Canceled)
+	assert.Equal(t, before, store.Stats().FileCount)
+
+	// the merge is cancelled once the first merged datafile is full
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	store.WithOptions(NewOptions().AddHook(cancelHook{operation: OperationRotate, cancel: cancel}))
+	assert.ErrorIs(t, store.MergeContext(ctx), context.Canceled)
+	assert.True(t, store.Stats().LastMerge.IsZero())
+	// the old datafiles are kept, along with the partially merged ones
+	assert.Greater(t, store.Stats().FileCount, before)
+	for i := 0; i < 50; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "4", string(res))
+	}
+
+	// the partially merged datafiles are recovered, and merged by the next merge
+	assert.Nil(t, store.Close())
+	reopened := NewDiskStorage("db/test", NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB"))
+	defer reopened.Close()
+	assert.Nil(t, reopened.Merge())
+	assert.Less(t, reopened.Stats().FileCount, before)
+	for i := 0; i < 50; i++ {
+		res, err := reopened.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "4", string(res))
+	}
+}
@@ -0,0 +1,238 @@
+// Package metrics exports the metrics of caskdb.DiskStorage in Prometheus text
+// exposition format. Collector is registered as the Observer of the storage
+// to record the latency of every operation, then served by its Handler
+//
+//	collector := metrics.NewCollector()
+//	store := caskdb.NewDiskStorage("data/caskdb", caskdb.NewOptions().SetObserver(collector))
+//	http.Handle("/metrics", collector.Handler(store))
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// operations is every operation that has a latency histogram, in the exposition order
+var operations = []caskdb.Operation{caskdb.OperationGet, caskdb.OperationSet, caskdb.OperationDelete}
+
+// StatsProvider is the storage that the metrics are collected from, i.e. caskdb.DiskStorage
+type StatsProvider interface {
+	Stats() caskdb.Stats
+}
+
+var _ caskdb.Observer = (*Collector)(nil)
+
+// Collector is caskdb.Observer that records the latency of the operations
+type Collector struct {
+	mu      sync.Mutex
+	latency map[caskdb.Operation]*histogram
+	// errors is the number of failed operations, missing key is not an error
+	errors map[caskdb.Operation]uint64
+	sync   *histogram
+
+	merges        uint64
+	mergeDuration time.Duration // of the last merge
+	mergeRunning  bool
+	mergeChecked  int
+	mergeTotal    int
+	// stats is the last stats, it is served while merge is running
+	// since the storage is locked until merge is finished
+	stats    caskdb.Stats
+	hasStats bool
+}
+
+func NewCollector() *Collector {
+	c := &Collector{
+		latency: make(map[caskdb.Operation]*histogram, len(operations)),
+		errors:  make(map[caskdb.Operation]uint64),
+		sync:    newHistogram(defaultBuckets),
+	}
+	for _, op := range operations {
+		c.latency[op] = newHistogram(defaultBuckets)
+	}
+
+	return c
+}
+
+func (c *Collector) ObserveOperation(op caskdb.Operation, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil && !errors.Is(err, caskdb.ErrRecordNotFound) && !errors.Is(err, caskdb.ErrUpdateAborted) {
+		c.errors[op]++
+	}
+	switch op {
+	case caskdb.OperationSync:
+		c.sync.observe(duration)
+	case caskdb.OperationMerge:
+		c.merges++
+		c.mergeDuration = duration
+		c.mergeRunning = false
+	default:
+		if h, found := c.latency[op]; found {
+			h.observe(duration)
+		}
+	}
+}
+
+func (c *Collector) ObserveMergeProgress(checked, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mergeRunning = true
+	c.mergeChecked, c.mergeTotal = checked, total
+}
+
+// Handler will return http.Handler that serve the metrics of the storage. The
+// storage statistics are read on every request, except while merge is running
+func (c *Collector) Handler(store StatsProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Stats is blocked until merge is finished, so the last stats is used instead
+		c.mu.Lock()
+		stats, useLast := c.stats, c.mergeRunning && c.hasStats
+		c.mu.Unlock()
+		if !useLast {
+			stats = store.Stats()
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		bw := bufio.NewWriter(w)
+		c.write(&textWriter{w: bw}, stats)
+		bw.Flush()
+	})
+}
+
+// write will write every metric of the stats and the collector
+func (c *Collector) write(w *textWriter, stats caskdb.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats, c.hasStats = stats, true
+
+	w.metric("caskdb_keys", "gauge", "Number of keys, including the expired keys that are not removed by merge yet.")
+	w.sample("caskdb_keys", float64(stats.KeyCount))
+	w.metric("caskdb_keydir_memory_bytes", "gauge", "Estimated memory used by the key directory.")
+	w.sample("caskdb_keydir_memory_bytes", float64(stats.KeyDirMemory))
+	w.metric("caskdb_datafiles", "gauge", "Number of datafiles.")
+	w.sample("caskdb_datafiles", float64(stats.FileCount))
+	w.metric("caskdb_active_datafile_bytes", "gauge", "Size of the active datafile.")
+	w.sample("caskdb_active_datafile_bytes", float64(stats.ActiveFileSize))
+	w.metric("caskdb_max_datafile_bytes", "gauge", "Size of the datafile before a new one is created.")
+	w.sample("caskdb_max_datafile_bytes", float64(stats.MaxFileSize))
+
+	w.metric("caskdb_datafile_bytes", "gauge", "Size of the datafile.")
+	for _, f := range stats.Files {
+		w.sample("caskdb_datafile_bytes", float64(f.Size), "file_id", strconv.Itoa(f.FileID))
+	}
+	w.metric("caskdb_datafile_dead_bytes", "gauge", "Size of the overwritten, deleted and tombstone entries in the datafile.")
+	for _, f := range stats.Files {
+		w.sample("caskdb_datafile_dead_bytes", float64(f.DeadSize), "file_id", strconv.Itoa(f.FileID))
+	}
+	w.metric("caskdb_datafile_fragmentation_ratio", "gauge", "Ratio of the dead bytes to the size of the datafile.")
+	for _, f := range stats.Files {
+		var ratio float64
+		if f.Size > 0 {
+			ratio = float64(f.DeadSize) / float64(f.Size)
+		}
+		w.sample("caskdb_datafile_fragmentation_ratio", ratio, "file_id", strconv.Itoa(f.FileID))
+	}
+
+	w.metric("caskdb_operations_total", "counter", "Number of operations since the storage is opened.")
+	w.sample("caskdb_operations_total", float64(stats.Gets), "operation", string(caskdb.OperationGet))
+	w.sample("caskdb_operations_total", float64(stats.Sets), "operation", string(caskdb.OperationSet))
+	w.sample("caskdb_operations_total", float64(stats.Deletes), "operation", string(caskdb.OperationDelete))
+	w.metric("caskdb_get_misses_total", "counter", "Number of gets of the key that doesn't exist or is expired.")
+	w.sample("caskdb_get_misses_total", float64(stats.Misses))
+	w.metric("caskdb_read_bytes_total", "counter", "Bytes read from the datafiles.")
+	w.sample("caskdb_read_bytes_total", float64(stats.BytesRead))
+	w.metric("caskdb_written_bytes_total", "counter", "Bytes written to the datafiles.")
+	w.sample("caskdb_written_bytes_total", float64(stats.BytesWritten))
+
+	w.metric("caskdb_operation_errors_total", "counter", "Number of failed operations.")
+	errorOps := make([]string, 0, len(c.errors))
+	for op := range c.errors {
+		errorOps = append(errorOps, string(op))
+	}
+	sort.Strings(errorOps)
+	for _, op := range errorOps {
+		w.sample("caskdb_operation_errors_total", float64(c.errors[caskdb.Operation(op)]), "operation", op)
+	}
+	w.metric("caskdb_operation_duration_seconds", "histogram", "Latency of the operations.")
+	for _, op := range operations {
+		c.latency[op].write(w, "caskdb_operation_duration_seconds", "operation", string(op))
+	}
+	w.metric("caskdb_fsync_duration_seconds", "histogram", "Duration of the datafile fsync.")
+	c.sync.write(w, "caskdb_fsync_duration_seconds")
+
+	w.metric("caskdb_merges_total", "counter", "Number of finished merges.")
+	w.sample("caskdb_merges_total", float64(c.merges))
+	w.metric("caskdb_merge_running", "gauge", "Whether merge is running.")
+	w.sample("caskdb_merge_running", boolFloat(c.mergeRunning))
+	w.metric("caskdb_merge_progress_ratio", "gauge", "Ratio of the keys checked by the running or the last merge.")
+	progress := 1.0
+	if c.mergeTotal > 0 {
+		progress = float64(c.mergeChecked) / float64(c.mergeTotal)
+	}
+	w.sample("caskdb_merge_progress_ratio", progress)
+	w.metric("caskdb_last_merge_duration_seconds", "gauge", "Duration of the last merge.")
+	w.sample("caskdb_last_merge_duration_seconds", c.mergeDuration.Seconds())
+	w.metric("caskdb_last_merge_timestamp_seconds", "gauge", "Unix time of when the last merge is finished, 0 if there is no merge.")
+	var lastMerge float64
+	if !stats.LastMerge.IsZero() {
+		lastMerge = float64(stats.LastMerge.UnixNano()) / float64(time.Second)
+	}
+	w.sample("caskdb_last_merge_timestamp_seconds", lastMerge)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// textWriter write the metrics in Prometheus text exposition format
+type textWriter struct {
+	w *bufio.Writer
+}
+
+// metric will write the HELP and TYPE of the metric, before its samples
+func (w *textWriter) metric(name, metricType, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample will write the value of the metric, labels are pairs of label name and value
+func (w *textWriter) sample(name string, value float64, labels ...string) {
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+labelValueEscaper.Replace(labels[i+1])+`"`)
+		}
+		w.w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
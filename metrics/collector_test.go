@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sampleLine  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*")*\})? (\S+)$`)
+	typeLine    = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram)$`)
+	sampleTypes = map[string][]string{
+		"counter":   {""},
+		"gauge":     {""},
+		"histogram": {"_bucket", "_sum", "_count"},
+	}
+)
+
+// scrape will get the metrics from the handler, and validate it is in the text exposition
+// format. The samples are returned by the metric name along with its labels
+func scrape(t *testing.T, handler http.Handler) map[string]float64 {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, contentType, res.Header.Get("Content-Type"))
+
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := typeLine.FindStringSubmatch(line); m != nil {
+			assert.NotContains(t, types, m[1], "metric %s is declared twice", m[1])
+			types[m[1]] = m[2]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+
+		m := sampleLine.FindStringSubmatch(line)
+		require.NotNil(t, m, "invalid line %q", line)
+		declared := false
+		for name, metricType := range types {
+			for _, suffix := range sampleTypes[metricType] {
+				declared = declared || m[1] == name+suffix
+			}
+		}
+		assert.True(t, declared, "type of %s is not declared", m[1])
+		value, err := strconv.ParseFloat(m[3], 64)
+		require.Nil(t, err)
+		samples[m[1]+m[2]] = value
+	}
+	require.Nil(t, scanner.Err())
+
+	return samples
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	collector := NewCollector()
+	store := caskdb.NewDiskStorage("db/test", caskdb.NewOptions().
+		SetFileSystem(caskdb.NewMemFileSystem()).
+		SetMaxFileSize("1KB").
+		SetSyncWrites(true).
+		SetObserver(collector))
+	defer store.Close()
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Delete([]byte(strconv.Itoa(i))))
+	}
+	_, err := store.Get([]byte("10"))
+	assert.Nil(t, err)
+	_, err = store.Get([]byte("0"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+
+	samples := scrape(t, collector.Handler(store))
+	assert.Equal(t, float64(40), samples["caskdb_keys"])
+	assert.Equal(t, float64(50), samples[`caskdb_operations_total{operation="set"}`])
+	assert.Equal(t, float64(2), samples[`caskdb_operations_total{operation="get"}`])
+	assert.Equal(t, float64(1), samples["caskdb_get_misses_total"])
+	assert.Equal(t, float64(2), samples[`caskdb_operation_duration_seconds_count{operation="get"}`])
+	assert.Equal(t, float64(2), samples[`caskdb_operation_duration_seconds_bucket{operation="get",le="+Inf"}`])
+	assert.Equal(t, float64(10), samples[`caskdb_operation_duration_seconds_count{operation="delete"}`])
+	// every write is synced
+	assert.Equal(t, float64(60), samples["caskdb_fsync_duration_seconds_count"])
+	assert.NotContains(t, samples, `caskdb_operation_errors_total{operation="get"}`)
+
+	// update aborted on purpose is not failed operation
+	err = store.Update([]byte("10"), func(record *caskdb.Record) (*caskdb.Record, error) {
+		return nil, fmt.Errorf("%w: condition failed", caskdb.ErrUpdateAborted)
+	})
+	assert.ErrorIs(t, err, caskdb.ErrUpdateAborted)
+	assert.NotContains(t, scrape(t, collector.Handler(store)), `caskdb_operation_errors_total{operation="set"}`)
+
+	// the deleted entries and the tombstones are dead bytes of the first datafile
+	assert.Greater(t, samples[`caskdb_datafile_dead_bytes{file_id="0"}`], float64(0))
+	assert.Greater(t, samples[`caskdb_datafile_fragmentation_ratio{file_id="0"}`], float64(0))
+	assert.Zero(t, samples["caskdb_merges_total"])
+
+	assert.Nil(t, store.Merge())
+	samples = scrape(t, collector.Handler(store))
+	assert.Equal(t, float64(1), samples["caskdb_merges_total"])
+	assert.Zero(t, samples["caskdb_merge_running"])
+	assert.Equal(t, float64(1), samples["caskdb_merge_progress_ratio"])
+	assert.Greater(t, samples["caskdb_last_merge_timestamp_seconds"], float64(0))
+	for name, value := range samples {
+		if strings.HasPrefix(name, "caskdb_datafile_dead_bytes") {
+			assert.Zero(t, value, name)
+		}
+	}
+}
+
+type statsFunc func() caskdb.Stats
+
+func (f statsFunc) Stats() caskdb.Stats {
+	return f()
+}
+
+func TestCollector_merge(t *testing.T) {
+	t.Parallel()
+
+	collector := NewCollector()
+	calls := 0
+	handler := collector.Handler(statsFunc(func() caskdb.Stats {
+		calls++
+		return caskdb.Stats{KeyCount: calls}
+	}))
+
+	assert.Equal(t, float64(1), scrape(t, handler)["caskdb_keys"])
+
+	// the storage is locked while merge is running, so the last stats is served
+	collector.ObserveMergeProgress(500, 1000)
+	samples := scrape(t, handler)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, float64(1), samples["caskdb_keys"])
+	assert.Equal(t, float64(1), samples["caskdb_merge_running"])
+	assert.Equal(t, 0.5, samples["caskdb_merge_progress_ratio"])
+
+	collector.ObserveOperation(caskdb.OperationMerge, 0, io.ErrUnexpectedEOF)
+	samples = scrape(t, handler)
+	assert.Equal(t, float64(2), samples["caskdb_keys"])
+	assert.Zero(t, samples["caskdb_merge_running"])
+	assert.Equal(t, float64(1), samples[`caskdb_operation_errors_total{operation="merge"}`])
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+}
+
+func TestTextWriter_escape(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	w := &textWriter{w: bufio.NewWriter(&b)}
+	w.sample("metric", 1.5, "label", "a\"b\\c\nd")
+	assert.Nil(t, w.w.Flush())
+	assert.Equal(t, `metric{label="a\"b\\c\nd"} 1.5`+"\n", b.String())
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultBuckets is the upper bound in seconds of the latency buckets, from 10µs to 1s
+var defaultBuckets = []float64{
+	0.00001, 0.000025, 0.00005,
+	0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005,
+	0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5,
+	1,
+}
+
+// histogram is a Prometheus histogram of durations in seconds, it is guarded by the Collector lock
+type histogram struct {
+	buckets []float64
+	// counts is the number of observations of every bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	// observation larger than every bucket is only counted in +Inf
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// write will write the cumulative buckets, sum and count of the histogram with the labels
+func (h *histogram) write(w *textWriter, name string, labels ...string) {
+	var cumulative uint64
+	for i, upperBound := range h.buckets {
+		cumulative += h.counts[i]
+		w.sample(name+"_bucket", float64(cumulative), append(labels, "le", formatFloat(upperBound))...)
+	}
+	w.sample(name+"_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+	w.sample(name+"_sum", h.sum, labels...)
+	w.sample(name+"_count", float64(h.count), labels...)
+}
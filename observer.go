@@ -0,0 +1,51 @@
+package caskdb
+
+import "time"
+
+// Operation is a storage operation that is observed by Observer
+type Operation string
+
+const (
+	OperationGet    Operation = "get"
+	OperationSet    Operation = "set"
+	OperationDelete Operation = "delete"
+	// OperationSync is the fsync of a datafile
+	OperationSync  Operation = "sync"
+	OperationMerge Operation = "merge"
+	// OperationRotate is the creation of new active datafile
+	OperationRotate Operation = "rotate"
+	// OperationRecover is loading keyDir when the storage is opened
+	OperationRecover Operation = "recover"
+)
+
+// mergeProgressInterval is the number of keys between the merge progress is observed
+const mergeProgressInterval = 1000
+
+// Observer is notified about the storage operations, e.g. to export the metrics,
+// see the metrics package. It is called synchronously while the storage might be
+// locked, so it must be fast and must not use the storage
+type Observer interface {
+	// ObserveOperation is called after the operation is finished, err is
+	// the error returned by the operation, e.g. ErrRecordNotFound on Get
+	ObserveOperation(op Operation, duration time.Duration, err error)
+	// ObserveMergeProgress is called periodically while merge is running, with
+	// the number of keys that are checked out of every key. It is called with
+	// checked equal to total once the keys are rewritten
+	ObserveMergeProgress(checked, total int)
+}
+
+// observe will notify the observer about the operation started at start
+func (s *DiskStorage) observe(op Operation, start time.Time, err error) {
+	if s.observer != nil {
+		s.observer.ObserveOperation(op, time.Since(start), err)
+	}
+}
+
+// syncFile will sync the datafile and observe how long it takes
+func (s *DiskStorage) syncFile(file *datafile) error {
+	start := time.Now()
+	err := file.Sync()
+	s.observe(OperationSync, start, err)
+
+	return err
+}
@@ -6,6 +6,21 @@ import (
 
 type Options struct {
 	maxFileSize int64
+
+	compressor           Compressor
+	compressionThreshold int64
+
+	keyring *keyring
+
+	fs FileSystem
+
+	syncWrites bool
+
+	observer Observer
+
+	logger Logger
+
+	hooks []Hook
 }
 
 func NewOptions() *Options {
@@ -13,6 +28,79 @@ func NewOptions() *Options {
 }
 
 func (o *Options) SetMaxFileSize(size string) *Options {
+	o.maxFileSize = parseSize(size)
+
+	return o
+}
+
+// SetCompressor will compress every value that is larger
+// than the threshold using the given Compressor
+func (o *Options) SetCompressor(c Compressor, threshold string) *Options {
+	if c.ID() == codecNone {
+		panic("compressor id 0 is reserved for uncompressed value")
+	}
+	o.compressor = c
+	o.compressionThreshold = parseSize(threshold)
+
+	return o
+}
+
+// SetEncryptionKey will encrypt every entry and the hint files using AES-GCM,
+// key must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+// previousKeys are only used to decrypt existing data, run Merge to
+// re-encrypt it using the new key
+func (o *Options) SetEncryptionKey(key []byte, previousKeys ...[]byte) *Options {
+	k, err := newKeyring(append([][]byte{key}, previousKeys...)...)
+	if err != nil {
+		panic(err)
+	}
+	o.keyring = k
+
+	return o
+}
+
+// SetFileSystem will store the database in the given FileSystem
+// instead of the OS filesystem
+func (o *Options) SetFileSystem(fs FileSystem) *Options {
+	o.fs = fs
+
+	return o
+}
+
+// SetSyncWrites will sync the datafile after every Set, so the
+// entry is durable once Set returns, at the cost of write throughput
+func (o *Options) SetSyncWrites(enabled bool) *Options {
+	o.syncWrites = enabled
+
+	return o
+}
+
+// SetObserver will notify the Observer about every operation, e.g. to export
+// the metrics using metrics.Collector
+func (o *Options) SetObserver(observer Observer) *Options {
+	o.observer = observer
+
+	return o
+}
+
+// SetLogger will use the logger instead of the default one, which only
+// logs the errors to stdout. *slog.Logger (Go 1.21+) can be used as is,
+// while zap logger can be used through NewZapLogger
+func (o *Options) SetLogger(logger Logger) *Options {
+	o.logger = logger
+
+	return o
+}
+
+// AddHook will call the hook before and after every operation, see Hook
+func (o *Options) AddHook(hook Hook) *Options {
+	o.hooks = append(o.hooks, hook)
+
+	return o
+}
+
+// parseSize will parse human-readable size such as 10.5MB into bytes
+func parseSize(size string) int64 {
 	unit := size[len(size)-2:]
 	actualSize, err := strconv.ParseFloat(size[:len(size)-2], 32)
 	if err != nil {
@@ -20,14 +108,12 @@ func (o *Options) SetMaxFileSize(size string) *Options {
 	}
 	switch unit {
 	case "KB":
-		o.maxFileSize = int64(actualSize * 1024)
+		return int64(actualSize * 1024)
 	case "MB":
-		o.maxFileSize = int64(actualSize * 1024 * 1024)
+		return int64(actualSize * 1024 * 1024)
 	case "GB":
-		o.maxFileSize = int64(actualSize * 1024 * 1024 * 1024)
+		return int64(actualSize * 1024 * 1024 * 1024)
 	default:
 		panic("size unit unknown, please use one of these: KB,MB,GB")
 	}
-
-	return o
 }
@@ -25,3 +25,19 @@ func TestOptions_AddMaxFileSize(t *testing.T) {
 		assert.Equal(t, int64(100*1024*1024*1024), o.maxFileSize)
 	})
 }
+
+func TestOptions_SetCompressor(t *testing.T) {
+	o := NewOptions().SetCompressor(GzipCompressor{}, "1KB")
+	assert.Equal(t, GzipCompressor{}, o.compressor)
+	assert.Equal(t, int64(1024), o.compressionThreshold)
+
+	assert.Panics(t, func() {
+		NewOptions().SetCompressor(noopCompressor{}, "1KB")
+	})
+}
+
+type noopCompressor struct{}
+
+func (n noopCompressor) ID() uint8                             { return codecNone }
+func (n noopCompressor) Compress(src []byte) ([]byte, error)   { return src, nil }
+func (n noopCompressor) Decompress(src []byte) ([]byte, error) { return src, nil }
@@ -0,0 +1,149 @@
+package caskdb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Record is the value of a key along with its metadata
+type Record struct {
+	Value []byte
+	// Timestamp is when the record is written in unixnano, it is changed
+	// on every write, so it can be used for optimistic concurrency control
+	Timestamp int64
+	// Expiry in unixnano, 0 means the record never expire
+	Expiry int64
+}
+
+// GetRecord is the same as Get, but the metadata is returned as well
+func (s *DiskStorage) GetRecord(key []byte) (*Record, error) {
+	return s.getRecordContext(context.Background(), key)
+}
+
+func (s *DiskStorage) getRecordContext(ctx context.Context, key []byte) (record *Record, err error) {
+	start := time.Now()
+	_, after := s.runHooks(ctx, HookInfo{Operation: OperationGet, Key: key})
+	defer func() {
+		after(err)
+		s.observe(OperationGet, start, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.getRecord(key)
+}
+
+// Update will atomically read and replace the record of the key. fn is
+// called with nil record if the key doesn't exist, the returned record is
+// written unless fn returns error, in that case the error is returned.
+// Returning nil record without error is an error as well, wrap
+// ErrUpdateAborted to abort the update on purpose.
+// Timestamp of the returned record is ignored, it is always set to
+// a value larger than the previous one. The storage is locked while
+// fn is called, so fn must not access the storage
+func (s *DiskStorage) Update(key []byte, fn func(record *Record) (*Record, error)) (err error) {
+	start := time.Now()
+	ctx, after := s.runHooks(context.Background(), HookInfo{Operation: OperationSet, Key: key})
+	defer func() {
+		after(err)
+		s.observe(OperationSet, start, err)
+	}()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	old, err := s.getRecord(key)
+	if errors.Is(err, ErrRecordNotFound) {
+		old = nil
+	} else if err != nil {
+		return err
+	}
+
+	record, err := fn(old)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return errNilRecord
+	}
+
+	timestamp := s.nextTimestamp()
+	if old != nil && timestamp <= old.Timestamp {
+		timestamp = old.Timestamp + 1
+	}
+	data, err := s.newValueEntry(timestamp, key, record.Value, record.Expiry)
+	if err != nil {
+		return err
+	}
+
+	keyData, err := s.appendEntry(ctx, data)
+	if err != nil {
+		return err
+	}
+	s.keyDir[string(key)] = keyData
+	atomic.AddUint64(&s.operations.sets, 1)
+	s.notifyWatchers(EventPut, key, record.Value, keyData.Timestamp, record.Expiry)
+
+	return nil
+}
+
+// getRecord will read the record of the key, caller must hold the lock
+func (s *DiskStorage) getRecord(key []byte) (*Record, error) {
+	atomic.AddUint64(&s.operations.gets, 1)
+	keyData, found := s.keyDir[string(key)]
+	if !found || keyData.expired(time.Now().UnixNano()) {
+		atomic.AddUint64(&s.operations.misses, 1)
+		return nil, ErrRecordNotFound
+	}
+
+	return s.readRecord(keyData)
+}
+
+// peekRecord will read the record of the key without running the hooks or counting
+// it as get, e.g. for Export and Iterate. ErrRecordNotFound is returned if the key
+// is deleted or expired after the keys are listed
+func (s *DiskStorage) peekRecord(key string) (*Record, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	keyData, found := s.keyDir[key]
+	if !found || keyData.expired(time.Now().UnixNano()) {
+		return nil, ErrRecordNotFound
+	}
+
+	return s.readRecord(keyData)
+}
+
+// readRecord will read the record at the keyDir entry, without counting it
+// as get. Caller must hold the lock
+func (s *DiskStorage) readRecord(keyData *keyDirEntry) (*Record, error) {
+	dataEntry, err := s.readEntry(keyData)
+	if err != nil {
+		s.logger.Error("unable to read entry", "fileID", keyData.FileID, "offset", keyData.LocationOffset, "error", err)
+		return nil, err
+	}
+
+	value, err := s.decompress(dataEntry.header.codec, dataEntry.value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{
+		Value:     value,
+		Timestamp: keyData.Timestamp,
+		Expiry:    keyData.Expiry,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package caskdb
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage_GetRecord(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	_, err := store.GetRecord([]byte("key"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	before := time.Now().UnixNano()
+	assert.Nil(t, store.SetWithTTL([]byte("key"), []byte("value"), time.Hour))
+
+	record, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, "value", string(record.Value))
+	assert.GreaterOrEqual(t, record.Timestamp, before)
+	assert.Greater(t, record.Expiry, record.Timestamp)
+
+	assert.Nil(t, store.Set([]byte("key"), []byte("new")))
+	updated, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Greater(t, updated.Timestamp, record.Timestamp)
+	assert.Equal(t, int64(0), updated.Expiry)
+}
+
+func TestDiskStorage_Update(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	// missing key is passed as nil
+	assert.Nil(t, store.Update([]byte("key"), func(record *Record) (*Record, error) {
+		assert.Nil(t, record)
+		return &Record{Value: []byte("value")}, nil
+	}))
+	old, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, "value", string(old.Value))
+
+	// error from fn will leave the key unchanged
+	errAbort := errors.New("abort")
+	assert.ErrorIs(t, store.Update([]byte("key"), func(record *Record) (*Record, error) {
+		return nil, errAbort
+	}), errAbort)
+
+	// nil record is rejected instead of deleting or emptying the key
+	assert.ErrorIs(t, store.Update([]byte("key"), func(record *Record) (*Record, error) {
+		return nil, nil
+	}), errNilRecord)
+	record, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, old, record)
+
+	assert.Nil(t, store.Update([]byte("key"), func(record *Record) (*Record, error) {
+		assert.Equal(t, old, record)
+		return &Record{Value: append(record.Value, "-updated"...), Timestamp: 1}, nil
+	}))
+	record, err = store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, "value-updated", string(record.Value))
+	assert.Greater(t, record.Timestamp, old.Timestamp)
+
+	// record that is already expired is written but can't be read
+	assert.Nil(t, store.Update([]byte("key"), func(record *Record) (*Record, error) {
+		return &Record{Value: record.Value, Expiry: time.Now().Add(-time.Second).UnixNano()}, nil
+	}))
+	_, err = store.Get([]byte("key"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestDiskStorage_Update_concurrent(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	increment := func(record *Record) (*Record, error) {
+		n := 0
+		if record != nil {
+			n, _ = strconv.Atoi(string(record.Value))
+		}
+		return &Record{Value: []byte(strconv.Itoa(n + 1))}, nil
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, store.Update([]byte("counter"), increment))
+			}
+		}()
+	}
+	wg.Wait()
+
+	res, err := store.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, "800", string(res))
+}
+
+func TestDiskStorage_nextTimestamp(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs)
+	store := NewDiskStorage("db/test", options)
+
+	// clock behind the last write, e.g. adjusted backwards, doesn't reuse the timestamp
+	future := time.Now().Add(time.Hour).UnixNano()
+	store.advanceTimestamp(future)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	record, err := store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, future+1, record.Timestamp)
+
+	assert.Nil(t, store.Delete([]byte("key")))
+	assert.Nil(t, store.Update([]byte("key"), func(*Record) (*Record, error) {
+		return &Record{Value: []byte("new")}, nil
+	}))
+	record, err = store.GetRecord([]byte("key"))
+	require.Nil(t, err)
+	assert.Equal(t, future+3, record.Timestamp)
+	assert.Nil(t, store.Close())
+
+	// the last timestamp is recovered from the hint files and the datafiles
+	store = NewDiskStorage("db/test", options)
+	assert.Nil(t, store.Set([]byte("other"), []byte("value")))
+	record, err = store.GetRecord([]byte("other"))
+	require.Nil(t, err)
+	assert.Equal(t, future+4, record.Timestamp)
+	assert.Nil(t, store.Close())
+
+	require.Nil(t, fs.Remove("db/test.hint"))
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	assert.Nil(t, store.Delete([]byte("other")))
+	assert.Nil(t, store.Set([]byte("other"), []byte("value")))
+	record, err = store.GetRecord([]byte("other"))
+	require.Nil(t, err)
+	assert.Equal(t, future+6, record.Timestamp)
+}
@@ -0,0 +1,122 @@
+package caskdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const quarantineFileExtension = "quarantine"
+
+// RepairReport is the result of Repair
+type RepairReport struct {
+	// Files is the salvaged entries and the corrupted ranges of every original datafile
+	Files []FileReport
+	// Quarantined is the name of every file holding a corrupted range
+	Quarantined []string
+	// FileIDs is the id of every datafile of the repaired database
+	FileIDs  []int
+	KeyCount int
+}
+
+// Repair will rebuild the database at dbPath from its damaged datafiles. Every
+// valid entry is copied in order to new datafiles, skipping the corrupted ranges
+// by resynchronizing on the next valid entry, then the original datafiles are
+// removed and the hint files are regenerated. Each corrupted range is written to
+// <dbPath>_<fileID>.<start>-<end>.quarantine for later inspection.
+// The database must not be opened while it is repaired, and the encryption key
+// is required to repair encrypted database. If repair is interrupted, the
+// database is still consistent, since the new datafiles replace the original
+// entries when the datafiles are loaded. Change log consumers read the salvaged
+// entries again, as the datafiles are replaced
+func Repair(dbPath string, options ...*Options) (report *RepairReport, err error) {
+	s := newDiskStorage(dbPath, options)
+	oldFileIDs := s.listDataFiles()
+	if len(oldFileIDs) == 0 {
+		return nil, fmt.Errorf("no datafile is found at %s", dbPath)
+	}
+
+	written := make([]string, 0)
+	defer func() {
+		for _, file := range s.files {
+			file.Close()
+		}
+		if err != nil {
+			for _, name := range written {
+				s.fs.Remove(name)
+			}
+		}
+	}()
+
+	s.activeFileID = oldFileIDs[len(oldFileIDs)-1]
+	fileID, _, err := s.addNewDataFile()
+	if err != nil {
+		return nil, err
+	}
+	written = append(written, s.dataFileName(fileID))
+
+	report = &RepairReport{Files: make([]FileReport, 0, len(oldFileIDs))}
+	now := time.Now().UnixNano()
+	for _, oldFileID := range oldFileIDs {
+		data, err := readFile(s.fs, s.dataFileName(oldFileID))
+		if err != nil {
+			return nil, err
+		}
+		if err = checkDataFileHeader(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.dataFileName(oldFileID), err)
+		}
+
+		f := FileReport{FileID: oldFileID, Size: int64(len(data))}
+		f.Corrupted = scanDataFile(data, func(offset int64, entryData []byte) {
+			if err != nil {
+				return
+			}
+			dataEntry := decodeEntry(entryData)
+			var keyData *keyDirEntry
+			if keyData, err = s.appendEntry(context.Background(), &dataEntry); err != nil {
+				return
+			}
+			if keyData.FileID != fileID {
+				fileID = keyData.FileID
+				written = append(written, s.dataFileName(fileID))
+			}
+			_, err = s.indexEntry(keyData.FileID, keyData.LocationOffset, entryData, now)
+			f.Entries++
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range f.Corrupted {
+			name := fmt.Sprintf("%s_%d.%d-%d.%s", dbPath, oldFileID, r.Start, r.End, quarantineFileExtension)
+			if err = writeFile(s.fs, name, data[r.Start:r.End]); err != nil {
+				return nil, err
+			}
+			written = append(written, name)
+			report.Quarantined = append(report.Quarantined, name)
+		}
+		report.Files = append(report.Files, f)
+	}
+
+	// the new datafiles must be durable before the original ones are removed
+	for _, file := range s.files {
+		if err = s.syncFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, oldFileID := range oldFileIDs {
+		if err = s.fs.Remove(s.dataFileName(oldFileID)); err != nil {
+			return nil, err
+		}
+	}
+	// the original datafiles are removed, the new datafiles must be kept from now on
+	written = nil
+	if err = s.flush(); err != nil {
+		return nil, err
+	}
+
+	report.FileIDs = s.sortedFileIDs()
+	report.KeyCount = len(s.keyDir)
+
+	return report, nil
+}
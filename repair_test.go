@@ -0,0 +1,95 @@
+package caskdb
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	assert.Nil(t, store.Delete([]byte("0")))
+	corrupted := store.keyDir["1"]
+	assert.Nil(t, store.Close())
+
+	data := fs.files[fmt.Sprintf("db/test_%d", corrupted.FileID)].data
+	end := corrupted.LocationOffset + corrupted.DataLength
+	data[end-1] ^= 0xff
+	original := append([]byte(nil), data[corrupted.LocationOffset:end]...)
+
+	report, err := Repair("db/test", options)
+	require.Nil(t, err)
+	assert.Equal(t, 48, report.KeyCount)
+	entries := 0
+	for _, f := range report.Files {
+		entries += f.Entries
+	}
+	assert.Equal(t, 50, entries)
+
+	// the corrupted range is quarantined as is
+	name := fmt.Sprintf("db/test_%d.%d-%d.quarantine", corrupted.FileID, corrupted.LocationOffset, end)
+	assert.Equal(t, []string{name}, report.Quarantined)
+	quarantined, err := readFile(fs, name)
+	require.Nil(t, err)
+	assert.Equal(t, original, quarantined)
+
+	verified, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.True(t, verified.OK())
+	assert.False(t, verified.Hint.Stale)
+
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	assert.True(t, store.loadHintFiles())
+	assert.Equal(t, report.FileIDs, store.sortedFileIDs())
+	for i := 0; i < 50; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		if i <= 1 {
+			assert.ErrorIs(t, err, ErrRecordNotFound)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, "value", string(res))
+	}
+}
+
+func TestRepair_encrypted(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetEncryptionKey([]byte("0123456789abcdef0123456789abcdef"))
+	store := NewDiskStorage("db/test", options)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, store.Close())
+	// the last entry is partially written
+	fs.files["db/test_0"].data = append(fs.files["db/test_0"].data, "partial"...)
+
+	// the encryption key is required, the database is left as is
+	_, err := Repair("db/test", NewOptions().SetFileSystem(fs))
+	assert.ErrorIs(t, err, errEncryptionKeyRequired)
+	names, err := fs.List("db")
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{"test_0", "test.hint"}, names)
+
+	report, err := Repair("db/test", options)
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.KeyCount)
+	require.Len(t, report.Files[0].Corrupted, 1)
+	assert.Equal(t, "truncated header", report.Files[0].Corrupted[0].Reason)
+
+	store = NewDiskStorage("db/test", options)
+	defer store.Close()
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
@@ -0,0 +1,660 @@
+package caskdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxReplicationChunk is the maximum size of entries sent in a single
+	// message, unless a single entry is larger than it
+	maxReplicationChunk = 64 * 1024
+
+	replicationHeartbeatInterval = time.Second
+	// replicationTimeout is how long the connection is kept without receiving anything
+	replicationTimeout = 10 * time.Second
+
+	epochFileExtension = "epoch"
+)
+
+var (
+	errReplicationPosition = errors.New("replication: position doesn't match the datafiles")
+	errReplicationEpoch    = errors.New("replication: epoch is missing from the message")
+)
+
+// Position is a location in the datafiles, entries are written
+// in ascending order of (FileID, Offset)
+type Position struct {
+	FileID int
+	Offset int64
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.FileID, p.Offset)
+}
+
+// after will return true if p is after o, the start of the datafile is the same as its first entry
+func (p Position) after(o Position) bool {
+	p, o = p.skipHeader(), o.skipHeader()
+	return p.FileID > o.FileID || (p.FileID == o.FileID && p.Offset > o.Offset)
+}
+
+// skipHeader will move the position at the start of the datafile to its first entry
+func (p Position) skipHeader() Position {
+	if p.Offset < dataFileHeaderLength {
+		p.Offset = dataFileHeaderLength
+	}
+
+	return p
+}
+
+type replicationKind uint8
+
+const (
+	// replicationData append Data to the file at Offset
+	replicationData replicationKind = iota + 1
+	// replicationRemove remove FileIDs that is removed from the primary by merge
+	replicationRemove
+	// replicationReset remove every file, the follower is replicating from the start
+	replicationReset
+	replicationHeartbeat
+	// replicationStart is the first message once the follower position is accepted
+	replicationStart
+)
+
+// replicationEpoch identify the history of the datafiles, the follower takes the
+// epoch of the primary, and a new epoch is started once it is promoted. The previous
+// epochs are kept along with where the new epoch is branched from them, so the
+// followers of the old primary can continue if they don't have newer entries
+type replicationEpoch struct {
+	ID string
+	// History is the previous epochs, the oldest is the first
+	History []epochBranch
+}
+
+// epochBranch is the previous epoch, entries before Position is shared with the newer epoch
+type epochBranch struct {
+	ID       string
+	Position Position
+}
+
+// shares will return true if the entries of the epoch id before
+// the position is part of the history of this epoch
+func (e replicationEpoch) shares(id string, p Position) bool {
+	if id == "" {
+		return false
+	}
+	if id == e.ID {
+		return true
+	}
+	for _, branch := range e.History {
+		if branch.ID == id {
+			return !p.after(branch.Position)
+		}
+	}
+
+	return false
+}
+
+func (e replicationEpoch) copy() *replicationEpoch {
+	e.History = append([]epochBranch(nil), e.History...)
+	return &e
+}
+
+func newEpochID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// replicationHello is sent by the follower once it is connected
+type replicationHello struct {
+	// Epoch is the epoch ID of the follower, it is empty if the follower never replicates
+	Epoch    string
+	Position Position
+	// LastOffset and Checksum are the last entry before Position, so the primary
+	// can check Position is the end of the same entry. They are only set if
+	// the datafile at Position has any entry
+	LastOffset int64
+	Checksum   uint32
+	FileIDs    []int
+}
+
+// replicationAck is sent by the follower after every message is applied
+type replicationAck struct {
+	Position Position
+}
+
+// replicationMessage is sent by the primary, the follower datafiles is
+// kept identical to the primary, so both use the same Position
+type replicationMessage struct {
+	Kind    replicationKind
+	FileID  int
+	Offset  int64
+	Data    []byte
+	FileIDs []int
+	// Epoch of the primary, it is set on replicationStart and replicationReset
+	Epoch *replicationEpoch
+	// Lag is the number of bytes the follower is behind the primary once the message is applied
+	Lag int64
+}
+
+// replicationCursor track what is already sent to a single follower
+type replicationCursor struct {
+	position Position
+	// files that the follower has
+	files map[int]bool
+	// started is set once the first message is sent, which is replicationReset
+	// if the follower position is rejected, otherwise replicationStart
+	started  bool
+	rejected bool
+}
+
+func newReplicationCursor(hello replicationHello) *replicationCursor {
+	c := &replicationCursor{position: hello.Position, files: make(map[int]bool)}
+	for _, fileID := range hello.FileIDs {
+		c.files[fileID] = true
+	}
+
+	return c
+}
+
+// nextReplicationMessage will return the message that brings the follower closer
+// to the primary and advance the cursor. nil message is returned once the
+// follower is caught up, the returned channel is closed on the next change
+func (s *DiskStorage) nextReplicationMessage(c *replicationCursor) (*replicationMessage, <-chan struct{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	fileIDs := s.sortedFileIDs()
+	reset := func() (*replicationMessage, <-chan struct{}, error) {
+		c.position = Position{FileID: fileIDs[0]}
+		c.files = make(map[int]bool)
+		return &replicationMessage{Kind: replicationReset, Epoch: s.epoch.copy(), Lag: s.lag(c.position)}, s.changed, nil
+	}
+	if !c.started {
+		c.started = true
+		if c.rejected {
+			return reset()
+		}
+		return &replicationMessage{Kind: replicationStart, Epoch: s.epoch.copy(), Lag: s.lag(c.position)}, s.changed, nil
+	}
+
+	for {
+		c.position = c.position.skipHeader()
+		file, found := s.files[c.position.FileID]
+		if !found {
+			// the file is removed by merge, every live entry is
+			// rewritten to the newer files, so continue from there
+			next, found := nextFileID(fileIDs, c.position.FileID)
+			if !found {
+				return reset()
+			}
+			c.position = Position{FileID: next}
+			continue
+		}
+
+		size := file.Size()
+		if c.position.Offset > size {
+			return reset()
+		}
+		if c.position.Offset < size {
+			data, err := readEntries(file, c.position.Offset, size)
+			if err != nil {
+				return nil, nil, err
+			}
+			// empty data means the rest of the file is partially written entry
+			if len(data) > 0 {
+				msg := &replicationMessage{
+					Kind:   replicationData,
+					FileID: c.position.FileID,
+					Offset: c.position.Offset,
+					Data:   data,
+				}
+				c.position.Offset += int64(len(data))
+				c.files[c.position.FileID] = true
+				msg.Lag = s.lag(c.position)
+
+				return msg, s.changed, nil
+			}
+		}
+
+		if next, found := nextFileID(fileIDs, c.position.FileID); found {
+			c.position = Position{FileID: next}
+			continue
+		}
+
+		// files removed by merge is only removed from the follower once it is caught up,
+		// so the keys are not missing while the merged files is being replicated
+		removed := make([]int, 0)
+		for fileID := range c.files {
+			if _, found := s.files[fileID]; !found {
+				removed = append(removed, fileID)
+				delete(c.files, fileID)
+			}
+		}
+		if len(removed) > 0 {
+			sort.Ints(removed)
+			return &replicationMessage{Kind: replicationRemove, FileIDs: removed}, s.changed, nil
+		}
+
+		return nil, s.changed, nil
+	}
+}
+
+// lag will return the number of bytes written after the position, caller must hold the lock
+func (s *DiskStorage) lag(p Position) int64 {
+	p = p.skipHeader()
+	var lag int64
+	for fileID, file := range s.files {
+		switch {
+		case fileID > p.FileID:
+			lag += file.Size() - dataFileHeaderLength
+		case fileID == p.FileID && file.Size() > p.Offset:
+			lag += file.Size() - p.Offset
+		}
+	}
+
+	return lag
+}
+
+// nextFileID will return the smallest id that is larger than fileID
+func nextFileID(fileIDs []int, fileID int) (int, bool) {
+	i := sort.SearchInts(fileIDs, fileID+1)
+	if i == len(fileIDs) {
+		return 0, false
+	}
+
+	return fileIDs[i], true
+}
+
+// readEntries will read complete entries starting at the offset, up to
+// maxReplicationChunk bytes unless the first entry is larger than it
+func readEntries(file *datafile, offset, size int64) ([]byte, error) {
+	header := make([]byte, defaultHeaderLength)
+	end := offset
+	for end+defaultHeaderLength <= size {
+		if _, err := file.ReadAt(header, end); err != nil {
+			return nil, err
+		}
+		h := decodeHeader(header)
+		if !entryFits(h, size-end) {
+			break
+		}
+		entrySize := int64(defaultHeaderLength + h.keySize + h.valueSize)
+		if end > offset && end+entrySize-offset > maxReplicationChunk {
+			break
+		}
+		end += entrySize
+	}
+
+	data := make([]byte, end-offset)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// replicaHello will return the hello to resume the replication from the end of
+// the datafiles, along with every file the follower has. Storage with partially
+// written entry is reset, since the entry is ambiguous
+func (s *DiskStorage) replicaHello() (replicationHello, error) {
+	s.fileRemoval.Lock()
+	defer s.fileRemoval.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	for _, file := range s.files {
+		if file.failed {
+			s.logger.Warn("replica has partially written entry, replicating from the start")
+			if err := s.resetReplica(); err != nil {
+				return replicationHello{}, err
+			}
+			break
+		}
+	}
+
+	hello := replicationHello{Epoch: s.epoch.ID, Position: s.headPosition(), FileIDs: s.sortedFileIDs()}
+	file, found := s.files[hello.Position.FileID]
+	if !found {
+		return hello, nil
+	}
+	var err error
+	var end int64
+	hello.LastOffset, hello.Checksum, end, err = lastEntry(file)
+	if err != nil {
+		return replicationHello{}, err
+	}
+	if end != hello.Position.Offset {
+		s.logger.Warn("replica has partially written entry, replicating from the start")
+		if err = s.resetReplica(); err != nil {
+			return replicationHello{}, err
+		}
+		return replicationHello{Epoch: s.epoch.ID}, nil
+	}
+
+	return hello, nil
+}
+
+// headPosition will return the end of the last datafile, caller must hold the lock
+func (s *DiskStorage) headPosition() Position {
+	fileIDs := s.sortedFileIDs()
+	if len(fileIDs) == 0 {
+		return Position{}
+	}
+	last := fileIDs[len(fileIDs)-1]
+
+	return Position{FileID: last, Offset: s.files[last].Size()}
+}
+
+// lastEntry will read the headers of the datafile, and return the offset and checksum
+// of its last entry, along with the end of the last complete entry
+func lastEntry(file *datafile) (offset int64, checksum uint32, end int64, err error) {
+	size := file.Size()
+	header := make([]byte, defaultHeaderLength)
+	end = dataFileHeaderLength
+	for end+defaultHeaderLength <= size {
+		if _, err = file.ReadAt(header, end); err != nil {
+			return 0, 0, 0, err
+		}
+		h := decodeHeader(header)
+		if !entryFits(h, size-end) {
+			break
+		}
+		offset, checksum = end, h.checksum
+		end += int64(defaultHeaderLength + h.keySize + h.valueSize)
+	}
+	if size < end {
+		end = size
+	}
+
+	return offset, checksum, end, nil
+}
+
+// checkReplicaHello will return error if the follower can't continue from its
+// position, it must be in the history of the epoch and at the end of the same
+// entry as the primary. The datafile that is removed by merge can't be checked,
+// the epoch is enough since every live entry is rewritten to the newer files
+func (s *DiskStorage) checkReplicaHello(hello replicationHello) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	if !s.epoch.shares(hello.Epoch, hello.Position) {
+		return fmt.Errorf("%w: epoch %q of the follower is not in the history of epoch %q",
+			errReplicationPosition, hello.Epoch, s.epoch.ID)
+	}
+	position := hello.Position.skipHeader()
+	file, found := s.files[position.FileID]
+	if !found || position.Offset == dataFileHeaderLength {
+		return nil
+	}
+
+	if position.Offset > file.Size() || hello.LastOffset < dataFileHeaderLength ||
+		hello.LastOffset > position.Offset-defaultHeaderLength {
+		return fmt.Errorf("%w: %s is not in the datafile", errReplicationPosition, position)
+	}
+	header := make([]byte, defaultHeaderLength)
+	if _, err := file.ReadAt(header, hello.LastOffset); err != nil {
+		return err
+	}
+	h := decodeHeader(header)
+	if !entryFits(h, position.Offset-hello.LastOffset) ||
+		hello.LastOffset+int64(defaultHeaderLength+h.keySize+h.valueSize) != position.Offset {
+		return fmt.Errorf("%w: %s is not the end of an entry", errReplicationPosition, position)
+	}
+	data := make([]byte, position.Offset-hello.LastOffset)
+	if _, err := file.ReadAt(data, hello.LastOffset); err != nil {
+		return err
+	}
+	if !validChecksum(data) || binary.LittleEndian.Uint32(data) != hello.Checksum {
+		return fmt.Errorf("%w: entry before %s is different", errReplicationPosition, position)
+	}
+
+	return nil
+}
+
+// primaryEpoch will start the epoch if the storage doesn't have any,
+// e.g. it is the first time the storage is used as primary
+func (s *DiskStorage) primaryEpoch() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.epoch.ID != "" {
+		return nil
+	}
+	id, err := newEpochID()
+	if err != nil {
+		return err
+	}
+
+	return s.setEpoch(replicationEpoch{ID: id})
+}
+
+// startEpoch will branch a new epoch from the end of the datafiles once the follower is promoted
+func (s *DiskStorage) startEpoch() error {
+	s.Lock()
+	defer s.Unlock()
+
+	id, err := newEpochID()
+	if err != nil {
+		return err
+	}
+	epoch := s.epoch.copy()
+	if epoch.ID != "" {
+		epoch.History = append(epoch.History, epochBranch{ID: epoch.ID, Position: s.headPosition()})
+	}
+	epoch.ID = id
+
+	return s.setEpoch(*epoch)
+}
+
+// setEpoch will write the epoch before it is used, caller must hold the lock
+func (s *DiskStorage) setEpoch(epoch replicationEpoch) error {
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(epoch); err != nil {
+		return err
+	}
+	if err := writeFile(s.fs, s.epochFileName(), b.Bytes()); err != nil {
+		return err
+	}
+	s.epoch = epoch
+
+	return nil
+}
+
+func (s *DiskStorage) loadEpoch() error {
+	b, err := readFile(s.fs, s.epochFileName())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(bytes.NewBuffer(b)).Decode(&s.epoch)
+}
+
+func (s *DiskStorage) epochFileName() string {
+	return fmt.Sprintf("%s.%s", s.dbFileFullPath, epochFileExtension)
+}
+
+// applyReplicated will append the entries replicated from the primary,
+// data must be complete entries that is written at the offset
+func (s *DiskStorage) applyReplicated(fileID int, offset int64, data []byte) error {
+	// entries is validated before anything is written
+	sizes := make([]int64, 0)
+	for rest := data; len(rest) > 0; {
+		if len(rest) < defaultHeaderLength {
+			return fmt.Errorf("%w: replicated entry is truncated", ErrCorrupted)
+		}
+		h := decodeHeader(rest)
+		if !entryFits(h, int64(len(rest))) {
+			return fmt.Errorf("%w: replicated entry is truncated", ErrCorrupted)
+		}
+		size := int64(defaultHeaderLength + h.keySize + h.valueSize)
+		if !validChecksum(rest[:size]) {
+			return fmt.Errorf("%w: replicated entry checksum mismatch", ErrCorrupted)
+		}
+		sizes = append(sizes, size)
+		rest = rest[size:]
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	file, found := s.files[fileID]
+	if !found {
+		if offset != dataFileHeaderLength {
+			return fmt.Errorf("%w: file %d doesn't exist", errReplicationPosition, fileID)
+		}
+		var err error
+		if file, err = openDataFile(s.fs, s.dataFileName(fileID)); err != nil {
+			return err
+		}
+		s.files[fileID] = file
+		if _, found = s.files[s.activeFileID]; !found || fileID > s.activeFileID {
+			s.activeFileID = fileID
+		}
+	}
+	if file.Size() != offset {
+		return fmt.Errorf("%w: file %d size is %d, expected %d", errReplicationPosition, fileID, file.Size(), offset)
+	}
+
+	_, _, err := file.Write(data)
+	if err == nil && s.syncWrites {
+		err = s.syncFile(file)
+	}
+	if err != nil {
+		file.failed = true
+		return err
+	}
+	atomic.AddUint64(&s.operations.bytesWritten, uint64(len(data)))
+
+	now := time.Now().UnixNano()
+	for _, size := range sizes {
+		dataEntry, err := s.indexEntry(fileID, offset, data[:size], now)
+		if err != nil {
+			return err
+		}
+		if err = s.notifyEntry(dataEntry); err != nil {
+			return err
+		}
+		offset += size
+		data = data[size:]
+	}
+	s.notifyChanged()
+
+	return nil
+}
+
+// removeReplicatedFiles will remove the files that is removed from the primary by merge
+func (s *DiskStorage) removeReplicatedFiles(fileIDs []int) error {
+	s.fileRemoval.Lock()
+	defer s.fileRemoval.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	removed := make(map[int]bool)
+	for _, fileID := range fileIDs {
+		file, found := s.files[fileID]
+		if !found {
+			continue
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := s.fs.Remove(file.fileID); err != nil {
+			return err
+		}
+		delete(s.files, fileID)
+		removed[fileID] = true
+	}
+
+	// the live keys is already rewritten to the newer files, the rest is deleted or expired
+	for key, keyData := range s.keyDir {
+		if removed[keyData.FileID] {
+			delete(s.keyDir, key)
+		}
+	}
+	if _, found := s.files[s.activeFileID]; !found {
+		if fileIDs := s.sortedFileIDs(); len(fileIDs) > 0 {
+			s.activeFileID = fileIDs[len(fileIDs)-1]
+		}
+	}
+	s.notifyChanged()
+
+	return nil
+}
+
+// resetReplica will remove every datafile and the hint files,
+// caller must hold fileRemoval and the write lock
+func (s *DiskStorage) resetReplica() error {
+	for fileID, file := range s.files {
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := s.fs.Remove(file.fileID); err != nil {
+			return err
+		}
+		delete(s.files, fileID)
+	}
+	if err := s.fs.Remove(s.hintFileName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.keyDir = make(map[string]*keyDirEntry)
+	s.notifyChanged()
+
+	return nil
+}
+
+// resetReplicated will remove every datafile and take the epoch of the primary,
+// the epoch is written after the datafiles are removed, so the follower that
+// is interrupted in the middle is reset again
+func (s *DiskStorage) resetReplicated(epoch replicationEpoch) error {
+	s.fileRemoval.Lock()
+	defer s.fileRemoval.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.resetReplica(); err != nil {
+		return err
+	}
+
+	return s.setEpoch(epoch)
+}
+
+// startReplicated will take the epoch of the primary once the follower position is accepted
+func (s *DiskStorage) startReplicated(epoch replicationEpoch) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.setEpoch(epoch)
+}
+
+// setReadOnly will reject every write while the storage is replicating
+func (s *DiskStorage) setReadOnly(readOnly bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.readOnly = readOnly
+	// the replica might not have any datafile after it is reset
+	if !readOnly && len(s.files) == 0 {
+		if _, _, err := s.addNewDataFile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package caskdb
+
+import (
+	"bufio"
+	"encoding/gob"
+	"net"
+	"sync"
+	"time"
+)
+
+// replicationReconnectDelay is the delay before reconnecting to the primary
+const replicationReconnectDelay = 500 * time.Millisecond
+
+// Follower keep the storage as a read-only copy of the primary, the
+// connection is retried until the follower is closed or promoted
+type Follower struct {
+	store *DiskStorage
+	addr  string
+
+	mu      sync.Mutex
+	status  FollowerStatus
+	conn    net.Conn
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// FollowerStatus is the state of the replication as seen by the follower
+type FollowerStatus struct {
+	Connected bool
+	// Position is the end of the last entry replicated from the primary
+	Position Position
+	// Lag is the number of bytes the follower is behind the primary as of LastContact
+	Lag         int64
+	LastContact time.Time
+	// Err is the reason the last connection is failed
+	Err error
+}
+
+// NewFollower will replicate the storage from the primary at addr, writing to
+// the storage returns ErrReadOnly until the follower is promoted. The storage
+// must be opened with the same encryption key and compressor as the primary
+func NewFollower(store *DiskStorage, addr string) *Follower {
+	if err := store.setReadOnly(true); err != nil {
+		panic(err)
+	}
+
+	f := &Follower{
+		store: store,
+		addr:  addr,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go f.run()
+
+	return f
+}
+
+func (f *Follower) Status() FollowerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.status
+}
+
+// Close will stop the replication, the storage is still read-only
+func (f *Follower) Close() error {
+	f.mu.Lock()
+	if !f.stopped {
+		f.stopped = true
+		close(f.stop)
+		if f.conn != nil {
+			f.conn.Close()
+		}
+	}
+	f.mu.Unlock()
+
+	<-f.done
+
+	return nil
+}
+
+// Promote will stop the replication and make the storage writable, so it
+// can be used as the new primary. The new primary starts a new epoch, so the
+// old primary that has entries that are not replicated is reset once it
+// replicates from the new primary
+func (f *Follower) Promote() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := f.store.startEpoch(); err != nil {
+		return err
+	}
+
+	return f.store.setReadOnly(false)
+}
+
+func (f *Follower) run() {
+	defer close(f.done)
+
+	for {
+		err := f.replicate()
+
+		f.mu.Lock()
+		f.status.Connected = false
+		if err != nil && !f.stopped {
+			f.status.Err = err
+			f.store.logger.Error("replication is disconnected", "primary", f.addr, "error", err)
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(replicationReconnectDelay):
+		}
+	}
+}
+
+// replicate will apply messages from the primary until the connection is failed
+func (f *Follower) replicate() error {
+	conn, err := net.DialTimeout("tcp", f.addr, replicationTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return nil
+	}
+	f.conn = conn
+	f.mu.Unlock()
+
+	hello, err := f.store.replicaHello()
+	if err != nil {
+		return err
+	}
+	position := hello.Position
+
+	w := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(w)
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	conn.SetWriteDeadline(time.Now().Add(replicationTimeout))
+	if err = enc.Encode(hello); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(replicationTimeout))
+		var msg replicationMessage
+		if err = dec.Decode(&msg); err != nil {
+			return err
+		}
+
+		if (msg.Kind == replicationStart || msg.Kind == replicationReset) && msg.Epoch == nil {
+			return errReplicationEpoch
+		}
+
+		switch msg.Kind {
+		case replicationData:
+			if err = f.store.applyReplicated(msg.FileID, msg.Offset, msg.Data); err != nil {
+				return err
+			}
+			position = Position{FileID: msg.FileID, Offset: msg.Offset + int64(len(msg.Data))}
+		case replicationRemove:
+			if err = f.store.removeReplicatedFiles(msg.FileIDs); err != nil {
+				return err
+			}
+		case replicationStart:
+			if err = f.store.startReplicated(*msg.Epoch); err != nil {
+				return err
+			}
+		case replicationReset:
+			if err = f.store.resetReplicated(*msg.Epoch); err != nil {
+				return err
+			}
+			position = Position{}
+		}
+
+		f.mu.Lock()
+		f.status = FollowerStatus{
+			Connected:   true,
+			Position:    position,
+			Lag:         msg.Lag,
+			LastContact: time.Now(),
+		}
+		f.mu.Unlock()
+
+		conn.SetWriteDeadline(time.Now().Add(replicationTimeout))
+		if err = enc.Encode(replicationAck{Position: position}); err != nil {
+			return err
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+	}
+}
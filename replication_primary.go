@@ -0,0 +1,229 @@
+package caskdb
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrReplicationServerClosed is returned by Serve after Close is called
+var ErrReplicationServerClosed = errors.New("replication: server closed")
+
+// ReplicationServer stream every entry appended to the primary storage to
+// the followers, including the files created and removed by merge
+type ReplicationServer struct {
+	store *DiskStorage
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	replicas  map[net.Conn]*replica
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// ReplicaStatus is the state of a connected follower as seen by the primary
+type ReplicaStatus struct {
+	Addr string
+	// Position is acknowledged by the follower
+	Position Position
+	// Lag is the number of bytes that is not acknowledged by the follower
+	Lag int64
+}
+
+type replica struct {
+	addr string
+
+	mu       sync.Mutex
+	position Position
+}
+
+func NewReplicationServer(store *DiskStorage) *ReplicationServer {
+	return &ReplicationServer{
+		store:     store,
+		listeners: make(map[net.Listener]struct{}),
+		replicas:  make(map[net.Conn]*replica),
+		done:      make(chan struct{}),
+	}
+}
+
+func (r *ReplicationServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return r.Serve(l)
+}
+
+// Serve will accept followers from the listener, each follower
+// is handled by its own goroutine
+func (r *ReplicationServer) Serve(l net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		l.Close()
+		return ErrReplicationServerClosed
+	}
+	r.listeners[l] = struct{}{}
+	r.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return ErrReplicationServerClosed
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return ErrReplicationServerClosed
+		}
+		r.replicas[conn] = &replica{addr: conn.RemoteAddr().String()}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go r.handle(conn)
+	}
+}
+
+// Close will stop every listener and disconnect every follower,
+// it doesn't close the store
+func (r *ReplicationServer) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+	}
+	for l := range r.listeners {
+		l.Close()
+	}
+	for conn := range r.replicas {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	return nil
+}
+
+// Replicas will return every connected follower sorted by its address
+func (r *ReplicationServer) Replicas() []ReplicaStatus {
+	r.mu.Lock()
+	replicas := make([]ReplicaStatus, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		rep.mu.Lock()
+		replicas = append(replicas, ReplicaStatus{Addr: rep.addr, Position: rep.position})
+		rep.mu.Unlock()
+	}
+	r.mu.Unlock()
+
+	r.store.RLock()
+	for i := range replicas {
+		replicas[i].Lag = r.store.lag(replicas[i].Position)
+	}
+	r.store.RUnlock()
+
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].Addr < replicas[j].Addr
+	})
+
+	return replicas
+}
+
+func (r *ReplicationServer) handle(conn net.Conn) {
+	r.mu.Lock()
+	rep := r.replicas[conn]
+	r.mu.Unlock()
+
+	var acks sync.WaitGroup
+	defer func() {
+		conn.Close()
+		acks.Wait()
+		r.mu.Lock()
+		delete(r.replicas, conn)
+		r.mu.Unlock()
+		r.wg.Done()
+	}()
+
+	w := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(w)
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+
+	var hello replicationHello
+	conn.SetReadDeadline(time.Now().Add(replicationTimeout))
+	if err := dec.Decode(&hello); err != nil {
+		r.store.logger.Error("unable to read replication hello", "addr", rep.addr, "error", err)
+		return
+	}
+	rep.mu.Lock()
+	rep.position = hello.Position
+	rep.mu.Unlock()
+
+	// the follower acknowledge every message, so the connection
+	// is closed once nothing is received for replicationTimeout
+	acks.Add(1)
+	go func() {
+		defer acks.Done()
+		for {
+			conn.SetReadDeadline(time.Now().Add(replicationTimeout))
+			var ack replicationAck
+			if err := dec.Decode(&ack); err != nil {
+				conn.Close()
+				return
+			}
+			rep.mu.Lock()
+			rep.position = ack.Position
+			rep.mu.Unlock()
+		}
+	}()
+
+	cursor := newReplicationCursor(hello)
+	if err := r.store.primaryEpoch(); err != nil {
+		r.store.logger.Error("unable to start replication epoch", "addr", rep.addr, "error", err)
+		return
+	}
+	if err := r.store.checkReplicaHello(hello); err != nil {
+		r.store.logger.Warn("follower is replicating from the start", "addr", rep.addr, "error", err)
+		cursor.rejected = true
+	}
+	heartbeat := time.NewTicker(replicationHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		msg, changed, err := r.store.nextReplicationMessage(cursor)
+		if err != nil {
+			r.store.logger.Error("unable to read entries to replicate", "addr", rep.addr, "error", err)
+			return
+		}
+		if msg == nil {
+			if err = w.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-changed:
+				continue
+			case <-heartbeat.C:
+				msg = &replicationMessage{Kind: replicationHeartbeat}
+			case <-r.done:
+				return
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(replicationTimeout))
+		if err = enc.Encode(msg); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package caskdb
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReplicationServer(t *testing.T, primary *DiskStorage) (*ReplicationServer, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	server := NewReplicationServer(primary)
+	go server.Serve(l)
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+	})
+
+	return server, l.Addr().String()
+}
+
+// waitForReplica will wait until the follower has every entry of the primary
+func waitForReplica(t *testing.T, primary *DiskStorage, follower *Follower) {
+	require.Eventually(t, func() bool {
+		primary.RLock()
+		fileIDs := primary.sortedFileIDs()
+		last := fileIDs[len(fileIDs)-1]
+		head := Position{FileID: last, Offset: primary.files[last].Size()}
+		primary.RUnlock()
+
+		status := follower.Status()
+		return status.Connected && status.Position == head && status.Lag == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// assertSameData will assert every key and datafile of both storage is the same
+func assertSameData(t *testing.T, primary, follower *DiskStorage) {
+	expected := make(map[string]string)
+	assert.Nil(t, primary.Iterate(func(key, value []byte) error {
+		expected[string(key)] = string(value)
+		return nil
+	}))
+	actual := make(map[string]string)
+	assert.Nil(t, follower.Iterate(func(key, value []byte) error {
+		actual[string(key)] = string(value)
+		return nil
+	}))
+	assert.Equal(t, expected, actual)
+
+	primary.RLock()
+	follower.RLock()
+	defer primary.RUnlock()
+	defer follower.RUnlock()
+	assert.Equal(t, primary.sortedFileIDs(), follower.sortedFileIDs())
+	for fileID, file := range primary.files {
+		assert.Equal(t, file.Size(), follower.files[fileID].Size())
+	}
+}
+
+func TestReplication(t *testing.T) {
+	t.Parallel()
+
+	primary := NewDiskStorage("db/primary", NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB"))
+	defer primary.Close()
+	server, addr := newTestReplicationServer(t, primary)
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, primary.Set([]byte(strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))))
+	}
+
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+	follower := NewFollower(store, addr)
+	defer follower.Close()
+
+	waitForReplica(t, primary, follower)
+	assertSameData(t, primary, store)
+
+	// new entry is streamed once it is written
+	assert.Nil(t, primary.Delete([]byte("0")))
+	assert.Nil(t, primary.SetWithTTL([]byte("ttl"), []byte("value"), time.Hour))
+	waitForReplica(t, primary, follower)
+	assertSameData(t, primary, store)
+	_, err := store.Get([]byte("0"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	assert.ErrorIs(t, store.Set([]byte("key"), []byte("value")), ErrReadOnly)
+	assert.ErrorIs(t, store.Delete([]byte("1")), ErrReadOnly)
+	assert.ErrorIs(t, store.Merge(), ErrReadOnly)
+
+	replicas := server.Replicas()
+	require.Len(t, replicas, 1)
+	assert.Equal(t, follower.Status().Position, replicas[0].Position)
+	assert.Equal(t, int64(0), replicas[0].Lag)
+}
+
+func TestReplication_merge(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	primary := NewDiskStorage("db/primary", NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		SetMaxFileSize("1KB").
+		SetEncryptionKey(key))
+	defer primary.Close()
+	_, addr := newTestReplicationServer(t, primary)
+
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(NewMemFileSystem()).SetEncryptionKey(key))
+	defer store.Close()
+	follower := NewFollower(store, addr)
+	defer follower.Close()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 50; i++ {
+			assert.Nil(t, primary.Set([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(round))))
+		}
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, primary.Delete([]byte(strconv.Itoa(round*10+i))))
+		}
+		assert.Nil(t, primary.Merge())
+
+		waitForReplica(t, primary, follower)
+		assertSameData(t, primary, store)
+	}
+}
+
+func TestReplication_resume(t *testing.T) {
+	t.Parallel()
+
+	primary := NewDiskStorage("db/primary", NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB"))
+	defer primary.Close()
+	_, addr := newTestReplicationServer(t, primary)
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, primary.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	fs := NewMemFileSystem()
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(fs))
+	follower := NewFollower(store, addr)
+	waitForReplica(t, primary, follower)
+	assert.Nil(t, follower.Close())
+	assert.Nil(t, store.Close())
+	position := follower.Status().Position
+
+	for i := 50; i < 100; i++ {
+		assert.Nil(t, primary.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	// the follower continue from its own datafiles
+	store = NewDiskStorage("db/follower", NewOptions().SetFileSystem(fs))
+	defer store.Close()
+	hello, err := store.replicaHello()
+	assert.Nil(t, err)
+	assert.Equal(t, position, hello.Position)
+	assert.Nil(t, primary.checkReplicaHello(hello))
+
+	follower = NewFollower(store, addr)
+	defer follower.Close()
+	waitForReplica(t, primary, follower)
+	assertSameData(t, primary, store)
+}
+
+func TestReplication_reset(t *testing.T) {
+	t.Parallel()
+
+	primary := NewDiskStorage("db/primary", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer primary.Close()
+	_, addr := newTestReplicationServer(t, primary)
+	assert.Nil(t, primary.Set([]byte("key"), []byte("value")))
+
+	// the follower has newer datafiles than the primary, e.g. it was replicating
+	// from other primary, so it has to start over
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB"))
+	defer store.Close()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte("other"+strconv.Itoa(i)), []byte("value")))
+	}
+
+	follower := NewFollower(store, addr)
+	defer follower.Close()
+	waitForReplica(t, primary, follower)
+	assertSameData(t, primary, store)
+}
+
+func TestFollower_Promote(t *testing.T) {
+	t.Parallel()
+
+	primary := NewDiskStorage("db/primary", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer primary.Close()
+	server, addr := newTestReplicationServer(t, primary)
+	assert.Nil(t, primary.Set([]byte("key"), []byte("value")))
+
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+	follower := NewFollower(store, addr)
+	waitForReplica(t, primary, follower)
+
+	// the primary is gone, the follower keeps reconnecting
+	assert.Nil(t, server.Close())
+	require.Eventually(t, func() bool {
+		status := follower.Status()
+		return !status.Connected && status.Err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, follower.Promote())
+	assert.Nil(t, store.Set([]byte("new"), []byte("value")))
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
+
+func TestReplication_failover(t *testing.T) {
+	t.Parallel()
+
+	primary := NewDiskStorage("db/primary", NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB"))
+	defer primary.Close()
+	server, addr := newTestReplicationServer(t, primary)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, primary.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	newPrimary := NewDiskStorage("db/new", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer newPrimary.Close()
+	follower := NewFollower(newPrimary, addr)
+	other := NewDiskStorage("db/other", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer other.Close()
+	otherFollower := NewFollower(other, addr)
+	waitForReplica(t, primary, follower)
+	waitForReplica(t, primary, otherFollower)
+
+	// the old primary still accepts the write that is never replicated
+	assert.Nil(t, otherFollower.Close())
+	assert.Nil(t, follower.Promote())
+	assert.Nil(t, primary.Set([]byte("lost"), []byte("value")))
+	assert.Nil(t, server.Close())
+	// the entry has the same size as the lost entry, so the old primary
+	// position is the end of an entry in the new primary as well
+	assert.Nil(t, newPrimary.Set([]byte("kept"), []byte("value")))
+	_, newAddr := newTestReplicationServer(t, newPrimary)
+
+	// the other follower doesn't have newer entries than the new primary, so
+	// it can continue, unless its position is not the end of the same entry
+	hello, err := other.replicaHello()
+	require.Nil(t, err)
+	assert.Nil(t, newPrimary.checkReplicaHello(hello))
+	invalid := hello
+	invalid.Position.Offset--
+	assert.ErrorIs(t, newPrimary.checkReplicaHello(invalid), errReplicationPosition)
+	invalid = hello
+	invalid.Checksum++
+	assert.ErrorIs(t, newPrimary.checkReplicaHello(invalid), errReplicationPosition)
+	invalid = hello
+	invalid.Epoch = "unknown"
+	assert.ErrorIs(t, newPrimary.checkReplicaHello(invalid), errReplicationPosition)
+
+	// the old primary has the entry after the new primary is branched, so it is reset
+	hello, err = primary.replicaHello()
+	require.Nil(t, err)
+	assert.ErrorIs(t, newPrimary.checkReplicaHello(hello), errReplicationPosition)
+
+	for _, store := range []*DiskStorage{other, primary} {
+		follower := NewFollower(store, newAddr)
+		defer follower.Close()
+		waitForReplica(t, newPrimary, follower)
+		assertSameData(t, newPrimary, store)
+	}
+	_, err = primary.Get([]byte("lost"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	res, err := primary.Get([]byte("kept"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
@@ -0,0 +1,265 @@
+package resp
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+const defaultScanCount = 10
+
+var (
+	errSyntax        = Error("ERR syntax error")
+	errNotInteger    = Error("ERR value is not an integer or out of range")
+	errInvalidCursor = Error("ERR invalid cursor")
+	errInvalidExpire = Error("ERR invalid expire time in 'set' command")
+	errStopIteration = errors.New("stop iteration")
+)
+
+// CommandFunc will execute the command and write its reply, args doesn't include
+// the command name. Returned error is replied as error, Error is replied as is
+type CommandFunc func(store caskdb.Store, w *Writer, args [][]byte) error
+
+type command struct {
+	// minArgs and maxArgs include the command name, maxArgs 0 means unlimited
+	minArgs int
+	maxArgs int
+	fn      CommandFunc
+}
+
+var commands = map[string]command{
+	"ping":    {minArgs: 1, maxArgs: 2, fn: ping},
+	"get":     {minArgs: 2, maxArgs: 2, fn: get},
+	"set":     {minArgs: 3, fn: set},
+	"del":     {minArgs: 2, fn: del},
+	"exists":  {minArgs: 2, fn: exists},
+	"keys":    {minArgs: 2, maxArgs: 2, fn: keys},
+	"scan":    {minArgs: 2, fn: scan},
+	"mget":    {minArgs: 2, fn: mget},
+	"mset":    {minArgs: 3, fn: mset},
+	"command": {minArgs: 1, fn: commandInfo},
+}
+
+func ping(_ caskdb.Store, w *Writer, args [][]byte) error {
+	if len(args) == 1 {
+		w.WriteBulk(args[0])
+	} else {
+		w.WriteSimpleString("PONG")
+	}
+
+	return nil
+}
+
+func get(store caskdb.Store, w *Writer, args [][]byte) error {
+	value, err := store.Get(args[0])
+	if errors.Is(err, caskdb.ErrRecordNotFound) {
+		w.WriteBulk(nil)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	w.WriteBulk(value)
+	return nil
+}
+
+// set supports EX seconds and PX milliseconds option
+func set(store caskdb.Store, w *Writer, args [][]byte) error {
+	key, value := args[0], args[1]
+
+	var ttl time.Duration
+	options := args[2:]
+	for len(options) > 0 {
+		option := strings.ToLower(string(options[0]))
+		if (option != "ex" && option != "px") || len(options) < 2 || ttl != 0 {
+			return errSyntax
+		}
+		n, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		unit := time.Second
+		if option == "px" {
+			unit = time.Millisecond
+		}
+		// the expiry is stored as unix nanoseconds, so it must not overflow int64
+		if n <= 0 || n > (math.MaxInt64-time.Now().UnixNano())/int64(unit) {
+			return errInvalidExpire
+		}
+		ttl = time.Duration(n) * unit
+		options = options[2:]
+	}
+
+	var err error
+	if ttl > 0 {
+		err = store.SetWithTTL(key, value, ttl)
+	} else {
+		err = store.Set(key, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.WriteSimpleString("OK")
+	return nil
+}
+
+func del(store caskdb.Store, w *Writer, args [][]byte) error {
+	var deleted int64
+	for _, key := range args {
+		err := store.Delete(key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		deleted++
+	}
+
+	w.WriteInteger(deleted)
+	return nil
+}
+
+func exists(store caskdb.Store, w *Writer, args [][]byte) error {
+	var count int64
+	for _, key := range args {
+		_, err := store.Get(key)
+		if errors.Is(err, caskdb.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		count++
+	}
+
+	w.WriteInteger(count)
+	return nil
+}
+
+func keys(store caskdb.Store, w *Writer, args [][]byte) error {
+	matched := make([][]byte, 0)
+	err := store.IterateKeys(func(key []byte) error {
+		if matchPattern(args[0], key) {
+			matched = append(matched, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteArrayHeader(len(matched))
+	for _, key := range matched {
+		w.WriteBulk(key)
+	}
+	return nil
+}
+
+// scan use the position of the key in the ascending key order as the
+// cursor, so key that is added or removed during the scan might shift
+// the position of other keys
+func scan(store caskdb.Store, w *Writer, args [][]byte) error {
+	cursor, err := strconv.Atoi(string(args[0]))
+	if err != nil || cursor < 0 {
+		return errInvalidCursor
+	}
+
+	var pattern []byte
+	count := defaultScanCount
+	options := args[1:]
+	for len(options) > 0 {
+		if len(options) < 2 {
+			return errSyntax
+		}
+		switch strings.ToLower(string(options[0])) {
+		case "match":
+			pattern = options[1]
+		case "count":
+			count, err = strconv.Atoi(string(options[1]))
+			if err != nil {
+				return errNotInteger
+			}
+			if count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+		options = options[2:]
+	}
+
+	position := 0
+	nextCursor := 0
+	matched := make([][]byte, 0)
+	err = store.IterateKeys(func(key []byte) error {
+		defer func() { position++ }()
+
+		if position < cursor {
+			return nil
+		}
+		if position >= cursor+count {
+			nextCursor = position
+			return errStopIteration
+		}
+		if pattern == nil || matchPattern(pattern, key) {
+			matched = append(matched, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+
+	w.WriteArrayHeader(2)
+	w.WriteBulk([]byte(strconv.Itoa(nextCursor)))
+	w.WriteArrayHeader(len(matched))
+	for _, key := range matched {
+		w.WriteBulk(key)
+	}
+	return nil
+}
+
+func mget(store caskdb.Store, w *Writer, args [][]byte) error {
+	values := make([][]byte, len(args))
+	for i, key := range args {
+		value, err := store.Get(key)
+		if err != nil && !errors.Is(err, caskdb.ErrRecordNotFound) {
+			return err
+		}
+		values[i] = value
+	}
+
+	w.WriteArrayHeader(len(values))
+	for _, value := range values {
+		w.WriteBulk(value)
+	}
+	return nil
+}
+
+// mset is not atomic, if one of the key is failed to be set,
+// the keys before it is already set
+func mset(store caskdb.Store, w *Writer, args [][]byte) error {
+	if len(args)%2 != 0 {
+		return Error("ERR wrong number of arguments for 'mset' command")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if err := store.Set(args[i], args[i+1]); err != nil {
+			return err
+		}
+	}
+
+	w.WriteSimpleString("OK")
+	return nil
+}
+
+// commandInfo reply empty list, it is only implemented
+// because redis-cli send COMMAND DOCS on startup
+func commandInfo(_ caskdb.Store, w *Writer, _ [][]byte) error {
+	w.WriteArrayHeader(0)
+	return nil
+}
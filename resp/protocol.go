@@ -0,0 +1,244 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkLength is the same as redis proto-max-bulk-len default
+	maxBulkLength = 512 * 1024 * 1024
+	// maxArrayLength limit number of arguments of a single command
+	maxArrayLength = 1024 * 1024
+	// readChunkSize is the most bytes allocated ahead of the received data,
+	// so the declared length alone can't make the reader allocate the whole bulk
+	readChunkSize = 64 * 1024
+)
+
+var errProtocol = errors.New("protocol error")
+
+// Error is RESP error reply, e.g. "-ERR unknown command"
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Reader will read RESP value, the type of the returned value depends on
+// the reply type: simple string is string, error is Error, integer is
+// int64, bulk string is []byte and array is []interface{}. Null bulk
+// string and null array is returned as nil
+type Reader struct {
+	r *bufio.Reader
+	// maxBulkLength limit the length of a single bulk string
+	maxBulkLength int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), maxBulkLength: maxBulkLength}
+}
+
+// Buffered returns true if there is data that can be read without blocking,
+// it is used to detect pipelined commands
+func (r *Reader) Buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+func (r *Reader) ReadValue() (interface{}, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: empty line", errProtocol)
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid integer", errProtocol)
+		}
+		return n, nil
+	case '$':
+		b, err := r.readBulk(line)
+		if b == nil {
+			return nil, err
+		}
+		return b, nil
+	case '*':
+		n, err := parseLength(line, maxArrayLength)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]interface{}, 0, capLength(n))
+		for i := 0; i < n; i++ {
+			v, err := r.ReadValue()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+		return array, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", errProtocol, line[0])
+	}
+}
+
+// ReadCommand will read a command, it is either an array of bulk
+// strings or an inline command separated by spaces
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	b, err := r.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if b[0] != '*' {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		// line is only valid until the next read, so it must be copied
+		return bytes.Fields(append([]byte{}, line...)), nil
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseLength(line, maxArrayLength)
+	if err != nil || n < 0 {
+		return nil, err
+	}
+
+	args := make([][]byte, 0, capLength(n))
+	for i := 0; i < n; i++ {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, line)
+		}
+		arg, err := r.readBulk(line)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func (r *Reader) readBulk(line []byte) ([]byte, error) {
+	n, err := parseLength(line, r.maxBulkLength)
+	if err != nil || n < 0 {
+		return nil, err
+	}
+
+	// the buffer is grown as the data arrives instead of trusting the declared length
+	b := make([]byte, 0, capLength(n+2))
+	for len(b) < n+2 {
+		chunk := n + 2 - len(b)
+		if chunk > readChunkSize {
+			chunk = readChunkSize
+		}
+		b = append(b, make([]byte, chunk)...)
+		if _, err = io.ReadFull(r.r, b[len(b)-chunk:]); err != nil {
+			return nil, err
+		}
+	}
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", errProtocol)
+	}
+
+	return b[:n], nil
+}
+
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line too long", errProtocol)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// parseLength will parse length of bulk string or array, -1 means null
+func parseLength(line []byte, max int) (int, error) {
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > max {
+		return 0, fmt.Errorf("%w: invalid length", errProtocol)
+	}
+
+	return n, nil
+}
+
+// Writer will write RESP value, it is buffered so Flush must be called
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) WriteSimpleString(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+func (w *Writer) WriteError(s string) {
+	w.w.WriteString("-" + s + "\r\n")
+}
+
+func (w *Writer) WriteInteger(n int64) {
+	w.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// WriteBulk will write bulk string, nil is written as null bulk string
+func (w *Writer) WriteBulk(b []byte) {
+	if b == nil {
+		w.w.WriteString("$-1\r\n")
+		return
+	}
+	w.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *Writer) WriteArrayHeader(n int) {
+	w.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// WriteCommand will write the command as array of bulk strings
+func (w *Writer) WriteCommand(args ...[]byte) {
+	w.WriteArrayHeader(len(args))
+	for _, arg := range args {
+		if arg == nil {
+			arg = []byte{}
+		}
+		w.WriteBulk(arg)
+	}
+}
+
+// capLength will return the capacity allocated up front for the declared length n
+func capLength(n int) int {
+	if n > readChunkSize {
+		return readChunkSize
+	}
+	return n
+}
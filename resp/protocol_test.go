@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_readBulk(t *testing.T) {
+	t.Parallel()
+
+	value := strings.Repeat("v", 3*readChunkSize+1)
+	r := NewReader(strings.NewReader("*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"))
+	args, err := r.ReadCommand()
+	require.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("SET"), []byte(value)}, args)
+
+	r = NewReader(strings.NewReader("$5\r\nvalue\r\n"))
+	v, err := r.ReadValue()
+	require.Nil(t, err)
+	assert.Equal(t, []byte("value"), v)
+
+	r = NewReader(strings.NewReader("$5\r\nvalue!!"))
+	_, err = r.ReadValue()
+	assert.ErrorIs(t, err, errProtocol)
+}
+
+func TestReader_readBulk_declaredLength(t *testing.T) {
+	// bulk string declaring the maximum length is not allocated before its data arrives
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		r := NewReader(bytes.NewReader([]byte("*1\r\n$" + strconv.Itoa(maxBulkLength) + "\r\nshort")))
+		_, err := r.ReadCommand()
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(10*1024*1024))
+}
@@ -0,0 +1,190 @@
+// Package resp implements a server that speaks the Redis serialization
+// protocol (RESP) on top of caskdb.Store, so existing redis clients can
+// be used to access the database
+package resp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+// ErrServerClosed is returned by Serve after Close is called
+var ErrServerClosed = errors.New("resp: server closed")
+
+// defaultMaxBulkBytes is the default of Server.MaxBulkBytes
+const defaultMaxBulkBytes = 64 * 1024 * 1024
+
+type Server struct {
+	store    caskdb.Store
+	commands map[string]command
+	// MaxBulkBytes limit the size of a single argument, e.g. the value of SET,
+	// default is 64MB
+	MaxBulkBytes int
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer(store caskdb.Store) *Server {
+	s := &Server{
+		store:        store,
+		commands:     make(map[string]command, len(commands)),
+		MaxBulkBytes: defaultMaxBulkBytes,
+		listeners:    make(map[net.Listener]struct{}),
+		conns:        make(map[net.Conn]struct{}),
+	}
+	for name, cmd := range commands {
+		s.commands[name] = cmd
+	}
+
+	return s
+}
+
+// Register will add new command or replace the existing one, minArgs and
+// maxArgs include the command name and maxArgs 0 means unlimited.
+// It must be called before Serve
+func (s *Server) Register(name string, minArgs, maxArgs int, fn CommandFunc) {
+	s.commands[strings.ToLower(name)] = command{minArgs: minArgs, maxArgs: maxArgs, fn: fn}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve will accept connection from the listener, each connection
+// is handled by its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Close will stop every listener and close every connection,
+// it doesn't close the store
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := NewReader(conn)
+	r.maxBulkLength = s.MaxBulkBytes
+	w := NewWriter(conn)
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.WriteError("ERR Protocol error: " + strings.TrimPrefix(err.Error(), errProtocol.Error()+": "))
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := s.execute(w, args)
+
+		// pipelined commands is replied at once
+		if !r.Buffered() || quit {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// execute will run the command and write its reply, it returns
+// true if the connection should be closed
+func (s *Server) execute(w *Writer, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		w.WriteSimpleString("OK")
+		return true
+	}
+
+	cmd, found := s.commands[name]
+	if !found {
+		w.WriteError("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs > 0 && len(args) > cmd.maxArgs) {
+		w.WriteError("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+
+	if err := cmd.fn(s.store, w, args[1:]); err != nil {
+		var respErr Error
+		if errors.As(err, &respErr) {
+			w.WriteError(respErr.Error())
+		} else {
+			w.WriteError("ERR " + err.Error())
+		}
+	}
+
+	return false
+}
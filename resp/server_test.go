@@ -0,0 +1,250 @@
+package resp
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+type testClient struct {
+	conn net.Conn
+	r    *Reader
+	w    *Writer
+}
+
+func newTestServer(t *testing.T) (*Server, *testClient) {
+	store := caskdb.NewDiskStorage("db/test", caskdb.NewOptions().SetFileSystem(caskdb.NewMemFileSystem()))
+	server := NewServer(store)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go server.Serve(l)
+
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+		assert.Nil(t, store.Close())
+	})
+
+	return server, dial(t, l.Addr().String())
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return &testClient{conn: conn, r: NewReader(conn), w: NewWriter(conn)}
+}
+
+func (c *testClient) do(t *testing.T, args ...string) interface{} {
+	c.send(t, args...)
+	return c.receive(t)
+}
+
+func (c *testClient) send(t *testing.T, args ...string) {
+	command := make([][]byte, len(args))
+	for i, arg := range args {
+		command[i] = []byte(arg)
+	}
+	c.w.WriteCommand(command...)
+	require.Nil(t, c.w.Flush())
+}
+
+func (c *testClient) receive(t *testing.T) interface{} {
+	require.Nil(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reply, err := c.r.ReadValue()
+	require.Nil(t, err)
+	return reply
+}
+
+func TestServer_commands(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, "PONG", client.do(t, "PING"))
+	assert.Equal(t, []byte("hello"), client.do(t, "ping", "hello"))
+
+	assert.Equal(t, "OK", client.do(t, "SET", "key", "value"))
+	assert.Equal(t, []byte("value"), client.do(t, "GET", "key"))
+	assert.Nil(t, client.do(t, "GET", "missing"))
+
+	assert.Equal(t, int64(1), client.do(t, "EXISTS", "key"))
+	assert.Equal(t, int64(2), client.do(t, "EXISTS", "key", "key", "missing"))
+	assert.Equal(t, int64(1), client.do(t, "DEL", "key", "missing"))
+	assert.Equal(t, int64(0), client.do(t, "EXISTS", "key"))
+
+	assert.Equal(t, "OK", client.do(t, "MSET", "a", "1", "b", "2"))
+	assert.Equal(t, []interface{}{[]byte("1"), nil, []byte("2")}, client.do(t, "MGET", "a", "missing", "b"))
+
+	assert.Equal(t, Error("ERR unknown command 'FOO'"), client.do(t, "FOO"))
+	assert.Equal(t, Error("ERR wrong number of arguments for 'get' command"), client.do(t, "GET"))
+	assert.Equal(t, Error("ERR wrong number of arguments for 'mset' command"), client.do(t, "MSET", "a", "1", "b"))
+	assert.Equal(t, Error("ERR syntax error"), client.do(t, "SET", "key", "value", "NX"))
+}
+
+func TestServer_setExpire(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	assert.Equal(t, "OK", client.do(t, "SET", "ex", "value", "EX", "10"))
+	assert.Equal(t, "OK", client.do(t, "SET", "px", "value", "PX", "50"))
+	assert.Equal(t, []byte("value"), client.do(t, "GET", "px"))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, client.do(t, "GET", "px"))
+	assert.Equal(t, []byte("value"), client.do(t, "GET", "ex"))
+
+	assert.Equal(t, Error("ERR invalid expire time in 'set' command"), client.do(t, "SET", "key", "value", "EX", "0"))
+	assert.Equal(t, Error("ERR invalid expire time in 'set' command"), client.do(t, "SET", "key", "value", "EX", "9223372036"))
+	assert.Equal(t, Error("ERR invalid expire time in 'set' command"), client.do(t, "SET", "key", "value", "PX", "9223372036854775807"))
+	assert.Equal(t, Error("ERR value is not an integer or out of range"), client.do(t, "SET", "key", "value", "PX", "abc"))
+	assert.Equal(t, Error("ERR syntax error"), client.do(t, "SET", "key", "value", "EX"))
+}
+
+func TestServer_keysAndScan(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	for i := 0; i < 25; i++ {
+		assert.Equal(t, "OK", client.do(t, "SET", "user:"+strconv.Itoa(i), "value"))
+	}
+	assert.Equal(t, "OK", client.do(t, "SET", "session:1", "value"))
+
+	assert.Len(t, client.do(t, "KEYS", "*"), 26)
+	assert.Equal(t, []interface{}{[]byte("user:20"), []byte("user:21")}, client.do(t, "KEYS", "user:2[0-1]"))
+
+	scanned := make([]interface{}, 0)
+	cursor := "0"
+	for {
+		reply := client.do(t, "SCAN", cursor, "MATCH", "user:*", "COUNT", "7").([]interface{})
+		scanned = append(scanned, reply[1].([]interface{})...)
+		cursor = string(reply[0].([]byte))
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Len(t, scanned, 25)
+
+	assert.Equal(t, Error("ERR invalid cursor"), client.do(t, "SCAN", "abc"))
+}
+
+func TestServer_pipeline(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	// every command is sent before reading any reply
+	for i := 0; i < 100; i++ {
+		client.w.WriteCommand([]byte("SET"), []byte(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 100; i++ {
+		client.w.WriteCommand([]byte("GET"), []byte(strconv.Itoa(i)))
+	}
+	require.Nil(t, client.w.Flush())
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "OK", client.receive(t))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, []byte(strconv.Itoa(i)), client.receive(t))
+	}
+}
+
+func TestServer_inlineCommand(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestServer(t)
+
+	_, err := client.conn.Write([]byte("SET key value\r\nGET key\r\nQUIT\r\n"))
+	require.Nil(t, err)
+
+	assert.Equal(t, "OK", client.receive(t))
+	assert.Equal(t, []byte("value"), client.receive(t))
+	assert.Equal(t, "OK", client.receive(t))
+}
+
+func TestServer_Close(t *testing.T) {
+	t.Parallel()
+
+	store := caskdb.NewMemoryStorage()
+	server := NewServer(store)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	serveErr := make(chan error)
+	go func() {
+		serveErr <- server.Serve(l)
+	}()
+
+	client := dial(t, l.Addr().String())
+	assert.Equal(t, "PONG", client.do(t, "PING"))
+
+	assert.Nil(t, server.Close())
+	assert.ErrorIs(t, <-serveErr, ErrServerClosed)
+
+	// connection is closed by the server
+	require.Nil(t, client.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = client.r.ReadValue()
+	assert.Error(t, err)
+}
+
+func TestServer_Register(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer(caskdb.NewMemoryStorage())
+	server.Register("ECHO", 2, 2, func(_ caskdb.Store, w *Writer, args [][]byte) error {
+		w.WriteBulk(args[0])
+		return nil
+	})
+	server.Register("get", 2, 2, func(_ caskdb.Store, w *Writer, args [][]byte) error {
+		return Error("ERR disabled")
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go server.Serve(l)
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+	})
+
+	client := dial(t, l.Addr().String())
+	assert.Equal(t, []byte("hello"), client.do(t, "echo", "hello"))
+	assert.Equal(t, Error("ERR wrong number of arguments for 'echo' command"), client.do(t, "echo"))
+	assert.Equal(t, Error("ERR disabled"), client.do(t, "GET", "key"))
+
+	// other server is not affected
+	_, other := newTestServer(t)
+	assert.Nil(t, other.do(t, "GET", "key"))
+}
+
+func TestServer_MaxBulkBytes(t *testing.T) {
+	t.Parallel()
+
+	store := caskdb.NewMemoryStorage()
+	server := NewServer(store)
+	server.MaxBulkBytes = 16
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go server.Serve(l)
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+	})
+
+	client := dial(t, l.Addr().String())
+	assert.Equal(t, "OK", client.do(t, "SET", "key", "0123456789abcdef"))
+
+	_, err = client.conn.Write([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$17\r\n"))
+	require.Nil(t, err)
+	assert.Equal(t, Error("ERR Protocol error: invalid length"), client.receive(t))
+}
@@ -0,0 +1,97 @@
+package caskdb
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// keyDirEntryOverhead is the estimated memory used by every key in
+// keyDir besides the key itself, the map buckets are not included
+const keyDirEntryOverhead = int64(unsafe.Sizeof(keyDirEntry{}) + unsafe.Sizeof("") + unsafe.Sizeof(&keyDirEntry{}))
+
+// Stats is a snapshot of the storage statistics
+type Stats struct {
+	KeyCount  int   `json:"key_count"` // include expired key that is not removed by merge yet
+	FileCount int   `json:"file_count"`
+	TotalSize int64 `json:"total_size"` // total size of the datafiles in bytes
+	// LiveSize is the size of the entries pointed by keyDir and the datafile headers, the
+	// rest is overwritten, deleted or tombstone entries that can be removed by merge
+	LiveSize int64       `json:"live_size"`
+	DeadSize int64       `json:"dead_size"`
+	Files    []FileStats `json:"files"` // in ascending file id
+	// KeyDirMemory is the estimated bytes of memory used by keyDir
+	KeyDirMemory   int64 `json:"keydir_memory"`
+	ActiveFileID   int   `json:"active_file_id"`
+	ActiveFileSize int64 `json:"active_file_size"`
+	MaxFileSize    int64 `json:"max_file_size"`
+	// LastMerge is when the last merge is finished, it is zero if there
+	// is no merge since the storage is opened
+	LastMerge time.Time `json:"last_merge"`
+
+	// the operation counters are cumulative since the storage is opened
+	Gets         uint64 `json:"gets"`
+	Misses       uint64 `json:"misses"` // gets of the key that doesn't exist or expired
+	Sets         uint64 `json:"sets"`
+	Deletes      uint64 `json:"deletes"`
+	BytesWritten uint64 `json:"bytes_written"` // to the datafiles, including merge and replication
+	BytesRead    uint64 `json:"bytes_read"`    // from the datafiles, including merge
+}
+
+// FileStats is the size of a datafile
+type FileStats struct {
+	FileID   int   `json:"file_id"`
+	Size     int64 `json:"size"`
+	LiveSize int64 `json:"live_size"`
+	DeadSize int64 `json:"dead_size"`
+}
+
+// operationStats is the operation counters, every field is updated atomically
+type operationStats struct {
+	gets         uint64
+	misses       uint64
+	sets         uint64
+	deletes      uint64
+	bytesWritten uint64
+	bytesRead    uint64
+}
+
+func (s *DiskStorage) Stats() Stats {
+	s.RLock()
+	defer s.RUnlock()
+
+	stats := Stats{
+		KeyCount:     len(s.keyDir),
+		FileCount:    len(s.files),
+		Files:        make([]FileStats, 0, len(s.files)),
+		ActiveFileID: s.activeFileID,
+		MaxFileSize:  s.maxFileSize,
+		LastMerge:    s.lastMerge,
+		Gets:         atomic.LoadUint64(&s.operations.gets),
+		Misses:       atomic.LoadUint64(&s.operations.misses),
+		Sets:         atomic.LoadUint64(&s.operations.sets),
+		Deletes:      atomic.LoadUint64(&s.operations.deletes),
+		BytesWritten: atomic.LoadUint64(&s.operations.bytesWritten),
+		BytesRead:    atomic.LoadUint64(&s.operations.bytesRead),
+	}
+
+	liveSizes := make(map[int]int64, len(s.files))
+	for key, keyData := range s.keyDir {
+		liveSizes[keyData.FileID] += keyData.DataLength
+		stats.KeyDirMemory += int64(len(key)) + keyDirEntryOverhead
+	}
+	for _, fileID := range s.sortedFileIDs() {
+		size := s.files[fileID].Size()
+		live := liveSizes[fileID] + dataFileHeaderLength
+		f := FileStats{FileID: fileID, Size: size, LiveSize: live, DeadSize: size - live}
+		stats.Files = append(stats.Files, f)
+		stats.TotalSize += f.Size
+		stats.LiveSize += f.LiveSize
+		stats.DeadSize += f.DeadSize
+		if fileID == s.activeFileID {
+			stats.ActiveFileSize = size
+		}
+	}
+
+	return stats
+}
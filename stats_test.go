@@ -0,0 +1,72 @@
+package caskdb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage_Stats(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()).SetMaxFileSize("1KB"))
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	assert.Nil(t, store.Delete([]byte("0")))
+
+	stats := store.Stats()
+	assert.Equal(t, 99, stats.KeyCount)
+	assert.Equal(t, len(store.files), stats.FileCount)
+	assert.Greater(t, stats.FileCount, 1)
+
+	// 100 entries + 1 tombstone
+	expectedSize := int64(100*defaultHeaderLength + 1*defaultHeaderLength + 1)
+	for i := 0; i < 100; i++ {
+		expectedSize += int64(len(strconv.Itoa(i)) + len("value"))
+	}
+	bytesWritten := expectedSize
+	// every datafile starts with the header
+	expectedSize += int64(stats.FileCount * dataFileHeaderLength)
+	assert.Equal(t, expectedSize, stats.TotalSize)
+
+	// the tombstone and the deleted entry are dead
+	deleted := int64(2*defaultHeaderLength + len("0value") + len("0"))
+	assert.Equal(t, expectedSize-deleted, stats.LiveSize)
+	assert.Equal(t, deleted, stats.DeadSize)
+	require.Len(t, stats.Files, stats.FileCount)
+	var fileSizes int64
+	for _, f := range stats.Files {
+		assert.Equal(t, f.Size, f.LiveSize+f.DeadSize)
+		fileSizes += f.Size
+	}
+	assert.Equal(t, stats.TotalSize, fileSizes)
+	assert.Equal(t, stats.Files[len(stats.Files)-1].FileID, stats.ActiveFileID)
+	assert.Equal(t, stats.Files[len(stats.Files)-1].Size, stats.ActiveFileSize)
+	assert.Equal(t, int64(1024), stats.MaxFileSize)
+	assert.Greater(t, stats.KeyDirMemory, int64(99*keyDirEntryOverhead))
+	assert.True(t, stats.LastMerge.IsZero())
+
+	assert.Equal(t, uint64(100), stats.Sets)
+	assert.Equal(t, uint64(1), stats.Deletes)
+	assert.Equal(t, uint64(bytesWritten), stats.BytesWritten)
+	assert.Zero(t, stats.Gets)
+
+	_, err := store.Get([]byte("1"))
+	assert.Nil(t, err)
+	_, err = store.Get([]byte("0"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	stats = store.Stats()
+	assert.Equal(t, uint64(2), stats.Gets)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(defaultHeaderLength+len("1value")), stats.BytesRead)
+
+	before := time.Now()
+	assert.Nil(t, store.Merge())
+	stats = store.Stats()
+	assert.False(t, stats.LastMerge.Before(before))
+	assert.Zero(t, stats.DeadSize)
+}
@@ -0,0 +1,21 @@
+package caskdb
+
+import "time"
+
+// Store is the interface implemented by every storage engine, so the
+// application can use different engine, e.g. MemoryStorage for testing
+type Store interface {
+	// Get will return ErrRecordNotFound if the key doesn't exist
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	// SetWithTTL will set the key that is expired after the ttl
+	SetWithTTL(key, value []byte, ttl time.Duration) error
+	// Delete will return ErrRecordNotFound if the key doesn't exist
+	Delete(key []byte) error
+	// Iterate will call fn for every key in ascending order,
+	// the iteration is stopped when fn returns error
+	Iterate(fn func(key, value []byte) error) error
+	// IterateKeys is the same as Iterate, but without reading the value
+	IterateKeys(fn func(key []byte) error) error
+	Close() error
+}
@@ -0,0 +1,46 @@
+package caskdb_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+	"github.com/luqmansen/go-caskdb/storetest"
+)
+
+func TestStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disk", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) caskdb.Store {
+			testFolder := path.Join("testdata", "conformance_"+uuid.NewString())
+			if err := os.MkdirAll(testFolder, 0777); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				os.RemoveAll(testFolder)
+			})
+
+			return caskdb.NewDiskStorage(path.Join(testFolder, "test"))
+		})
+	})
+
+	t.Run("disk with memory filesystem", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) caskdb.Store {
+			options := caskdb.NewOptions().
+				SetFileSystem(caskdb.NewMemFileSystem()).
+				SetMaxFileSize("1KB").
+				SetEncryptionKey([]byte("0123456789abcdef"))
+			return caskdb.NewDiskStorage("db/test", options)
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) caskdb.Store {
+			return caskdb.NewMemoryStorage()
+		})
+	})
+}
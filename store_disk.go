@@ -2,28 +2,43 @@ package caskdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"go.uber.org/zap"
 )
 
 const (
 	hintFilesExtension = "hint"
 )
 
-var errRecordNotFound = errors.New("record not found")
+var (
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrCorrupted is returned when the entry read from the datafiles is not valid
+	ErrCorrupted = errors.New("record is corrupted")
+	// ErrReadOnly is returned when writing to the storage that is replicating from the primary
+	ErrReadOnly = errors.New("storage is read-only replica")
+	// ErrUnsupportedFormat is returned when the datafile is not written in
+	// the format of this version, e.g. by caskdb before the format is versioned
+	ErrUnsupportedFormat = errors.New("unsupported datafile format")
+	// ErrUpdateAborted can be wrapped by the error returned from the Update callback
+	// to abort the update on purpose, e.g. failed condition, so it is not counted as
+	// failed operation by metrics.Collector
+	ErrUpdateAborted = errors.New("update aborted")
+	errInvalidTTL    = errors.New("ttl must be positive")
+	errNilRecord     = errors.New("update callback returned nil record without error")
+)
+
+var _ Store = (*DiskStorage)(nil)
 
 type keyDirEntry struct {
 	//FileID indicate which files is this entry stored, because there
@@ -37,245 +52,822 @@ type keyDirEntry struct {
 	// how to use this to get current entry:
 	// data = currentOffset + DataLength
 	DataLength int64
+	// Expiry in unixnano, 0 means the entry never expire
+	Expiry int64
+}
+
+func (k *keyDirEntry) expired(now int64) bool {
+	return k.Expiry != 0 && k.Expiry <= now
+}
+
+// hintFiles is the content of the hint files written on Close. FileSizes
+// is used to detect whether datafiles has been changed after the hint
+// files is written, in that case the hint files can't be used
+type hintFiles struct {
+	// Version is the formatVersion of the hint files, hint files
+	// of the other version is ignored like the stale one
+	Version   int
+	KeyDir    map[string]*keyDirEntry
+	FileSizes map[int]int64
 }
 
 type DiskStorage struct {
+	// operations is the first field, so its counters are 64-bit
+	// aligned for the atomic operations on 32-bit platforms
+	operations operationStats
+	// lastTimestamp is the timestamp of the latest write, every write gets a larger
+	// timestamp, so the timestamp is unique even if the clock goes backwards
+	lastTimestamp int64
+
 	*sync.RWMutex
 
 	dbFileFullPath string
 	// map the key with the offset position of the value
 	keyDir map[string]*keyDirEntry
 
-	files []*datafile
+	// files hold every datafile by its file id, new entry
+	// is only appended to the active file
+	files        map[int]*datafile
+	activeFileID int
 	//maxFileSize is maximum size of single log file. size in bytes
 	maxFileSize int64
 
-	logger *zap.Logger
+	// compressor is used to compress value on Set, while compressors
+	// hold every known codec, so value can be decompressed on Get
+	compressor           Compressor
+	compressionThreshold int64
+	compressors          map[uint8]Compressor
+
+	// syncWrites will sync the active file after every write
+	syncWrites bool
+
+	// fs is where the datafiles and hint files are stored
+	fs FileSystem
+
+	// keyring is used to encrypt entry and hint files,
+	// it is nil when encryption is disabled
+	keyring *keyring
+
+	// changed is closed and replaced whenever the datafiles is changed,
+	// so replication can wait for new entry. guarded by the lock
+	changed chan struct{}
+	// readOnly is set while the storage is replicating from the primary
+	readOnly bool
+	// epoch is the replication history of the datafiles, guarded by the lock
+	epoch replicationEpoch
+	// watchers receive every change, guarded by the lock
+	watchers map[*Watcher]struct{}
+	// fileRemoval is held by Backup to keep the datafiles from being
+	// removed, it is always locked before the storage lock
+	fileRemoval sync.RWMutex
+	// consumers is the committed change log position of every
+	// registered consumer, it is replaced on every change
+	consumers map[string]Position
+	// observer is notified about every operation, it is nil if not set
+	observer Observer
+	// hooks are called before and after the operations
+	hooks []Hook
+	// lastMerge is when the last merge is finished, guarded by the lock
+	lastMerge time.Time
+
+	logger Logger
 }
 
-func NewDiskStorage(filename string) *DiskStorage {
-	files := make([]*datafile, 1)
-	files[0] = openDataFile(fmt.Sprintf("%s_%d", filename, 0))
-
-	// todo: move this outside this function
-	rawJSON := []byte(`{
-   "level": "error",
-   "encoding": "json",
-   "outputPaths": ["stdout"],
-   "errorOutputPaths": ["stderr"],
-   "encoderConfig": {
-     "messageKey": "message",
-     "levelKey": "level",
-     "levelEncoder": "lowercase"
-   }
- }`)
-
-	var cfg zap.Config
-	if err := json.Unmarshal(rawJSON, &cfg); err != nil {
+// NewDiskStorage will open the database, options that affect how the
+// existing data is read (e.g. encryption key, filesystem) must be passed
+// here instead of WithOptions
+func NewDiskStorage(filename string, options ...*Options) *DiskStorage {
+	ds := newDiskStorage(filename, options)
+	_, after := ds.runHooks(context.Background(), HookInfo{Operation: OperationRecover})
+	ds.initKeyDir()
+	after(nil)
+	if err := ds.loadConsumers(); err != nil {
 		panic(err)
 	}
-	logger, err := cfg.Build()
-	if err != nil {
+	if err := ds.loadEpoch(); err != nil {
 		panic(err)
 	}
 
+	return ds
+}
+
+// newDiskStorage will apply the options without opening the datafiles
+func newDiskStorage(filename string, options []*Options) *DiskStorage {
 	ds := &DiskStorage{
 		RWMutex:        &sync.RWMutex{},
-		files:          files,
+		files:          make(map[int]*datafile),
 		keyDir:         make(map[string]*keyDirEntry),
 		dbFileFullPath: filename,
-		logger:         logger,
 		maxFileSize:    100 * 1024 * 1024, // default size 100MB
+		compressors:    make(map[uint8]Compressor),
+		fs:             OSFileSystem{},
+		changed:        make(chan struct{}),
+		watchers:       make(map[*Watcher]struct{}),
+		consumers:      make(map[string]Position),
+	}
+	for _, c := range builtinCompressors {
+		ds.compressors[c.ID()] = c
+	}
+	for _, o := range options {
+		ds.WithOptions(o)
+	}
+	if ds.logger == nil {
+		ds.logger = defaultLogger()
 	}
-
-	ds.initKeyDir()
 
 	return ds
 }
 
+// WithOptions will apply the options that are set, the hooks replace
+// the existing ones, so the same options can be applied again
 func (s *DiskStorage) WithOptions(options *Options) {
 	if options.maxFileSize != 0 {
 		s.maxFileSize = options.maxFileSize
 	}
+	if options.compressor != nil {
+		s.compressor = options.compressor
+		s.compressionThreshold = options.compressionThreshold
+		s.compressors[options.compressor.ID()] = options.compressor
+	}
+	if options.keyring != nil {
+		s.keyring = options.keyring
+	}
+	if options.fs != nil {
+		s.fs = options.fs
+	}
+	if options.syncWrites {
+		s.syncWrites = options.syncWrites
+	}
+	if options.observer != nil {
+		s.observer = options.observer
+	}
+	if options.logger != nil {
+		s.logger = options.logger
+	}
+	if options.hooks != nil {
+		s.hooks = append([]Hook{}, options.hooks...)
+	}
 }
 
 func (s *DiskStorage) Set(key, value []byte) error {
-	data := newEntry(time.Now().UnixNano(), key, value)
-	dataSize, databyte := data.encode()
+	return s.SetContext(context.Background(), key, value)
+}
 
-	s.Lock()
-	fileID, file := s.currentFiles()
-	if file.Size() >= s.maxFileSize {
-		fileID, file = s.addNewDataFile()
+// SetContext will return the context error without writing the key if
+// the context is done before the storage lock is acquired, e.g. while
+// merge is running. The write can't be aborted once it is started
+func (s *DiskStorage) SetContext(ctx context.Context, key, value []byte) error {
+	return s.set(ctx, key, value, 0)
+}
+
+// SetWithTTL will set the key that is expired after the ttl,
+// expired key is treated as if it doesn't exist
+func (s *DiskStorage) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return s.SetWithTTLContext(context.Background(), key, value, ttl)
+}
+
+// SetWithTTLContext is SetWithTTL that is aborted like SetContext
+func (s *DiskStorage) SetWithTTLContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errInvalidTTL
 	}
-	s.Unlock()
 
-	_, offset, err := file.Write(databyte)
+	return s.set(ctx, key, value, time.Now().Add(ttl).UnixNano())
+}
+
+func (s *DiskStorage) set(ctx context.Context, key, value []byte, expiry int64) error {
+	return s.setRecord(ctx, key, &Record{Value: value, Timestamp: s.nextTimestamp(), Expiry: expiry}, false)
+}
+
+// setRecord will write the record with its timestamp as is, the record is
+// not written if skipOlder is true and the existing record is not older
+func (s *DiskStorage) setRecord(ctx context.Context, key []byte, record *Record, skipOlder bool) (err error) {
+	start := time.Now()
+	ctx, after := s.runHooks(ctx, HookInfo{Operation: OperationSet, Key: key})
+	defer func() {
+		after(err)
+		s.observe(OperationSet, start, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	data, err := s.newValueEntry(record.Timestamp, key, record.Value, record.Expiry)
 	if err != nil {
 		return err
 	}
 
 	s.Lock()
 	defer s.Unlock()
-	s.keyDir[string(key)] = &keyDirEntry{
-		// offset represent current offset after this data is written
-		// thus, the location of current data should be subtracted by the
-		// size of current data
-		FileID:         fileID,
-		Timestamp:      time.Now().UnixNano(),
-		LocationOffset: offset - dataSize,
-		DataLength:     dataSize,
+
+	// the lock can't be cancelled, so the context is checked again once it is acquired
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if old, found := s.keyDir[string(key)]; skipOlder && found && old.Timestamp >= record.Timestamp {
+		return nil
 	}
+	keyData, err := s.appendEntry(ctx, data)
+	if err != nil {
+		return err
+	}
+	s.keyDir[string(key)] = keyData
+	s.advanceTimestamp(record.Timestamp)
+	atomic.AddUint64(&s.operations.sets, 1)
+	s.notifyWatchers(EventPut, key, record.Value, keyData.Timestamp, record.Expiry)
 
 	return nil
 }
 
+// nextTimestamp will return the current time in unixnano, or the
+// next of the last returned timestamp if the clock is behind it
+func (s *DiskStorage) nextTimestamp() int64 {
+	for {
+		last := atomic.LoadInt64(&s.lastTimestamp)
+		timestamp := time.Now().UnixNano()
+		if timestamp <= last {
+			timestamp = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&s.lastTimestamp, last, timestamp) {
+			return timestamp
+		}
+	}
+}
+
+// advanceTimestamp will make sure the next timestamp is larger than the
+// timestamp of the entry that is written before, e.g. by the primary
+func (s *DiskStorage) advanceTimestamp(timestamp int64) {
+	for {
+		last := atomic.LoadInt64(&s.lastTimestamp)
+		if timestamp <= last || atomic.CompareAndSwapInt64(&s.lastTimestamp, last, timestamp) {
+			return
+		}
+	}
+}
+
+// newValueEntry will return compressed and encrypted entry that is ready to be written
+func (s *DiskStorage) newValueEntry(timestamp int64, key, value []byte, expiry int64) (*entry, error) {
+	value, codec, err := s.compress(value)
+	if err != nil {
+		return nil, err
+	}
+	data := newEntry(timestamp, key, value)
+	data.header.expiry = expiry
+	data.header.codec = codec
+	if err = s.sealEntry(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 func (s *DiskStorage) Get(key []byte) ([]byte, error) {
-	s.RLock()
-	defer s.RUnlock()
+	return s.GetContext(context.Background(), key)
+}
+
+// GetContext will return the context error if the context is done
+// before the storage lock is acquired, e.g. while merge is running
+func (s *DiskStorage) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	record, err := s.getRecordContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return record.Value, nil
+}
+
+//Delete will only add "tombstone" value to entry, deletion on disk
+//will be performed when there is a merging process
+func (s *DiskStorage) Delete(key []byte) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is Delete that is aborted like SetContext
+func (s *DiskStorage) DeleteContext(ctx context.Context, key []byte) error {
+	return s.delete(ctx, key)
+}
+
+func (s *DiskStorage) delete(ctx context.Context, key []byte) (err error) {
+	start := time.Now()
+	ctx, after := s.runHooks(ctx, HookInfo{Operation: OperationDelete, Key: key})
+	defer func() {
+		after(err)
+		s.observe(OperationDelete, start, err)
+	}()
 
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	data := newEntry(s.nextTimestamp(), key, nil)
+	data.header.flags |= flagTombstone
+	if err = s.sealEntry(data); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
 	keyData, found := s.keyDir[string(key)]
 	if !found {
-		return nil, errRecordNotFound
+		return ErrRecordNotFound
+	}
+	if keyData.expired(time.Now().UnixNano()) {
+		delete(s.keyDir, string(key))
+		return ErrRecordNotFound
+	}
+	if _, err = s.appendEntry(ctx, data); err != nil {
+		return err
+	}
+	delete(s.keyDir, string(key))
+	atomic.AddUint64(&s.operations.deletes, 1)
+	s.notifyWatchers(EventDelete, key, nil, data.header.timestamp, 0)
+
+	return nil
+}
+
+// Iterate will call fn for every key in ascending order. Key that is
+// set after the iteration started might not be visited, while deleted
+// key is skipped. fn is allowed to modify the storage
+func (s *DiskStorage) Iterate(fn func(key, value []byte) error) error {
+	return s.IterateContext(context.Background(), fn)
+}
+
+// IterateContext is Iterate that is stopped with the context error
+// once the context is done, fn is not called after that. The values are
+// read like Export, the Get hooks are not called and the reads are not
+// counted as gets in Stats
+func (s *DiskStorage) IterateContext(ctx context.Context, fn func(key, value []byte) error) error {
+	for _, key := range s.sortedKeys() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := s.peekRecord(key)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err = fn([]byte(key), record.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IterateKeys is the same as Iterate, but without reading the value
+func (s *DiskStorage) IterateKeys(fn func(key []byte) error) error {
+	return s.IterateKeysContext(context.Background(), fn)
+}
+
+// IterateKeysContext is IterateKeys that is stopped like IterateContext
+func (s *DiskStorage) IterateKeysContext(ctx context.Context, fn func(key []byte) error) error {
+	for _, key := range s.sortedKeys() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortedKeys will return every key that is not expired in ascending order
+func (s *DiskStorage) sortedKeys() []string {
+	s.RLock()
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, len(s.keyDir))
+	for key, keyData := range s.keyDir {
+		if !keyData.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	s.RUnlock()
+	sort.Strings(keys)
+
+	return keys
+}
+
+// appendEntry will write the entry to the active file and return its
+// location, new active file is created once it reaches maxFileSize.
+// caller must hold the write lock
+func (s *DiskStorage) appendEntry(ctx context.Context, e *entry) (*keyDirEntry, error) {
+	dataSize, databyte := e.encode()
+
+	fileID, file := s.currentFiles()
+	if file.Size() >= s.maxFileSize || file.failed {
+		previousFileID, previousSize, failed := fileID, file.Size(), file.failed
+		_, after := s.runHooks(ctx, HookInfo{Operation: OperationRotate, FileID: s.activeFileID + 1})
+		var err error
+		fileID, file, err = s.addNewDataFile()
+		after(err)
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Info("active datafile is rotated", "previousFileID", previousFileID,
+			"previousSize", previousSize, "failed", failed, "fileID", fileID)
+	}
+
+	_, offset, err := file.Write(databyte)
+	if err == nil && s.syncWrites {
+		err = s.syncFile(file)
 	}
+	if err != nil {
+		file.failed = true
+		return nil, err
+	}
+	atomic.AddUint64(&s.operations.bytesWritten, uint64(dataSize))
+	s.notifyChanged()
+
+	return &keyDirEntry{
+		// offset represent current offset after this data is written
+		// thus, the location of current data should be subtracted by the
+		// size of current data
+		FileID:         fileID,
+		Timestamp:      e.header.timestamp,
+		LocationOffset: offset - dataSize,
+		DataLength:     dataSize,
+		Expiry:         e.header.expiry,
+	}, nil
+}
 
+// readEntry will read the entry pointed by keyData, key and value
+// of the returned entry is already decrypted
+func (s *DiskStorage) readEntry(keyData *keyDirEntry) (*entry, error) {
 	data := make([]byte, keyData.DataLength)
 	_, err := s.files[keyData.FileID].ReadAt(data, keyData.LocationOffset)
-	if err != nil {
-		s.logger.Error(err.Error(), zap.Any("key", keyData))
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: entry exceeds the end of the files", ErrCorrupted)
+	} else if err != nil {
 		return nil, err
 	}
+	atomic.AddUint64(&s.operations.bytesRead, uint64(len(data)))
 
 	dataEntry := decodeEntry(data)
+	if int64(defaultHeaderLength+dataEntry.header.keySize+dataEntry.header.valueSize) != keyData.DataLength {
+		return nil, fmt.Errorf("%w: entry size doesn't match the header", ErrCorrupted)
+	}
+	if !validChecksum(data) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	if err = s.openEntry(&dataEntry); errors.Is(err, errDecryption) {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	} else if err != nil {
+		return nil, err
+	}
 
-	return dataEntry.value, nil
+	return &dataEntry, nil
 }
 
-//Delete will only add "tombstone" value to entry, deletion on disk
-//will be performed when there is a merging process
-func (s *DiskStorage) Delete(key []byte) {
-	panic("implement me!")
+func (s *DiskStorage) initKeyDir() {
+	fileIDs := s.listDataFiles()
+	if err := s.upgradeDataFiles(fileIDs); err != nil {
+		panic(err)
+	}
+	if len(fileIDs) == 0 {
+		fileIDs = append(fileIDs, 0)
+	}
+	for _, fileID := range fileIDs {
+		file, err := openDataFile(s.fs, s.dataFileName(fileID))
+		if err != nil {
+			panic(err)
+		}
+		s.files[fileID] = file
+	}
+	s.activeFileID = fileIDs[len(fileIDs)-1]
+
+	start := time.Now()
+	if s.loadHintFiles() {
+		s.logger.Info("keyDir is loaded from the hint files", "keys", len(s.keyDir),
+			"datafiles", len(fileIDs), "duration", time.Since(start))
+		// the hint files doesn't tell whether the active file ends with partially written
+		// entry, new entry appended after it would be lost when the keyDir is recovered
+		// from the datafiles
+		if err := s.checkDataFileTail(s.activeFileID); err != nil {
+			s.logger.Warn("active datafile is truncated or corrupted", "fileID", s.activeFileID, "error", err)
+			s.files[s.activeFileID].failed = true
+		}
+		return
+	}
+
+	// hint files does not exist, will load key from entire db files one-by-one,
+	// from the oldest files, so newer entry will replace the older one
+	for _, fileID := range fileIDs {
+		if err := s.loadDataFile(fileID); err != nil {
+			// the last entry is partially written or corrupted, the
+			// rest of the files is ignored and new entry must be
+			// written to the new files
+			s.logger.Error("datafile is truncated or corrupted", "fileID", fileID, "error", err)
+			s.files[fileID].failed = true
+		}
+		s.logger.Debug("datafile is loaded", "fileID", fileID, "size", s.files[fileID].Size())
+	}
+	s.logger.Info("keyDir is recovered from the datafiles", "keys", len(s.keyDir),
+		"datafiles", len(fileIDs), "duration", time.Since(start))
 }
 
-func (s *DiskStorage) initKeyDir() {
-	hintFiles := fmt.Sprintf("%s.%s", s.dbFileFullPath, hintFilesExtension)
-	b, err := ioutil.ReadFile(hintFiles)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+// loadHintFiles will load keyDir from the hint files, it returns false
+// when hint files doesn't exist or can't be used
+func (s *DiskStorage) loadHintFiles() bool {
+	b, err := readFile(s.fs, s.hintFileName())
+	if errors.Is(err, os.ErrNotExist) {
+		s.logger.Debug("hint files doesn't exist")
+		return false
+	} else if err != nil {
 		panic(err)
 	}
 
-	// hint files does not exist, will load key from entire db files one-by-one
-	if !errors.Is(err, os.ErrNotExist) {
-		// hint files exist, will load key that
-		buff := bytes.NewBuffer(b)
-		d := gob.NewDecoder(buff)
+	hint, err := s.decodeHintFiles(b)
+	if err != nil {
+		s.logger.Error("unable to read hint files", "error", err)
+		return false
+	}
+
+	if len(hint.FileSizes) != len(s.files) {
+		s.logger.Info("hint files is stale, the number of datafiles is changed",
+			"hintDatafiles", len(hint.FileSizes), "datafiles", len(s.files))
+		return false
+	}
+	for fileID, file := range s.files {
+		if size, exists := hint.FileSizes[fileID]; !exists || size != file.Size() {
+			s.logger.Info("hint files is stale, the datafile is changed",
+				"fileID", fileID, "hintSize", size, "size", file.Size())
+			return false
+		}
+	}
+	now := time.Now().UnixNano()
+	for key, keyData := range hint.KeyDir {
+		s.advanceTimestamp(keyData.Timestamp)
+		if keyData.expired(now) {
+			delete(hint.KeyDir, key)
+		}
+	}
+	s.keyDir = hint.KeyDir
+
+	return true
+}
 
-		err = d.Decode(&s.keyDir)
+// decodeHintFiles will decrypt and decode the content of the hint files
+func (s *DiskStorage) decodeHintFiles(b []byte) (*hintFiles, error) {
+	var err error
+	if s.keyring != nil {
+		if b, err = s.keyring.open(b, additionalDataHintFiles); err != nil {
+			return nil, fmt.Errorf("unable to decrypt hint files: %w", err)
+		}
+	}
+
+	hint := &hintFiles{}
+	if err = gob.NewDecoder(bytes.NewBuffer(b)).Decode(hint); err != nil {
+		return nil, fmt.Errorf("unable to decode hint files: %w", err)
+	}
+	if hint.Version != formatVersion {
+		return nil, fmt.Errorf("%w: hint files version is %d, only version %d is supported",
+			ErrUnsupportedFormat, hint.Version, formatVersion)
+	}
+
+	return hint, nil
+}
+
+// loadDataFile will read every entry of the datafile and put its location to keyDir,
+// io.ErrUnexpectedEOF is returned when the last entry is partially written, and
+// ErrCorrupted when the entry doesn't match its checksum
+func (s *DiskStorage) loadDataFile(fileID int) error {
+	file := s.files[fileID]
+	header := make([]byte, defaultHeaderLength)
+	now := time.Now().UnixNano()
+	currOffset := int64(dataFileHeaderLength)
+
+	for {
+		n, err := file.ReadAt(header, currOffset)
 		if err != nil {
-			panic(err)
+			if errors.Is(err, io.EOF) && n == 0 {
+				return nil
+			} else if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			} else {
+				panic(err)
+			}
+		}
+
+		headerData := decodeHeader(header)
+		if !entryFits(headerData, file.Size()-currOffset) {
+			return io.ErrUnexpectedEOF
 		}
+		totalSize := int64(defaultHeaderLength + headerData.keySize + headerData.valueSize)
 
-	} else if errors.Is(err, os.ErrNotExist) {
-		parentPath, file := path.Split(s.dbFileFullPath)
-		dirs, err := os.ReadDir(parentPath)
+		data := make([]byte, totalSize)
+		_, err = file.ReadAt(data, currOffset)
 		if err != nil {
 			panic(err)
 		}
-		dbFileList := make([]string, 0)
+		if !validChecksum(data) {
+			return fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupted, currOffset)
+		}
+		if _, err = s.indexEntry(fileID, currOffset, data, now); err != nil {
+			panic(err)
+		}
 
-		for _, dir := range dirs {
-			if !strings.Contains(dir.Name(), file) {
-				continue
-			}
-			dbFileList = append(dbFileList, path.Join(parentPath, dir.Name()))
+		currOffset += totalSize
+	}
+}
+
+// checkDataFileTail will walk the headers of every entry in the datafile, and
+// return io.ErrUnexpectedEOF if the last entry is partially written
+func (s *DiskStorage) checkDataFileTail(fileID int) error {
+	file := s.files[fileID]
+	header := make([]byte, defaultHeaderLength)
+	size := file.Size()
+	offset := int64(dataFileHeaderLength)
+	for offset < size {
+		if size-offset < defaultHeaderLength {
+			return io.ErrUnexpectedEOF
 		}
-		sort.Slice(dbFileList, func(i, j int) bool { return dbFileList[i] > dbFileList[j] })
-
-		for idx, dbFile := range dbFileList {
-			files := openDataFile(dbFile)
-			header := make([]byte, defaultHeaderLength)
-			var currOffset int64
-
-			for {
-				headerOffset, err := files.ReadAt(header, currOffset)
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						break
-					} else {
-						panic(err)
-					}
-				}
-
-				headerData := decodeHeader(header)
-
-				key := make([]byte, headerData.keySize)
-				keyOffset, err := files.ReadAt(key, currOffset+int64(headerOffset))
-				if err != nil {
-					panic(err)
-				}
-
-				value := make([]byte, headerData.valueSize)
-				_, err = files.ReadAt(value, currOffset+int64(headerOffset+keyOffset))
-				if err != nil {
-					panic(err)
-				}
-
-				totalSize := defaultHeaderLength + headerData.keySize + headerData.valueSize
-
-				if _, exists := s.keyDir[string(key)]; !exists {
-					s.keyDir[string(key)] = &keyDirEntry{
-						FileID:         idx,
-						Timestamp:      headerData.timestamp,
-						LocationOffset: currOffset,
-						DataLength:     int64(totalSize),
-					}
-					s.files[idx] = files
-				}
-
-				currOffset += int64(totalSize)
-			}
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return err
 		}
+		h := decodeHeader(header)
+		if !entryFits(h, size-offset) {
+			return io.ErrUnexpectedEOF
+		}
+		offset += int64(defaultHeaderLength + h.keySize + h.valueSize)
+	}
+
+	return nil
+}
+
+// indexEntry will put the location of the encoded entry stored at the
+// offset to keyDir, or remove the key if it is deleted or expired.
+// The decoded entry is returned
+func (s *DiskStorage) indexEntry(fileID int, offset int64, data []byte, now int64) (*entry, error) {
+	dataEntry := decodeEntry(data)
+	if err := s.openEntry(&dataEntry); err != nil {
+		return nil, err
+	}
+
+	keyData := &keyDirEntry{
+		FileID:         fileID,
+		Timestamp:      dataEntry.header.timestamp,
+		LocationOffset: offset,
+		DataLength:     int64(len(data)),
+		Expiry:         dataEntry.header.expiry,
+	}
+	s.advanceTimestamp(keyData.Timestamp)
+	if dataEntry.header.flags&flagTombstone != 0 || keyData.expired(now) {
+		delete(s.keyDir, string(dataEntry.key))
+	} else {
+		s.keyDir[string(dataEntry.key)] = keyData
 	}
+
+	return &dataEntry, nil
 }
 
 func (s *DiskStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for w := range s.watchers {
+		s.closeWatcher(w, nil)
+	}
+
+	// the hint files can't tell that the active file is failed, so entries
+	// appended after reopening would follow the partially written entry.
+	// The replica keeps the same datafiles as the primary, it is reset instead
+	if _, file := s.currentFiles(); file != nil && file.failed && !s.readOnly {
+		if _, _, err := s.addNewDataFile(); err != nil {
+			return err
+		}
+	}
+
+	for _, files := range s.files {
+		if err := s.syncFile(files); err != nil {
+			return err
+		}
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	s.logger.Debug("hint files is written", "keys", len(s.keyDir), "datafiles", len(s.files))
 	for _, files := range s.files {
 		if err := files.Close(); err != nil {
 			return err
 		}
 	}
-	return s.flush()
+	return nil
 }
 
 func (s *DiskStorage) flush() error {
 	// flush key dir to hint files
-	filename := fmt.Sprintf("%s.%s", s.dbFileFullPath, hintFilesExtension)
-	f := openDataFile(filename)
+	hint := hintFiles{
+		KeyDir:    s.keyDir,
+		FileSizes: make(map[int]int64, len(s.files)),
+	}
+	for fileID, file := range s.files {
+		hint.FileSizes[fileID] = file.Size()
+	}
 
+	return s.writeHintFiles(s.hintFileName(), hint)
+}
+
+func (s *DiskStorage) writeHintFiles(name string, hint hintFiles) error {
+	hint.Version = formatVersion
 	b := new(bytes.Buffer)
 	e := gob.NewEncoder(b)
-	err := e.Encode(s.keyDir)
+	err := e.Encode(hint)
 	if err != nil {
 		panic(err)
 	}
-	_, _, err = f.Write(b.Bytes())
-	return err
+
+	data := b.Bytes()
+	if s.keyring != nil {
+		data, err = s.keyring.seal(data, additionalDataHintFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(s.fs, name, data)
 }
 
 // addNewDataFile will add new datafile to file list and return its file id
-func (s *DiskStorage) addNewDataFile() (int, *datafile) {
-	fileID := len(s.files)
-	fileName := s.dbFileFullPath + "_" + strconv.Itoa(fileID)
-	file := openDataFile(fileName)
-	s.files = append(s.files, file)
+func (s *DiskStorage) addNewDataFile() (int, *datafile, error) {
+	fileID := s.activeFileID + 1
+	file, err := openDataFile(s.fs, s.dataFileName(fileID))
+	if err != nil {
+		return 0, nil, err
+	}
+	s.files[fileID] = file
+	s.activeFileID = fileID
+	s.logger.Debug("datafile is created", "fileID", fileID)
+
+	return fileID, file, nil
+}
 
-	return fileID, file
+// notifyChanged will wake up everyone waiting for the datafiles
+// to be changed, caller must hold the write lock
+func (s *DiskStorage) notifyChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// sortedFileIDs will return id of every open datafile in ascending order
+func (s *DiskStorage) sortedFileIDs() []int {
+	fileIDs := make([]int, 0, len(s.files))
+	for fileID := range s.files {
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Ints(fileIDs)
+
+	return fileIDs
 }
 
 //currentFiles will get index of current active file and the file itself
 func (s *DiskStorage) currentFiles() (int, *datafile) {
-	fileID := len(s.files) - 1
-	f := s.files[fileID]
+	return s.activeFileID, s.files[s.activeFileID]
+}
+
+func (s *DiskStorage) dataFileName(fileID int) string {
+	return s.dbFileFullPath + "_" + strconv.Itoa(fileID)
+}
+
+func (s *DiskStorage) hintFileName() string {
+	return fmt.Sprintf("%s.%s", s.dbFileFullPath, hintFilesExtension)
+}
+
+// listDataFiles will return file id of every datafile in ascending order
+func (s *DiskStorage) listDataFiles() []int {
+	parentPath, file := path.Split(s.dbFileFullPath)
+	if parentPath == "" {
+		parentPath = "."
+	}
+	names, err := s.fs.List(parentPath)
+	if err != nil {
+		panic(err)
+	}
+
+	fileIDs := make([]int, 0)
+	for _, name := range names {
+		if !strings.HasPrefix(name, file+"_") {
+			continue
+		}
+		fileID, err := strconv.Atoi(strings.TrimPrefix(name, file+"_"))
+		if err != nil {
+			continue
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Ints(fileIDs)
 
-	return fileID, f
+	return fileIDs
 }
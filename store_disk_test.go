@@ -1,13 +1,16 @@
 package caskdb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -15,8 +18,11 @@ import (
 
 func initStorageHelper(name ...string) (*DiskStorage, string, func()) {
 	filename := ""
-	baseTestPath := "testdata"                     // location for test file, so we don't clutter root project
-	testFolder := name[0] + "_" + uuid.NewString() // each test will get its own folder
+	baseTestPath := "testdata"     // location for test file, so we don't clutter root project
+	testFolder := uuid.NewString() // each test will get its own folder
+	if len(name) >= 1 {
+		testFolder = name[0] + "_" + testFolder
+	}
 
 	if len(name) >= 1 {
 		filename = path.Join(append([]string{baseTestPath, testFolder}, name[1:]...)...)
@@ -49,11 +55,21 @@ func initStorageHelper(name ...string) (*DiskStorage, string, func()) {
 	return storage, filename, cleanup
 }
 
+// initMemStorageHelper will return storage on a new MemFileSystem, along
+// with the function to open it again, e.g. to recover the keyDir
+func initMemStorageHelper(options ...*Options) (*DiskStorage, *MemFileSystem, func(options ...*Options) *DiskStorage) {
+	fs := NewMemFileSystem()
+	open := func(options ...*Options) *DiskStorage {
+		return NewDiskStorage("db/test", append([]*Options{NewOptions().SetFileSystem(fs)}, options...)...)
+	}
+
+	return open(options...), fs, open
+}
+
 func Test_initKeyDir_useHintFiles(t *testing.T) {
 	t.Parallel()
 
-	store, filename, cleanupFunc := initStorageHelper()
-	defer cleanupFunc()
+	store, _, open := initMemStorageHelper()
 
 	kv := make(map[string][]byte)
 	for i := 0; i <= 10; i++ {
@@ -64,7 +80,7 @@ func Test_initKeyDir_useHintFiles(t *testing.T) {
 	}
 	assert.Nil(t, store.Close())
 
-	store = NewDiskStorage(filename)
+	store = open()
 	for k, v := range kv {
 		res, err := store.Get([]byte(k))
 		assert.Nil(t, err)
@@ -75,8 +91,7 @@ func Test_initKeyDir_useHintFiles(t *testing.T) {
 func Test_initKeyDir(t *testing.T) {
 	t.Parallel()
 
-	store, filename, cleanupFunc := initStorageHelper()
-	defer cleanupFunc()
+	store, _, open := initMemStorageHelper()
 
 	kv := make(map[string][]byte)
 	for i := 0; i <= 10; i++ {
@@ -86,7 +101,7 @@ func Test_initKeyDir(t *testing.T) {
 		assert.Nil(t, store.Set([]byte(k), v))
 	}
 
-	store = NewDiskStorage(filename)
+	store = open()
 	for k, v := range kv {
 		res, err := store.Get([]byte(k))
 		assert.Nil(t, err)
@@ -94,11 +109,152 @@ func Test_initKeyDir(t *testing.T) {
 	}
 }
 
+func Test_initKeyDir_multipleFiles(t *testing.T) {
+	t.Parallel()
+
+	options := NewOptions().SetMaxFileSize("1KB")
+	store, _, open := initMemStorageHelper(options)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("old")))
+	}
+
+	// entry written after reopen must be appended, and replace older entry
+	store = open(options)
+	for i := 0; i < 100; i += 2 {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("new")))
+	}
+
+	store = open(options)
+	for i := 0; i < 100; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		if i%2 == 0 {
+			assert.Equal(t, []byte("new"), res)
+		} else {
+			assert.Equal(t, []byte("old"), res)
+		}
+	}
+}
+
+func TestDiskStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	store, _, open := initMemStorageHelper()
+
+	assert.Nil(t, store.Set([]byte("deleted"), []byte("value")))
+	assert.Nil(t, store.Set([]byte("kept"), []byte("value")))
+	assert.Nil(t, store.Delete([]byte("deleted")))
+
+	// tombstone is loaded from datafiles
+	store = open()
+	_, err := store.Get([]byte("deleted"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	// tombstone is removed by merge
+	assert.Nil(t, store.Merge())
+	store = open()
+	_, err = store.Get([]byte("deleted"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	res, err := store.Get([]byte("kept"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res)
+}
+
+func TestDiskStorage_SetWithTTL(t *testing.T) {
+	t.Parallel()
+
+	store, _, open := initMemStorageHelper()
+
+	assert.Nil(t, store.SetWithTTL([]byte("expiring"), []byte("value"), 50*time.Millisecond))
+	assert.Nil(t, store.SetWithTTL([]byte("long"), []byte("value"), time.Hour))
+
+	// expiry is loaded from hint files
+	assert.Nil(t, store.Close())
+	store = open()
+	res, err := store.Get([]byte("expiring"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// expired key is skipped when loading datafiles
+	store = open()
+	_, err = store.Get([]byte("expiring"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	assert.NotContains(t, store.keyDir, "expiring")
+
+	res, err = store.Get([]byte("long"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res)
+}
+
+func TestDiskStorage_SetWithTTL_expired(t *testing.T) {
+	t.Parallel()
+
+	store, fs, open := initMemStorageHelper()
+	assert.ErrorIs(t, store.SetWithTTL([]byte("key"), []byte("value"), 0), errInvalidTTL)
+	assert.ErrorIs(t, store.SetWithTTL([]byte("key"), []byte("value"), -time.Second), errInvalidTTL)
+
+	// the expired keys are written as if they are expired during the test
+	past := time.Now().Add(-time.Second).UnixNano()
+	for _, key := range []string{"expired", "overwritten"} {
+		record := &Record{Value: []byte("value"), Timestamp: time.Now().UnixNano(), Expiry: past}
+		assert.Nil(t, store.setRecord(context.Background(), []byte(key), record, false))
+	}
+	assert.Nil(t, store.SetWithTTL([]byte("long"), []byte("value"), time.Hour))
+	assert.Nil(t, store.Set([]byte("kept"), []byte("value")))
+	// Set without ttl removes the expiry
+	assert.Nil(t, store.Set([]byte("overwritten"), []byte("value")))
+
+	_, err := store.Get([]byte("expired"))
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	assert.ErrorIs(t, store.Delete([]byte("expired")), ErrRecordNotFound)
+	assert.Nil(t, store.SetWithTTL([]byte("expired"), []byte("value"), time.Hour))
+	record := &Record{Value: []byte("value"), Timestamp: time.Now().UnixNano(), Expiry: past}
+	assert.Nil(t, store.setRecord(context.Background(), []byte("expired"), record, false))
+
+	keys := make([]string, 0)
+	assert.Nil(t, store.IterateKeys(func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"kept", "long", "overwritten"}, keys)
+	keys = keys[:0]
+	assert.Nil(t, store.Iterate(func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"kept", "long", "overwritten"}, keys)
+
+	// merge removes the expired keys from keyDir and the datafiles
+	assert.Contains(t, store.keyDir, "expired")
+	assert.Nil(t, store.Merge())
+	assert.NotContains(t, store.keyDir, "expired")
+	assert.Equal(t, 3, store.Stats().KeyCount)
+	for name, file := range fs.files {
+		assert.NotContains(t, string(file.data), "expired", name)
+	}
+
+	store = open()
+	assert.Equal(t, 3, store.Stats().KeyCount)
+	for _, key := range []string{"kept", "long", "overwritten"} {
+		res, err := store.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, "value", string(res))
+	}
+	record, err = store.GetRecord([]byte("long"))
+	assert.Nil(t, err)
+	assert.Greater(t, record.Expiry, time.Now().UnixNano())
+	record, err = store.GetRecord([]byte("overwritten"))
+	assert.Nil(t, err)
+	assert.Zero(t, record.Expiry)
+}
+
 func TestDiskStorage_singleKey(t *testing.T) {
 	t.Parallel()
 
-	store, _, cleanupFunc := initStorageHelper()
-	defer cleanupFunc()
+	store, _, _ := initMemStorageHelper()
 
 	assert.Nil(t, store.Set([]byte("yeet"), []byte("donjon")))
 	res, err := store.Get([]byte("yeet"))
@@ -112,15 +268,12 @@ func TestDiskStorage_multiKey(t *testing.T) {
 	t.Run("test correct file split", func(t *testing.T) {
 		t.Parallel()
 
-		store, filePath, cleanupFunc := initStorageHelper(t.Name(), "test")
-		defer cleanupFunc()
-
-		store.WithOptions(NewOptions().SetMaxFileSize("1MB"))
+		store, fs, _ := initMemStorageHelper(NewOptions().SetMaxFileSize("1MB"))
 
 		kv := make(map[string][]byte)
-		// this will equal to 3.2 MB of record
-		// 1 key consist of 24b header +  2~5 byte of kv pair
-		// this should split into 4 files (3x 1MB + 1x ~200KB)
+		// this will equal to 4.8 MB of record
+		// 1 key consist of 38b header +  2~12 byte of kv pair
+		// this should split into 5 files (4x 1MB + 1x ~800KB)
 		for i := 0; i <= 100_000; i++ {
 			kv[strconv.Itoa(i)] = []byte(strconv.Itoa(i))
 		}
@@ -132,24 +285,20 @@ func TestDiskStorage_multiKey(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Equal(t, v, res)
 		}
-		subPath, _ := path.Split(filePath)
-		dirs, err := os.ReadDir(subPath)
+		dirs, err := fs.List("db")
 		if err != nil {
 			panic(err)
 		}
-		assert.Len(t, dirs, 4) // there should be exactly 4 files in here
+		assert.Len(t, dirs, 5) // there should be exactly 5 files in here
 	})
 
 	t.Run("test one million key", func(t *testing.T) {
 		t.Parallel()
 
-		store, filePath, cleanupFunc := initStorageHelper(t.Name(), "test")
-		defer cleanupFunc()
-
-		store.WithOptions(NewOptions().SetMaxFileSize("20MB"))
+		store, fs, _ := initMemStorageHelper(NewOptions().SetMaxFileSize("20MB"))
 
 		kv := make(map[string][]byte)
-		for i := 0; i <= 1_000_000; i++ { // this will roughly generate 34MB files
+		for i := 0; i <= 1_000_000; i++ { // this will roughly generate 50MB files
 			kv[strconv.Itoa(i)] = []byte(strconv.Itoa(i))
 		}
 		for k, v := range kv {
@@ -161,12 +310,11 @@ func TestDiskStorage_multiKey(t *testing.T) {
 			assert.Equal(t, v, res)
 		}
 
-		subPath, _ := path.Split(filePath)
-		dirs, err := os.ReadDir(subPath)
+		dirs, err := fs.List("db")
 		if err != nil {
 			panic(err)
 		}
-		assert.Len(t, dirs, 2) // there should be exactly 2 files in here
+		assert.Len(t, dirs, 3) // there should be exactly 3 files in here
 	})
 
 }
@@ -174,14 +322,13 @@ func TestDiskStorage_multiKey(t *testing.T) {
 func TestDiskStorage_concurrent(t *testing.T) {
 
 	t.Run("concurrent 1K Key, 1KB Filesize", func(t *testing.T) {
-		store, filePath, _ := initStorageHelper(t.Name(), "test")
-		//defer cleanupFunc()
-
-		store.WithOptions(NewOptions().SetMaxFileSize("1KB"))
+		store, fs, _ := initMemStorageHelper(NewOptions().SetMaxFileSize("1KB"))
 
+		// key and value have the same size, so every entry is 38b header + 8 byte of kv pair,
+		// this will generate ~46KB of data
 		kv := make(map[string][]byte)
-		for i := 0; i <= 1_000; i++ { // this will generate ~29KB of data
-			kv[strconv.Itoa(i)] = []byte(strconv.Itoa(i))
+		for i := 0; i <= 1_000; i++ {
+			kv[fmt.Sprintf("%04d", i)] = []byte(fmt.Sprintf("%04d", i))
 		}
 
 		limitChan := make(chan struct{}, 8000) // limit maximum number of goroutine on test with race detector
@@ -221,18 +368,18 @@ func TestDiskStorage_concurrent(t *testing.T) {
 		}
 		wgGet.Wait()
 
-		subPath, _ := path.Split(filePath)
-		dirs, err := os.ReadDir(subPath)
+		dirs, err := fs.List("db")
 		if err != nil {
 			panic(err)
 		}
-		assert.Len(t, dirs, 29)
+		// new entry is appended until the datafile reaches 1KB, including the datafile header
+		entrySize := defaultHeaderLength + 8
+		entriesPerFile := (1024 - dataFileHeaderLength + entrySize - 1) / entrySize
+		assert.Len(t, dirs, (len(kv)+entriesPerFile-1)/entriesPerFile) // 44 files
 	})
 
 	t.Run("concurrent 10K Key, 1MB Filesize", func(t *testing.T) {
-		store, _, cleanupFunc := initStorageHelper(t.Name(), "test")
-		defer cleanupFunc()
-		store.WithOptions(NewOptions().SetMaxFileSize("1MB"))
+		store, _, _ := initMemStorageHelper(NewOptions().SetMaxFileSize("1MB"))
 
 		kv := make(map[string][]byte)
 		for i := 0; i <= 10_000; i++ {
@@ -278,9 +425,7 @@ func TestDiskStorage_concurrent(t *testing.T) {
 	})
 
 	t.Run("concurrent 100K Key, 1MB Filesize", func(t *testing.T) {
-		store, _, cleanupFunc := initStorageHelper(t.Name(), "test")
-		defer cleanupFunc()
-		store.WithOptions(NewOptions().SetMaxFileSize("1MB"))
+		store, _, _ := initMemStorageHelper(NewOptions().SetMaxFileSize("1MB"))
 
 		kv := make(map[string][]byte)
 		for i := 0; i <= 100_000; i++ {
@@ -384,3 +529,91 @@ func BenchmarkNewDiskStorage_from_hintFiles(b *testing.B) {
 func equalByte(t *testing.T, expected, actual []byte) {
 	assert.Equal(t, string(expected), string(actual))
 }
+
+func TestDiskStorage_context(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.SetContext(context.Background(), []byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := store.GetContext(ctx, []byte("0"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, store.SetContext(ctx, []byte("0"), []byte("cancelled")), context.Canceled)
+	assert.ErrorIs(t, store.SetWithTTLContext(ctx, []byte("0"), []byte("cancelled"), time.Hour), context.Canceled)
+	assert.ErrorIs(t, store.DeleteContext(ctx, []byte("1")), context.Canceled)
+
+	// nothing is written by the cancelled operations
+	res, err := store.Get([]byte("0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+	_, err = store.Get([]byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), store.Stats().Sets)
+
+	// the lock can't be cancelled, so the deadline is checked again once it is acquired
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	store.Lock()
+	done := make(chan error)
+	go func() {
+		done <- store.SetContext(ctx, []byte("0"), []byte("late"))
+	}()
+	<-ctx.Done()
+	store.Unlock()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	res, err = store.Get([]byte("0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
+
+func TestDiskStorage_IterateContext(t *testing.T) {
+	t.Parallel()
+
+	hook := &tracingHook{}
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()).AddHook(hook))
+	defer store.Close()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	hook.take()
+
+	// the values are read without the Get hooks and without counting them as gets
+	assert.Nil(t, store.Iterate(func(key, value []byte) error {
+		assert.Equal(t, "value", string(value))
+		return nil
+	}))
+	assert.Empty(t, hook.take())
+	assert.Equal(t, uint64(0), store.Stats().Gets)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var visited []string
+	err := store.IterateContext(ctx, func(key, value []byte) error {
+		visited = append(visited, string(key))
+		if len(visited) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"0", "1", "2"}, visited)
+
+	visited = nil
+	err = store.IterateKeysContext(ctx, func(key []byte) error {
+		visited = append(visited, string(key))
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, visited)
+
+	assert.Nil(t, store.IterateKeysContext(context.Background(), func(key []byte) error {
+		visited = append(visited, string(key))
+		return nil
+	}))
+	assert.Len(t, visited, 10)
+}
@@ -0,0 +1,154 @@
+package caskdb
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errStoreClosed = errors.New("store is closed")
+
+var _ Store = (*MemoryStorage)(nil)
+
+// MemoryStorage is Store that keep every key in memory,
+// data is lost once it is closed
+type MemoryStorage struct {
+	*sync.RWMutex
+
+	data   map[string]memoryEntry
+	closed bool
+}
+
+type memoryEntry struct {
+	value []byte
+	// expiry in unixnano, 0 means the entry never expire
+	expiry int64
+}
+
+func (e memoryEntry) expired(now int64) bool {
+	return e.expiry != 0 && e.expiry <= now
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		RWMutex: &sync.RWMutex{},
+		data:    make(map[string]memoryEntry),
+	}
+}
+
+func (s *MemoryStorage) Get(key []byte) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.closed {
+		return nil, errStoreClosed
+	}
+	e, found := s.data[string(key)]
+	if !found || e.expired(time.Now().UnixNano()) {
+		return nil, ErrRecordNotFound
+	}
+
+	return append([]byte{}, e.value...), nil
+}
+
+func (s *MemoryStorage) Set(key, value []byte) error {
+	return s.set(key, value, 0)
+}
+
+func (s *MemoryStorage) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errInvalidTTL
+	}
+
+	return s.set(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+func (s *MemoryStorage) set(key, value []byte, expiry int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return errStoreClosed
+	}
+	s.data[string(key)] = memoryEntry{
+		value:  append([]byte{}, value...),
+		expiry: expiry,
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Delete(key []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return errStoreClosed
+	}
+	e, found := s.data[string(key)]
+	if !found {
+		return ErrRecordNotFound
+	}
+	delete(s.data, string(key))
+	if e.expired(time.Now().UnixNano()) {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Iterate will call fn for every key in ascending order, the same
+// as DiskStorage, fn is allowed to modify the storage
+func (s *MemoryStorage) Iterate(fn func(key, value []byte) error) error {
+	for _, key := range s.sortedKeys() {
+		value, err := s.Get([]byte(key))
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err = fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) IterateKeys(fn func(key []byte) error) error {
+	for _, key := range s.sortedKeys() {
+		if err := fn([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortedKeys will return every key that is not expired in ascending order
+func (s *MemoryStorage) sortedKeys() []string {
+	s.RLock()
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, len(s.data))
+	for key, e := range s.data {
+		if !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	s.RUnlock()
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (s *MemoryStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+	s.data = nil
+
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package storetest is a conformance test suite for caskdb.Store, every
+// storage engine should pass it to be used interchangeably
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	caskdb "github.com/luqmansen/go-caskdb"
+)
+
+// NewStoreFunc will return new empty store for each test, the store is closed by the test
+type NewStoreFunc func(t *testing.T) caskdb.Store
+
+// Run will run every conformance test against the store returned by newStore
+func Run(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store caskdb.Store)
+	}{
+		{name: "set and get", fn: testSetGet},
+		{name: "overwrite", fn: testOverwrite},
+		{name: "not found", fn: testNotFound},
+		{name: "empty and binary value", fn: testBinaryValue},
+		{name: "value is copied", fn: testValueIsCopied},
+		{name: "delete", fn: testDelete},
+		{name: "iterate", fn: testIterate},
+		{name: "iterate stop", fn: testIterateStop},
+		{name: "iterate and modify", fn: testIterateModify},
+		{name: "iterate keys", fn: testIterateKeys},
+		{name: "ttl", fn: testTTL},
+		{name: "concurrent", fn: testConcurrent},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			defer func() {
+				assert.Nil(t, store.Close())
+			}()
+
+			tt.fn(t, store)
+		})
+	}
+}
+
+func testSetGet(t *testing.T, store caskdb.Store) {
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value"+strconv.Itoa(i))))
+	}
+	for i := 0; i < 100; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "value"+strconv.Itoa(i), string(res))
+	}
+}
+
+func testOverwrite(t *testing.T, store caskdb.Store) {
+	assert.Nil(t, store.Set([]byte("key"), []byte("old")))
+	assert.Nil(t, store.Set([]byte("key"), []byte("new")))
+
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(res))
+}
+
+func testNotFound(t *testing.T, store caskdb.Store) {
+	_, err := store.Get([]byte("missing"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+}
+
+func testBinaryValue(t *testing.T, store caskdb.Store) {
+	binary := []byte{0, 1, 2, 255, 0, 254}
+	assert.Nil(t, store.Set(binary, binary))
+	assert.Nil(t, store.Set([]byte("empty"), []byte{}))
+
+	res, err := store.Get(binary)
+	assert.Nil(t, err)
+	assert.Equal(t, binary, res)
+
+	res, err = store.Get([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Len(t, res, 0)
+}
+
+func testValueIsCopied(t *testing.T, store caskdb.Store) {
+	value := []byte("value")
+	assert.Nil(t, store.Set([]byte("key"), value))
+	value[0] = 'X'
+
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+
+	res[0] = 'Y'
+	res, err = store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+}
+
+func testDelete(t *testing.T, store caskdb.Store) {
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, store.Delete([]byte("key")))
+
+	_, err := store.Get([]byte("key"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+	assert.ErrorIs(t, store.Delete([]byte("key")), caskdb.ErrRecordNotFound)
+
+	// key can be set again after deleted
+	assert.Nil(t, store.Set([]byte("key"), []byte("again")))
+	res, err := store.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "again", string(res))
+}
+
+func testIterate(t *testing.T, store caskdb.Store) {
+	expected := []string{"a", "b", "c", "d"}
+	for _, key := range []string{"d", "b", "a", "c", "e"} {
+		assert.Nil(t, store.Set([]byte(key), []byte("value-"+key)))
+	}
+	assert.Nil(t, store.Delete([]byte("e")))
+
+	keys := make([]string, 0)
+	err := store.Iterate(func(key, value []byte) error {
+		assert.Equal(t, "value-"+string(key), string(value))
+		keys = append(keys, string(key))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, keys)
+}
+
+func testIterateStop(t *testing.T, store caskdb.Store) {
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err := store.Iterate(func(key, value []byte) error {
+		visited++
+		if visited == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 3, visited)
+}
+
+func testIterateModify(t *testing.T, store caskdb.Store) {
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	err := store.Iterate(func(key, value []byte) error {
+		if err := store.Set(key, []byte("modified")); err != nil {
+			return err
+		}
+		// delete the next key, it should not be visited
+		next, _ := strconv.Atoi(string(key))
+		err := store.Delete([]byte(strconv.Itoa(next + 1)))
+		if err != nil && !errors.Is(err, caskdb.ErrRecordNotFound) {
+			return err
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		res, err := store.Get([]byte(strconv.Itoa(i)))
+		if i%2 == 0 {
+			assert.Nil(t, err)
+			assert.Equal(t, "modified", string(res))
+		} else {
+			assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+		}
+	}
+}
+
+func testIterateKeys(t *testing.T, store caskdb.Store) {
+	for _, key := range []string{"b", "c", "a"} {
+		assert.Nil(t, store.Set([]byte(key), []byte("value")))
+	}
+
+	keys := make([]string, 0)
+	assert.Nil(t, store.IterateKeys(func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+}
+
+func testTTL(t *testing.T, store caskdb.Store) {
+	assert.Error(t, store.SetWithTTL([]byte("key"), []byte("value"), 0))
+
+	assert.Nil(t, store.SetWithTTL([]byte("expiring"), []byte("value"), 50*time.Millisecond))
+	assert.Nil(t, store.SetWithTTL([]byte("long"), []byte("value"), time.Hour))
+	res, err := store.Get([]byte("expiring"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(res))
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = store.Get([]byte("expiring"))
+	assert.ErrorIs(t, err, caskdb.ErrRecordNotFound)
+	assert.ErrorIs(t, store.Delete([]byte("expiring")), caskdb.ErrRecordNotFound)
+
+	keys := make([]string, 0)
+	assert.Nil(t, store.IterateKeys(func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"long"}, keys)
+
+	// set without ttl will remove the expiry
+	assert.Nil(t, store.SetWithTTL([]byte("key"), []byte("value"), 50*time.Millisecond))
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	time.Sleep(100 * time.Millisecond)
+	_, err = store.Get([]byte("key"))
+	assert.Nil(t, err)
+}
+
+func testConcurrent(t *testing.T, store caskdb.Store) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("%d-%d", g, i))
+				assert.Nil(t, store.Set(key, key))
+				res, err := store.Get(key)
+				assert.Nil(t, err)
+				assert.Equal(t, key, res)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	count := 0
+	assert.Nil(t, store.Iterate(func(key, value []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 800, count)
+}
@@ -0,0 +1,120 @@
+package caskdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// v0HeaderLength is the byte length of the entry header written before the format is versioned,
+// | timestamp 8B | keySize 8B | valueSize 8B |, it has no checksum, expiry, codec or flags
+const v0HeaderLength = 24
+
+// upgradeDataFiles will rewrite every datafile written before the format is versioned
+// into the current format, then remove the hint files, so the keyDir is recovered from
+// the upgraded datafiles and the hint files is regenerated on close
+func (s *DiskStorage) upgradeDataFiles(fileIDs []int) error {
+	upgraded := 0
+	for _, fileID := range fileIDs {
+		ok, err := s.upgradeDataFile(s.dataFileName(fileID))
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.dataFileName(fileID), err)
+		}
+		if ok {
+			upgraded++
+		}
+	}
+	if upgraded == 0 {
+		return nil
+	}
+
+	s.logger.Info("datafiles written before the format is versioned are upgraded", "datafiles", upgraded)
+	if err := s.fs.Remove(s.hintFileName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// upgradeDataFile will rewrite the datafile if it doesn't start with the magic, it returns
+// false if the datafile is already in the current format. The datafile is replaced atomically,
+// so the upgrade continues from the remaining datafiles if it is interrupted
+func (s *DiskStorage) upgradeDataFile(name string) (bool, error) {
+	unversioned, err := isUnversionedDataFile(s.fs, name)
+	if err != nil || !unversioned {
+		return false, err
+	}
+
+	data, err := readFile(s.fs, name)
+	if err != nil {
+		return false, err
+	}
+
+	b := bytes.NewBuffer(encodeDataFileHeader())
+	var offset uint64
+	entries := 0
+	for offset+v0HeaderLength <= uint64(len(data)) {
+		timestamp := int64(binary.LittleEndian.Uint64(data[offset:]))
+		keySize := binary.LittleEndian.Uint64(data[offset+8:])
+		valueSize := binary.LittleEndian.Uint64(data[offset+16:])
+		remaining := uint64(len(data)) - offset - v0HeaderLength
+		if keySize > remaining || valueSize > remaining-keySize {
+			break
+		}
+
+		keyStart := offset + v0HeaderLength
+		valueStart := keyStart + keySize
+		e, err := s.newValueEntry(timestamp, data[keyStart:valueStart], data[valueStart:valueStart+valueSize], 0)
+		if err != nil {
+			return false, err
+		}
+		_, encoded := e.encode()
+		b.Write(encoded)
+		entries++
+		offset = valueStart + valueSize
+	}
+	if entries == 0 {
+		return false, fmt.Errorf("%w: datafile doesn't start with the magic, and it is not "+
+			"a datafile written before the format is versioned", ErrUnsupportedFormat)
+	}
+	if offset != uint64(len(data)) {
+		// the last entry is partially written, the baseline recovery ignored it as well
+		s.logger.Warn("truncated entry at the end of the datafile is dropped on upgrade",
+			"datafile", name, "offset", offset, "size", len(data))
+	}
+
+	if err = writeFile(s.fs, name, b.Bytes()); err != nil {
+		return false, err
+	}
+	s.logger.Debug("datafile is upgraded", "datafile", name, "entries", entries)
+
+	return true, nil
+}
+
+// isUnversionedDataFile will only read the beginning of the datafile, it returns
+// false for the empty datafile and the datafile in any versioned format
+func isUnversionedDataFile(fs FileSystem, name string) (bool, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	size, err := f.Size()
+	if err != nil {
+		return false, err
+	}
+	if size > int64(len(dataFileMagic)) {
+		size = int64(len(dataFileMagic))
+	}
+	prefix := make([]byte, size)
+	if size > 0 {
+		if _, err = f.ReadAt(prefix, 0); err != nil {
+			return false, err
+		}
+	}
+
+	return !bytes.HasPrefix(dataFileMagic, prefix), nil
+}
@@ -0,0 +1,221 @@
+package caskdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// VerifyReport is the result of Verify
+type VerifyReport struct {
+	Files []FileReport
+	Hint  HintReport
+}
+
+// FileReport is the result of scanning a datafile
+type FileReport struct {
+	FileID int
+	Size   int64
+	// Entries is the number of valid entries in the datafile
+	Entries int
+	// Corrupted is every byte range that is not a valid entry
+	Corrupted []CorruptRange
+}
+
+// CorruptRange is a byte range of the datafile from Start up to End that
+// doesn't contain any valid entry
+type CorruptRange struct {
+	Start  int64
+	End    int64
+	Reason string
+}
+
+// HintReport is the result of cross-checking the hint files against the datafiles
+type HintReport struct {
+	Exists bool
+	// Err is why the hint files can't be read, e.g. it can't be decrypted
+	Err string
+	// Stale is set when the datafiles are changed after the hint files is
+	// written, stale hint files are ignored when the database is opened,
+	// so its Orphaned and PastEnd keys are not counted as corruption
+	Stale bool
+	Keys  int
+	// Orphaned are the keys that doesn't point to a valid entry of the key
+	Orphaned []HintKey
+	// PastEnd are the keys that point past the end of the datafile
+	PastEnd []HintKey
+}
+
+// HintKey is a key in the hint files along with where it points to
+type HintKey struct {
+	Key    string
+	FileID int
+	Offset int64
+	Length int64
+	Reason string
+}
+
+// OK will return true if there is no corruption found
+func (r *VerifyReport) OK() bool {
+	for _, f := range r.Files {
+		if len(f.Corrupted) > 0 {
+			return false
+		}
+	}
+
+	return r.Hint.Err == "" && (r.Hint.Stale || (len(r.Hint.Orphaned) == 0 && len(r.Hint.PastEnd) == 0))
+}
+
+// Verify will check the database at dbPath without opening it, every entry of
+// the datafiles is checked against its checksum, and every key of the hint files
+// is checked to point to a valid entry. Nothing is written to the database, so it
+// can be used on a database that fails to open. The encryption key is required
+// to verify the hint files of encrypted database
+func Verify(dbPath string, options ...*Options) (*VerifyReport, error) {
+	s := newDiskStorage(dbPath, options)
+	fileIDs := s.listDataFiles()
+	if len(fileIDs) == 0 {
+		return nil, fmt.Errorf("no datafile is found at %s", dbPath)
+	}
+
+	report := &VerifyReport{Files: make([]FileReport, 0, len(fileIDs))}
+	// only a single datafile is kept in memory, valid is the size of every valid
+	// entry by its offset, the entry is read again to check the key of the hint files
+	sizes := make(map[int]int64, len(fileIDs))
+	valid := make(map[int]map[int64]int64, len(fileIDs))
+	for _, fileID := range fileIDs {
+		b, err := readFile(s.fs, s.dataFileName(fileID))
+		if err != nil {
+			return nil, err
+		}
+		if err = checkDataFileHeader(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.dataFileName(fileID), err)
+		}
+		sizes[fileID] = int64(len(b))
+		valid[fileID] = make(map[int64]int64)
+
+		f := FileReport{FileID: fileID, Size: int64(len(b))}
+		f.Corrupted = scanDataFile(b, func(offset int64, entryData []byte) {
+			valid[fileID][offset] = int64(len(entryData))
+			f.Entries++
+		})
+		report.Files = append(report.Files, f)
+	}
+
+	b, err := readFile(s.fs, s.hintFileName())
+	if errors.Is(err, os.ErrNotExist) {
+		return report, nil
+	} else if err != nil {
+		return nil, err
+	}
+	report.Hint.Exists = true
+	hint, err := s.decodeHintFiles(b)
+	if err != nil {
+		report.Hint.Err = err.Error()
+		return report, nil
+	}
+
+	report.Hint.Keys = len(hint.KeyDir)
+	report.Hint.Stale = len(hint.FileSizes) != len(fileIDs)
+	for fileID, size := range hint.FileSizes {
+		if actual, found := sizes[fileID]; !found || actual != size {
+			report.Hint.Stale = true
+		}
+	}
+	keys := make([]string, 0, len(hint.KeyDir))
+	for key := range hint.KeyDir {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	files := make(map[int]File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, key := range keys {
+		keyData := hint.KeyDir[key]
+		k := HintKey{Key: key, FileID: keyData.FileID, Offset: keyData.LocationOffset, Length: keyData.DataLength}
+		size, found := sizes[keyData.FileID]
+		switch {
+		case !found:
+			k.Reason = "datafile is not found"
+			report.Hint.Orphaned = append(report.Hint.Orphaned, k)
+		case keyData.LocationOffset < 0 || keyData.DataLength < 0 ||
+			keyData.DataLength > size-keyData.LocationOffset:
+			report.Hint.PastEnd = append(report.Hint.PastEnd, k)
+		case valid[keyData.FileID][keyData.LocationOffset] != keyData.DataLength:
+			k.Reason = "no valid entry at the offset"
+			report.Hint.Orphaned = append(report.Hint.Orphaned, k)
+		default:
+			f, found := files[keyData.FileID]
+			if !found {
+				if f, err = s.fs.Open(s.dataFileName(keyData.FileID)); err != nil {
+					return nil, err
+				}
+				files[keyData.FileID] = f
+			}
+			b := make([]byte, keyData.DataLength)
+			if _, err = f.ReadAt(b, keyData.LocationOffset); err != nil {
+				return nil, err
+			}
+			e := decodeEntry(b)
+			// the key of encrypted entry can only be compared with the encryption key
+			if err := s.openEntry(&e); err == nil && string(e.key) != key {
+				k.Reason = "entry has a different key"
+				report.Hint.Orphaned = append(report.Hint.Orphaned, k)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// scanDataFile will call fn with the offset and the encoded data of every
+// valid entry of the datafile, the datafile header must be checked by the
+// caller using checkDataFileHeader. After an invalid entry, the scan continues
+// from the next offset where a valid entry starts, the skipped byte ranges
+// are returned
+func scanDataFile(data []byte, fn func(offset int64, entryData []byte)) []CorruptRange {
+	corrupted := make([]CorruptRange, 0)
+	offset := int64(dataFileHeaderLength)
+	size := int64(len(data))
+	for offset < size {
+		entrySize, reason := checkEntry(data[offset:])
+		if reason == "" {
+			fn(offset, data[offset:offset+entrySize])
+			offset += entrySize
+			continue
+		}
+
+		start := offset
+		for offset++; offset < size; offset++ {
+			if _, r := checkEntry(data[offset:]); r == "" {
+				break
+			}
+		}
+		corrupted = append(corrupted, CorruptRange{Start: start, End: offset, Reason: reason})
+	}
+
+	return corrupted
+}
+
+// checkEntry will return the size of the entry at the start of data,
+// or the reason it is not a valid entry
+func checkEntry(data []byte) (int64, string) {
+	if len(data) < defaultHeaderLength {
+		return 0, "truncated header"
+	}
+	h := decodeHeader(data)
+	if !entryFits(h, int64(len(data))) {
+		return 0, "entry size exceeds the end of the datafile"
+	}
+	entrySize := int64(defaultHeaderLength + h.keySize + h.valueSize)
+	if !validChecksum(data[:entrySize]) {
+		return 0, "checksum mismatch"
+	}
+
+	return entrySize, ""
+}
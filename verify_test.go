@@ -0,0 +1,135 @@
+package caskdb
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	assert.Nil(t, store.Close())
+
+	report, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.True(t, report.OK())
+	assert.True(t, report.Hint.Exists)
+	assert.False(t, report.Hint.Stale)
+	assert.Equal(t, 50, report.Hint.Keys)
+	entries := 0
+	for _, f := range report.Files {
+		assert.Empty(t, f.Corrupted)
+		entries += f.Entries
+	}
+	assert.Equal(t, 50, entries)
+
+	_, err = Verify("db/missing", options)
+	assert.Error(t, err)
+}
+
+func TestVerify_corrupted(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	keyData := store.keyDir["1"]
+	assert.Nil(t, store.Close())
+
+	// the value of the second entry is corrupted, the scan continues from the third entry
+	data := fs.files["db/test_0"].data
+	data[keyData.LocationOffset+keyData.DataLength-1] ^= 0xff
+	// the last entry of the next file is truncated
+	last := fs.files["db/test_1"]
+	last.data = last.data[:len(last.data)-3]
+
+	report, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.False(t, report.OK())
+	require.Len(t, report.Files[0].Corrupted, 1)
+	assert.Equal(t, CorruptRange{
+		Start:  keyData.LocationOffset,
+		End:    keyData.LocationOffset + keyData.DataLength,
+		Reason: "checksum mismatch",
+	}, report.Files[0].Corrupted[0])
+	require.Len(t, report.Files[1].Corrupted, 1)
+	assert.Equal(t, int64(len(last.data)), report.Files[1].Corrupted[0].End)
+	assert.Equal(t, "entry size exceeds the end of the datafile", report.Files[1].Corrupted[0].Reason)
+
+	// the hint files still point to the corrupted entries
+	assert.True(t, report.Hint.Stale)
+	require.Len(t, report.Hint.Orphaned, 1)
+	assert.Equal(t, "1", report.Hint.Orphaned[0].Key)
+	assert.Equal(t, "no valid entry at the offset", report.Hint.Orphaned[0].Reason)
+	require.Len(t, report.Hint.PastEnd, 1)
+	assert.Equal(t, 1, report.Hint.PastEnd[0].FileID)
+}
+
+func TestVerify_staleHintFiles(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+	// the merged datafiles are removed after the hint files is written, then the storage is crashed
+	assert.Nil(t, store.flush())
+	assert.Nil(t, store.Merge())
+
+	report, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.True(t, report.Hint.Stale)
+	assert.NotEmpty(t, report.Hint.Orphaned)
+	assert.True(t, report.OK())
+}
+
+func TestVerify_hintFiles(t *testing.T) {
+	t.Parallel()
+
+	fs := NewMemFileSystem()
+	options := NewOptions().SetFileSystem(fs).SetMaxFileSize("1KB")
+	store := NewDiskStorage("db/test", options)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	// the hint files point to a removed datafile and to a different key
+	store.keyDir["1"], store.keyDir["2"] = store.keyDir["2"], store.keyDir["1"]
+	store.keyDir["missing"] = &keyDirEntry{FileID: 100, DataLength: 10}
+	assert.Nil(t, store.Close())
+
+	report, err := Verify("db/test", options)
+	require.Nil(t, err)
+	assert.False(t, report.OK())
+	assert.False(t, report.Hint.Stale)
+	reasons := make(map[string]string)
+	for _, k := range report.Hint.Orphaned {
+		reasons[k.Key] = k.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"1":       "entry has a different key",
+		"2":       "entry has a different key",
+		"missing": "datafile is not found",
+	}, reasons)
+
+	// hint files that can't be decoded are reported
+	assert.Nil(t, writeFile(fs, "db/test.hint", []byte("invalid")))
+	report, err = Verify("db/test", options)
+	require.Nil(t, err)
+	assert.False(t, report.OK())
+	assert.Contains(t, report.Hint.Err, "unable to decode hint files")
+}
@@ -0,0 +1,205 @@
+package caskdb
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+)
+
+const defaultWatchBufferSize = 1024
+
+// ErrWatcherOverflow is returned by Watcher.Err when the watcher is
+// closed because the consumer can't keep up with the writes
+var ErrWatcherOverflow = errors.New("watcher buffer is full")
+
+type EventType uint8
+
+const (
+	EventPut EventType = iota + 1
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change of a single key, Key and Value is shared by every
+// watcher so it must not be modified. Value is nil for EventDelete
+type Event struct {
+	Type  EventType
+	Key   []byte
+	Value []byte
+	// Timestamp is when the change is written in unixnano
+	Timestamp int64
+	// Expiry in unixnano, 0 means the key never expire
+	Expiry int64
+}
+
+// WatchOptions zero value, e.g. &WatchOptions{}, is the same as NewWatchOptions()
+type WatchOptions struct {
+	bufferSize int
+	dropEvents bool
+}
+
+func NewWatchOptions() *WatchOptions {
+	return &WatchOptions{bufferSize: defaultWatchBufferSize}
+}
+
+// SetBufferSize is the number of events that can be queued
+// before the consumer is considered too slow, 0 means the default
+func (o *WatchOptions) SetBufferSize(size int) *WatchOptions {
+	if size < 0 {
+		panic("buffer size must not be negative")
+	}
+	o.bufferSize = size
+
+	return o
+}
+
+// SetDropEvents will drop new events when the buffer is full, instead of
+// closing the watcher with ErrWatcherOverflow. The number of dropped
+// events is reported by Watcher.Dropped
+func (o *WatchOptions) SetDropEvents(drop bool) *WatchOptions {
+	o.dropEvents = drop
+
+	return o
+}
+
+// Watcher receive every change of the keys with the watched prefix, writes
+// are never blocked by the watcher, see WatchOptions for the slow consumer policy
+type Watcher struct {
+	store      *DiskStorage
+	prefix     []byte
+	events     chan Event
+	dropEvents bool
+	dropped    uint64
+
+	// err is guarded by the storage lock
+	err error
+}
+
+// Watch will return Watcher of the keys with the given prefix, empty prefix
+// watch every key. Events are sent in the write order once the write is
+// applied, including the writes replicated from the primary. Expired keys
+// and keys removed by merge doesn't produce any event
+func (s *DiskStorage) Watch(prefix []byte, options ...*WatchOptions) *Watcher {
+	o := NewWatchOptions()
+	for _, option := range options {
+		o = option
+	}
+
+	bufferSize := o.bufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultWatchBufferSize
+	}
+
+	w := &Watcher{
+		store:      s,
+		prefix:     append([]byte{}, prefix...),
+		events:     make(chan Event, bufferSize),
+		dropEvents: o.dropEvents,
+	}
+
+	s.Lock()
+	s.watchers[w] = struct{}{}
+	s.Unlock()
+
+	return w
+}
+
+// Events is closed once the watcher is closed, see Err for the reason
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Err will return ErrWatcherOverflow if the watcher is closed because
+// the buffer is full, it returns nil otherwise
+func (w *Watcher) Err() error {
+	w.store.RLock()
+	defer w.store.RUnlock()
+
+	return w.err
+}
+
+// Dropped will return the number of events dropped because the buffer is full
+func (w *Watcher) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close will stop the watcher and close the Events channel, queued events can still be received
+func (w *Watcher) Close() {
+	w.store.Lock()
+	defer w.store.Unlock()
+
+	w.store.closeWatcher(w, nil)
+}
+
+// closeWatcher caller must hold the write lock
+func (s *DiskStorage) closeWatcher(w *Watcher, err error) {
+	if _, found := s.watchers[w]; !found {
+		return
+	}
+	delete(s.watchers, w)
+	w.err = err
+	close(w.events)
+}
+
+// notifyWatchers will send the event to every watcher of the key, caller
+// must hold the write lock, so the events are sent in the write order
+func (s *DiskStorage) notifyWatchers(eventType EventType, key, value []byte, timestamp, expiry int64) {
+	if len(s.watchers) == 0 {
+		return
+	}
+
+	var event *Event
+	for w := range s.watchers {
+		if !bytes.HasPrefix(key, w.prefix) {
+			continue
+		}
+		if event == nil {
+			event = &Event{
+				Type:      eventType,
+				Key:       append([]byte{}, key...),
+				Timestamp: timestamp,
+				Expiry:    expiry,
+			}
+			if eventType == EventPut {
+				event.Value = append([]byte{}, value...)
+			}
+		}
+
+		select {
+		case w.events <- *event:
+		default:
+			if w.dropEvents {
+				atomic.AddUint64(&w.dropped, 1)
+			} else {
+				s.closeWatcher(w, ErrWatcherOverflow)
+			}
+		}
+	}
+}
+
+// notifyEntry will send the event of the entry written by replication,
+// caller must hold the write lock
+func (s *DiskStorage) notifyEntry(e *entry) error {
+	// entry rewritten by merge is not a change
+	if len(s.watchers) == 0 || e.header.flags&flagMerged != 0 {
+		return nil
+	}
+
+	event, err := s.entryEvent(e)
+	if err != nil {
+		return err
+	}
+	s.notifyWatchers(event.Type, event.Key, event.Value, event.Timestamp, event.Expiry)
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package caskdb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiveEvents will receive n events from the watcher
+func receiveEvents(t *testing.T, w *Watcher, n int) []Event {
+	events := make([]Event, 0, n)
+	for len(events) < n {
+		select {
+		case event, ok := <-w.Events():
+			require.True(t, ok, "watcher is closed after %d events", len(events))
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timeout waiting for events", "received %d of %d", len(events), n)
+		}
+	}
+
+	return events
+}
+
+func TestDiskStorage_Watch(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	w := store.Watch([]byte("user:"))
+	defer w.Close()
+
+	value := []byte("alice")
+	assert.Nil(t, store.Set([]byte("user:1"), value))
+	assert.Nil(t, store.Set([]byte("other"), []byte("value")))
+	assert.Nil(t, store.SetWithTTL([]byte("user:2"), []byte("bob"), time.Hour))
+	assert.Nil(t, store.Delete([]byte("user:1")))
+	assert.Nil(t, store.Update([]byte("user:2"), func(record *Record) (*Record, error) {
+		record.Value = []byte("bobby")
+		return record, nil
+	}))
+	// the event has its own copy of the value
+	value[0] = 'A'
+
+	events := receiveEvents(t, w, 4)
+	assert.Equal(t, EventPut, events[0].Type)
+	assert.Equal(t, "user:1", string(events[0].Key))
+	assert.Equal(t, "alice", string(events[0].Value))
+	assert.Equal(t, int64(0), events[0].Expiry)
+
+	assert.Equal(t, EventPut, events[1].Type)
+	assert.Equal(t, "user:2", string(events[1].Key))
+	assert.Equal(t, "bob", string(events[1].Value))
+	assert.Greater(t, events[1].Expiry, events[1].Timestamp)
+
+	assert.Equal(t, EventDelete, events[2].Type)
+	assert.Equal(t, "user:1", string(events[2].Key))
+	assert.Nil(t, events[2].Value)
+
+	assert.Equal(t, EventPut, events[3].Type)
+	assert.Equal(t, "bobby", string(events[3].Value))
+	assert.Equal(t, events[1].Expiry, events[3].Expiry)
+
+	for i := 1; i < len(events); i++ {
+		assert.Greater(t, events[i].Timestamp, events[i-1].Timestamp)
+	}
+	record, err := store.GetRecord([]byte("user:2"))
+	require.Nil(t, err)
+	assert.Equal(t, record.Timestamp, events[3].Timestamp)
+
+	select {
+	case event := <-w.Events():
+		assert.Fail(t, "unexpected event", "%s %s", event.Type, event.Key)
+	default:
+	}
+}
+
+func TestWatcher_Close(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+
+	w := store.Watch(nil)
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+	w.Close()
+	w.Close()
+	assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+
+	// queued events can still be received
+	events := receiveEvents(t, w, 1)
+	assert.Equal(t, "key", string(events[0].Key))
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.Nil(t, w.Err())
+
+	// closing the storage close every watcher
+	w = store.Watch(nil)
+	assert.Nil(t, store.Close())
+	_, ok = <-w.Events()
+	assert.False(t, ok)
+	assert.Nil(t, w.Err())
+}
+
+func TestWatcher_overflow(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	w := store.Watch(nil, NewWatchOptions().SetBufferSize(2))
+	dropping := store.Watch(nil, NewWatchOptions().SetBufferSize(2).SetDropEvents(true))
+	defer dropping.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, store.Set([]byte(strconv.Itoa(i)), []byte("value")))
+	}
+
+	// the slow watcher is closed, the writes are never blocked
+	events := receiveEvents(t, w, 2)
+	assert.Equal(t, "0", string(events[0].Key))
+	assert.Equal(t, "1", string(events[1].Key))
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.ErrorIs(t, w.Err(), ErrWatcherOverflow)
+
+	// the dropping watcher keeps the oldest events and continue once there is space
+	assert.Equal(t, uint64(3), dropping.Dropped())
+	events = receiveEvents(t, dropping, 2)
+	assert.Equal(t, "0", string(events[0].Key))
+	assert.Equal(t, "1", string(events[1].Key))
+	assert.Nil(t, store.Set([]byte("5"), []byte("value")))
+	events = receiveEvents(t, dropping, 1)
+	assert.Equal(t, "5", string(events[0].Key))
+	assert.Nil(t, dropping.Err())
+}
+
+func TestWatchOptions_zeroValue(t *testing.T) {
+	t.Parallel()
+
+	store := NewDiskStorage("db/test", NewOptions().SetFileSystem(NewMemFileSystem()))
+	defer store.Close()
+
+	// zero buffer size uses the default instead of unbuffered channel, which would overflow on the first event
+	for _, options := range []*WatchOptions{{}, NewWatchOptions().SetBufferSize(0)} {
+		w := store.Watch(nil, options)
+		assert.Equal(t, defaultWatchBufferSize, cap(w.events))
+		assert.Nil(t, store.Set([]byte("key"), []byte("value")))
+		events := receiveEvents(t, w, 1)
+		assert.Equal(t, "key", string(events[0].Key))
+		assert.Nil(t, w.Err())
+		w.Close()
+	}
+
+	assert.PanicsWithValue(t, "buffer size must not be negative", func() {
+		NewWatchOptions().SetBufferSize(-1)
+	})
+}
+
+func TestWatcher_replication(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	primary := NewDiskStorage("db/primary", NewOptions().
+		SetFileSystem(NewMemFileSystem()).
+		SetEncryptionKey(key))
+	defer primary.Close()
+	_, addr := newTestReplicationServer(t, primary)
+
+	store := NewDiskStorage("db/follower", NewOptions().SetFileSystem(NewMemFileSystem()).SetEncryptionKey(key))
+	defer store.Close()
+	w := store.Watch([]byte("key"))
+	defer w.Close()
+	follower := NewFollower(store, addr)
+	defer follower.Close()
+
+	assert.Nil(t, primary.SetWithTTL([]byte("key"), []byte("value"), time.Hour))
+	assert.Nil(t, primary.Delete([]byte("key")))
+
+	events := receiveEvents(t, w, 2)
+	assert.Equal(t, EventPut, events[0].Type)
+	assert.Equal(t, "key", string(events[0].Key))
+	assert.Equal(t, "value", string(events[0].Value))
+	assert.NotZero(t, events[0].Expiry)
+	assert.Equal(t, EventDelete, events[1].Type)
+	assert.Equal(t, "key", string(events[1].Key))
+}